@@ -2,68 +2,404 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"simple-storage/internal/apiserver"
+	"simple-storage/internal/auth"
+	"simple-storage/internal/chunkcache"
 	"simple-storage/internal/chunkmanager"
+	"simple-storage/internal/config"
+	"simple-storage/internal/encryption"
 	storageServerClient "simple-storage/internal/endpoint/storageserver"
+	entrypointGRPC "simple-storage/internal/entrypoint/grpc"
+	grpcHandler "simple-storage/internal/entrypoint/grpc/apiserver"
+	"simple-storage/internal/entrypoint/grpc/pb"
 	entrypoint "simple-storage/internal/entrypoint/http"
 	handler "simple-storage/internal/entrypoint/http/apiserver"
+	"simple-storage/internal/health"
+	"simple-storage/internal/logging"
+	"simple-storage/internal/resilience"
+	"simple-storage/internal/tlsconfig"
+	"simple-storage/internal/tracing"
 	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
+	configFile := flag.String("config", os.Getenv(config.EnvConfigFile),
+		"YAML file with settings, environment variables and flags override them")
+	config.APIServerFlags(flag.CommandLine)
+
+	flag.Parse()
+
+	var cfg config.APIServer
+
+	if err := config.Load(&cfg, *configFile, flag.CommandLine); err != nil {
+		fatal(slog.Default(), "invalid config", logging.Err(err))
+	}
+
+	level, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		fatal(slog.Default(), "invalid log level", logging.Err(err))
+	}
+
+	// The level is changed on /admin/log-level while the server runs.
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(level)
+
+	log, err := logging.New(logging.Config{
+		Format: cfg.Log.Format,
+		Level:  logLevel,
+		Output: os.Stdout,
+	})
+	if err != nil {
+		fatal(slog.Default(), "invalid log format", logging.Err(err))
+	}
+
+	log = logging.Service(log, "api-server")
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:     cfg.Tracing.Exporter,
+		File:         cfg.Tracing.File,
+		OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+		OTLPInsecure: cfg.Tracing.OTLPInsecure,
+		ServiceName:  "api-server",
+		SampleRatio:  cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		fatal(log, "failure to set up tracing", logging.Err(err))
+	}
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(ctx); err != nil {
+			log.Error("failure to flush spans", logging.Err(err))
+		}
+	}()
+
+	var masterKey []byte
+
+	if cfg.Objects.MasterKeyFile != "" {
+		key, err := encryption.LoadKey(cfg.Objects.MasterKeyFile)
+		if err != nil {
+			fatal(log, "failure to load master key", logging.Err(err))
+		}
+
+		masterKey = key
+	}
+
+	var presignSecret []byte
+
+	if cfg.Objects.PresignSecretFile != "" {
+		secret, err := encryption.LoadKey(cfg.Objects.PresignSecretFile)
+		if err != nil {
+			fatal(log, "failure to load presign secret", logging.Err(err))
+		}
+
+		presignSecret = secret
+	}
+
 	var (
-		address = flag.String(
-			"address", "0.0.0.0:9000", "TCP/IP address of storage-server")
-		maxChunkSizeBytes     = flag.Int("max-chunk-size-bytes", 10240, "chunk size")
-		erasureCodingFraction = flag.Int(
-			"erasure-coding-fraction", 5, "erasure coding fraction")
+		policy            *auth.Policy
+		authenticator     entrypoint.Authenticator
+		grpcAuthenticator entrypointGRPC.Authenticator
 	)
 
-	flag.Parse()
+	if cfg.Auth.File != "" {
+		p, err := auth.Load(cfg.Auth.File)
+		if err != nil {
+			fatal(log, "failure to load auth file", logging.Err(err))
+		}
+
+		policy, authenticator, grpcAuthenticator = p, p, p
+	}
+
+	var (
+		scheme     = "http"
+		httpClient = &http.Client{}
+		serverTLS  *tls.Config
+		clientTLS  *tls.Config
+	)
 
-	log := log.New(os.Stdout, "api", log.Lshortfile|log.Lmicroseconds)
+	if cfg.TLS.CertFile != "" {
+		clientAuth := tls.NoClientCert
+		if cfg.TLS.CAFile != "" {
+			// Clients of the API have no certificates, storage-servers do.
+			clientAuth = tls.VerifyClientCertIfGiven
+		}
+
+		source, err := tlsconfig.New(log, tlsconfig.Config{
+			CertFile:       cfg.TLS.CertFile,
+			KeyFile:        cfg.TLS.KeyFile,
+			CAFile:         cfg.TLS.CAFile,
+			ClientAuth:     clientAuth,
+			ReloadInterval: cfg.TLS.ReloadInterval,
+		})
+		if err != nil {
+			fatal(log, "failure to load tls config", logging.Err(err))
+		}
+
+		serverTLS, clientTLS = source.ServerConfig(), source.ClientConfig()
+
+		httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+		httpTransport.TLSClientConfig = clientTLS
+
+		scheme = "https"
+		httpClient = &http.Client{Transport: httpTransport}
+	}
+
+	grpcCreds := insecure.NewCredentials()
+	if clientTLS != nil {
+		grpcCreds = credentials.NewTLS(clientTLS)
+	}
+
+	grpcPool := storageServerClient.NewGRPCPool(log, grpc.WithTransportCredentials(grpcCreds))
+	defer grpcPool.Close()
+
+	tcpPool := storageServerClient.NewTCPPool(log, storageServerClient.TCPConfig{
+		TLS:             clientTLS,
+		ConnsPerAddress: cfg.TCP.ConnsPerAddress,
+		DialTimeout:     5 * time.Second,
+	})
+	defer tcpPool.Close()
 
+	var cache *chunkcache.Cache
+
+	if cfg.Cache.Enabled() {
+		c, err := chunkcache.New(chunkcache.Config{
+			MaxBytes:     cfg.Cache.Size,
+			Dir:          cfg.Cache.Dir,
+			MaxDiskBytes: cfg.Cache.DiskSize,
+		})
+		if err != nil {
+			fatal(log, "failure to create chunk cache", logging.Err(err))
+		}
+
+		cache = c
+	}
+
+	var (
+		registry   *prometheus.Registry
+		registerer prometheus.Registerer
+	)
+
+	if cfg.Metrics.Enabled {
+		registry = entrypoint.NewMetricsRegistry()
+		registerer = registry
+	}
+
+	resiliencePolicy := resilience.New(log, resilience.Config{
+		MaxAttempts:      cfg.Client.MaxAttempts,
+		BaseBackoff:      cfg.Client.Backoff,
+		MaxBackoff:       cfg.Client.MaxBackoff,
+		Timeout:          cfg.Client.Timeout,
+		RetryBudget:      cfg.Client.RetryBudget,
+		BreakerThreshold: cfg.Client.BreakerThreshold,
+		BreakerCooldown:  cfg.Client.BreakerCooldown,
+	})
+
+	// Closures called while the server runs read settings copied here, cfg
+	// is rewritten on SIGHUP.
+	transport := cfg.Transport
+
+	checker := health.New(log, health.Config{
+		Interval: cfg.Probe.Interval,
+		Timeout:  cfg.Probe.Timeout,
+		TTL:      cfg.Probe.TTL,
+	}, func(ctx context.Context, address string) error {
+		switch transport {
+		case "grpc":
+			return grpcPool.Client(address).Probe(ctx)
+		case "tcp":
+			return tcpPool.Client(address).Probe(ctx)
+		default:
+			return storageServerClient.New(log, scheme, address, httpClient).Probe(ctx)
+		}
+	})
+
+	// Chunks are placed only on storage-servers which answer probes and
+	// whose breaker is not open.
 	chunkManager := chunkmanager.New(log, chunkmanager.Config{
-		MaxChunkSizeBytes:     *maxChunkSizeBytes,
-		ErasureCodingFraction: *erasureCodingFraction,
+		MaxChunkSizeBytes:     cfg.ChunkManager.MaxChunkSizeBytes,
+		ErasureCodingFraction: cfg.ChunkManager.ErasureCodingFraction,
+		ReplicationFactor:     cfg.ChunkManager.ReplicationFactor,
+		Available: func(address string) bool {
+			return checker.Healthy(address) && resiliencePolicy.Available(address)
+		},
+		Registerer: registerer,
 	})
 
 	apiServer := apiserver.New(
 		log,
-		apiserver.Config{},
+		apiserver.Config{
+			HedgePercentile: cfg.Objects.HedgePercentile,
+			HedgeMinDelay:   cfg.Objects.HedgeMinDelay,
+			Compression:     cfg.Objects.Compression,
+			MasterKey:       masterKey,
+			MasterKeyFile:   cfg.Objects.MasterKeyFile,
+			Cache:           cache,
+			PresignSecret:   presignSecret,
+			UploadExpiry:    cfg.Objects.UploadExpiry,
+			Registerer:      registerer,
+		},
 		chunkManager,
 		func(address string) apiserver.StorageServer {
-			return storageServerClient.New(log, address, &http.Client{})
+			var client apiserver.StorageServer
+
+			switch transport {
+			case "grpc":
+				client = grpcPool.Client(address)
+			case "tcp":
+				client = tcpPool.Client(address)
+			default:
+				client = storageServerClient.New(log, scheme, address, httpClient)
+			}
+
+			return storageServerClient.NewResilient(client, address, resiliencePolicy)
 		},
 	)
 
 	server := entrypoint.New(
 		log,
 		entrypoint.Config{
-			Address: *address,
+			Address:           cfg.HTTP.Address,
+			Authenticator:     authenticator,
+			TLS:               serverTLS,
+			ReadTimeout:       cfg.HTTP.ReadTimeout,
+			ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+			WriteTimeout:      cfg.HTTP.WriteTimeout,
+			IdleTimeout:       cfg.HTTP.IdleTimeout,
+			MaxHeaderBytes:    cfg.HTTP.MaxHeaderBytes,
+			MiddlewareSwitch: entrypoint.MiddlewareSwitch{
+				CorrelationID: true,
+				Prometheus:    cfg.Metrics.Enabled,
+			},
+			Metrics: registry,
+			Routes:  handler.Routes,
+			// Objects can be written once their replicas can be placed.
+			Ready: chunkManager.Ready,
 		},
-		handler.New(log, apiServer, chunkManager),
+		handler.New(log, handler.Config{
+			Policy:             policy,
+			RegisterIdentities: cfg.TLS.RegisterIdentities,
+			Resilience:         resiliencePolicy,
+			LogLevel:           logLevel,
+		}, apiServer, chunkManager),
 	)
 
+	expireCtx, stopExpiring := context.WithCancel(context.Background())
+	defer stopExpiring()
+
+	go apiServer.ExpireUploads(expireCtx)
+
+	probeCtx, stopProbing := context.WithCancel(context.Background())
+	defer stopProbing()
+
+	go checker.Run(probeCtx, chunkManager.StorageServerAddresses)
+
 	errServer := server.Start()
 
+	var (
+		grpcServer    *entrypointGRPC.ServerGRPC
+		errGRPCServer chan error
+	)
+
+	if cfg.GRPC.Address != "" {
+		grpcServer = entrypointGRPC.New(
+			log,
+			entrypointGRPC.Config{
+				Address:       cfg.GRPC.Address,
+				Authenticator: grpcAuthenticator,
+				TLS:           serverTLS,
+			},
+			func(s *grpc.Server) {
+				pb.RegisterChunkManagerServer(s, grpcHandler.New(log, grpcHandler.Config{
+					Policy:             policy,
+					RegisterIdentities: cfg.TLS.RegisterIdentities,
+				}, chunkManager))
+			},
+		)
+
+		errGRPCServer = grpcServer.Start()
+	}
+
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGHUP)
+
+	// From here on cfg is read and written only by reload.
+	go func() {
+		for range reloadSignals {
+			reload(log, &cfg, *configFile, logLevel, cache)
+		}
+	}()
+
 	osSignals := make(chan os.Signal, 1)
 	signal.Notify(osSignals, os.Interrupt, syscall.SIGTERM)
 
 	select {
 	case err := <-errServer:
-		log.Printf("problem with TCP Server %s", err)
+		log.Error("problem with TCP Server", logging.Err(err))
+	case err := <-errGRPCServer:
+		log.Error("problem with gRPC Server", logging.Err(err))
 	case <-osSignals:
-		log.Print("shutdown the server")
+		log.Info("shutdown the server")
 
 		if err := server.Shutdown(context.Background()); err != nil {
-			log.Printf("ERROR: failure to shutdown TCP Server: %s", err)
+			log.Error("failure to shutdown TCP Server", logging.Err(err))
 		}
+
+		if grpcServer != nil {
+			if err := grpcServer.Shutdown(context.Background()); err != nil {
+				log.Error("failure to shutdown gRPC Server", logging.Err(err))
+			}
+		}
+	}
+
+}
+
+// reload loads the config again and applies the settings which may change
+// while the server runs, the log level is kept unless it is changed.
+func reload(
+	log *slog.Logger, cfg *config.APIServer, path string,
+	logLevel *slog.LevelVar, cache *chunkcache.Cache,
+) {
+	var next config.APIServer
+
+	if err := config.Load(&next, path, flag.CommandLine); err != nil {
+		log.Error("failure to reload config", logging.Err(err))
+		return
+	}
+
+	previousLevel := cfg.Log.Level
+
+	if restart := cfg.Reload(next); len(restart) > 0 {
+		log.Warn("changed settings take effect on restart", slog.Any("settings", restart))
+	}
+
+	if cfg.Log.Level != previousLevel {
+		// The level is validated by Load.
+		level, _ := logging.ParseLevel(cfg.Log.Level)
+		logLevel.Set(level)
 	}
 
+	cache.Resize(cfg.Cache.Size, cfg.Cache.DiskSize)
+
+	log.Info("config is reloaded")
+}
+
+// fatal logs the error and exits.
+func fatal(log *slog.Logger, msg string, args ...any) {
+	log.Error(msg, args...)
+	os.Exit(1)
 }
@@ -2,65 +2,348 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"simple-storage/internal/config"
 	"simple-storage/internal/endpoint/chunkmanager"
+	entrypointGRPC "simple-storage/internal/entrypoint/grpc"
+	"simple-storage/internal/entrypoint/grpc/pb"
+	grpcHandler "simple-storage/internal/entrypoint/grpc/storageserver"
 	entrypoint "simple-storage/internal/entrypoint/http"
 	handler "simple-storage/internal/entrypoint/http/storageserver"
+	entrypointTCP "simple-storage/internal/entrypoint/tcp"
+	tcpHandler "simple-storage/internal/entrypoint/tcp/storageserver"
+	"simple-storage/internal/logging"
+	"simple-storage/internal/resilience"
 	"simple-storage/internal/storageserver"
+	"simple-storage/internal/tlsconfig"
+	"simple-storage/internal/tracing"
+	"strings"
 	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func main() {
+	configFile := flag.String("config", os.Getenv(config.EnvConfigFile),
+		"YAML file with settings, environment variables and flags override them")
+	config.StorageServerFlags(flag.CommandLine)
+
+	flag.Parse()
+
+	var cfg config.StorageServer
+
+	if err := config.Load(&cfg, *configFile, flag.CommandLine); err != nil {
+		fatal(slog.Default(), "invalid config", logging.Err(err))
+	}
+
+	level, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		fatal(slog.Default(), "invalid log level", logging.Err(err))
+	}
+
+	// The level is changed on /admin/log-level while the server runs.
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(level)
+
+	log, err := logging.New(logging.Config{
+		Format: cfg.Log.Format,
+		Level:  logLevel,
+		Output: os.Stdout,
+	})
+	if err != nil {
+		fatal(slog.Default(), "invalid log format", logging.Err(err))
+	}
+
+	log = logging.Service(log, "storage-server")
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:     cfg.Tracing.Exporter,
+		File:         cfg.Tracing.File,
+		OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+		OTLPInsecure: cfg.Tracing.OTLPInsecure,
+		ServiceName:  "storage-server",
+		SampleRatio:  cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		fatal(log, "failure to set up tracing", logging.Err(err))
+	}
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(ctx); err != nil {
+			log.Error("failure to flush spans", logging.Err(err))
+		}
+	}()
+
+	// api-server sends chunks to the registered address.
+	registerAddress := cfg.HTTP.Address
+
+	if cfg.Transport == "tcp" {
+		registerAddress = cfg.TCP.Address
+	}
+
+	var clusterKey string
+
+	if cfg.ChunkManager.ClusterKeyFile != "" {
+		buf, err := os.ReadFile(cfg.ChunkManager.ClusterKeyFile)
+		if err != nil {
+			fatal(log, "failure to load cluster key", logging.Err(err))
+		}
+
+		clusterKey = strings.TrimSpace(string(buf))
+	}
+
 	var (
-		chunkManagerAddress = flag.String("chunk-manager", "0.0.0.0:9000",
-			"TCP/IP address of chunk-manager")
-		address = flag.String(
-			"address", "0.0.0.0:9001", "TCP/IP address of storage-server")
-		dataDirectory = flag.String(
-			"data-directory", "data", "directory with chunks")
-		timeBetweetRegistrationRetrySecond = flag.Int(
-			"registration-retry-timeout", 4, "how long should wait between unsuccesfull registraton")
+		scheme     = "http"
+		httpClient = &http.Client{}
+		serverTLS  *tls.Config
+		clientTLS  *tls.Config
 	)
 
-	flag.Parse()
+	if cfg.TLS.CertFile != "" {
+		clientAuth := tls.NoClientCert
+		if cfg.TLS.CAFile != "" {
+			clientAuth = tls.RequireAndVerifyClientCert
+		}
 
-	log := log.New(os.Stdout, "ss", log.Lshortfile|log.Lmicroseconds)
+		source, err := tlsconfig.New(log, tlsconfig.Config{
+			CertFile:       cfg.TLS.CertFile,
+			KeyFile:        cfg.TLS.KeyFile,
+			CAFile:         cfg.TLS.CAFile,
+			ClientAuth:     clientAuth,
+			ReloadInterval: cfg.TLS.ReloadInterval,
+		})
+		if err != nil {
+			fatal(log, "failure to load tls config", logging.Err(err))
+		}
 
-	chunkManagerClient := chunkmanager.New(
-		log, *chunkManagerAddress, &http.Client{})
+		serverTLS, clientTLS = source.ServerConfig(), source.ClientConfig()
 
-	storageServer := storageserver.New(log, storageserver.Config{
-		Address:                            *address,
-		DataDirectory:                      *dataDirectory,
-		TimeBetweetRegistrationRetrySecond: *timeBetweetRegistrationRetrySecond,
-	}, chunkManagerClient)
-
-	server := entrypoint.New(
-		log,
-		entrypoint.Config{
-			Address: *address,
-		},
-		handler.New(log, storageServer),
+		httpTransport := http.DefaultTransport.(*http.Transport).Clone()
+		httpTransport.TLSClientConfig = clientTLS
+
+		scheme = "https"
+		httpClient = &http.Client{Transport: httpTransport}
+	}
+
+	var chunkManagerClient storageserver.ChunkManager
+
+	if cfg.Transport == "grpc" {
+		creds := insecure.NewCredentials()
+		if clientTLS != nil {
+			creds = credentials.NewTLS(clientTLS)
+		}
+
+		conn, err := grpc.NewClient(cfg.ChunkManager.Address, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			fatal(log, "failure to connect chunk-manager", logging.Err(err))
+		}
+		defer conn.Close()
+
+		chunkManagerClient = chunkmanager.NewGRPC(log, conn, clusterKey)
+	} else {
+		chunkManagerClient = chunkmanager.New(
+			log, scheme, cfg.ChunkManager.Address, clusterKey, httpClient)
+	}
+
+	resiliencePolicy := resilience.New(log, resilience.Config{
+		MaxAttempts:      cfg.Client.MaxAttempts,
+		BaseBackoff:      cfg.Client.Backoff,
+		MaxBackoff:       cfg.Client.MaxBackoff,
+		Timeout:          cfg.Client.Timeout,
+		RetryBudget:      cfg.Client.RetryBudget,
+		BreakerThreshold: cfg.Client.BreakerThreshold,
+		BreakerCooldown:  cfg.Client.BreakerCooldown,
+	})
+
+	var (
+		registry   *prometheus.Registry
+		registerer prometheus.Registerer
 	)
 
+	if cfg.Metrics.Enabled {
+		registry = entrypoint.NewMetricsRegistry()
+		registerer = registry
+	}
+
+	storageServer := storageserver.New(log, storageserver.Config{
+		Address:                            registerAddress,
+		DataDirectory:                      cfg.Storage.DataDirectory,
+		TimeBetweetRegistrationRetrySecond: cfg.Storage.RegistrationRetryTimeout,
+		Registerer:                         registerer,
+	}, chunkmanager.NewResilient(chunkManagerClient, cfg.ChunkManager.Address, resiliencePolicy))
+
+	var server interface {
+		Start() chan error
+		Shutdown(ctx context.Context) error
+	}
+
+	if cfg.Transport == "grpc" {
+		server = entrypointGRPC.New(
+			log,
+			entrypointGRPC.Config{
+				Address: cfg.HTTP.Address,
+				TLS:     serverTLS,
+			},
+			func(s *grpc.Server) {
+				pb.RegisterStorageServerServer(s, grpcHandler.New(log, storageServer))
+				healthpb.RegisterHealthServer(s, grpcHandler.NewHealth(storageServer.Ready))
+			},
+		)
+	} else {
+		server = entrypoint.New(
+			log,
+			entrypoint.Config{
+				Address:           cfg.HTTP.Address,
+				TLS:               serverTLS,
+				ReadTimeout:       cfg.HTTP.ReadTimeout,
+				ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+				WriteTimeout:      cfg.HTTP.WriteTimeout,
+				IdleTimeout:       cfg.HTTP.IdleTimeout,
+				MaxHeaderBytes:    cfg.HTTP.MaxHeaderBytes,
+				MiddlewareSwitch: entrypoint.MiddlewareSwitch{
+					CorrelationID: true,
+					Prometheus:    cfg.Metrics.Enabled,
+				},
+				Metrics: registry,
+				Routes:  handler.Routes,
+				Ready:   storageServer.Ready,
+			},
+			handler.New(log, handler.Config{LogLevel: logLevel}, storageServer),
+		)
+	}
+
 	errServer := server.Start()
 
+	var metricsServer *entrypoint.ServerHTTP
+
+	if cfg.Transport == "grpc" && cfg.Metrics.Address != "" {
+		metricsHandler := entrypoint.NewHandler(log)
+
+		// The grpc transport has no HTTP API the log level and probes are
+		// served on.
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/", metricsHandler.HandleEmpty())
+		metricsMux.Handle(entrypoint.LogLevelPath, metricsHandler.HandleLogLevel(logLevel))
+
+		metricsServer = entrypoint.New(
+			log,
+			entrypoint.Config{
+				Address:          cfg.Metrics.Address,
+				MiddlewareSwitch: entrypoint.MiddlewareSwitch{Prometheus: cfg.Metrics.Enabled},
+				Metrics:          registry,
+				Ready:            storageServer.Ready,
+			},
+			metricsMux,
+		)
+
+		errMetricsServer := metricsServer.Start()
+
+		go func() {
+			errServer <- <-errMetricsServer
+		}()
+	}
+
+	var tcpServer *entrypointTCP.ServerTCP
+
+	if cfg.TCP.Address != "" {
+		tcpServer = entrypointTCP.New(
+			log,
+			entrypointTCP.Config{
+				Address:     cfg.TCP.Address,
+				TLS:         serverTLS,
+				IdleTimeout: cfg.TCP.IdleTimeout,
+			},
+			tcpHandler.New(log, cfg.TCP.MaxChunkSize, storageServer),
+		)
+
+		errTCPServer := tcpServer.Start()
+
+		go func() {
+			errServer <- <-errTCPServer
+		}()
+	}
+
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGHUP)
+
+	// From here on cfg is read and written only by reload, the servers got
+	// copies of their settings.
+	go func() {
+		for range reloadSignals {
+			reload(log, &cfg, *configFile, logLevel)
+		}
+	}()
+
 	osSignals := make(chan os.Signal, 1)
 	signal.Notify(osSignals, os.Interrupt, syscall.SIGTERM)
 
 	select {
 	case err := <-errServer:
-		log.Printf("problem with TCP Server %s", err)
+		log.Error("problem with TCP Server", logging.Err(err))
 	case <-osSignals:
-		log.Print("shutdown the server")
+		log.Info("shutdown the server")
 
 		if err := server.Shutdown(context.Background()); err != nil {
-			log.Printf("ERROR: failure to shutdown TCP Server: %s", err)
+			log.Error("failure to shutdown TCP Server", logging.Err(err))
+		}
+
+		if tcpServer != nil {
+			if err := tcpServer.Shutdown(context.Background()); err != nil {
+				log.Error("failure to shutdown TCP Server", logging.Err(err))
+			}
+		}
+
+		if metricsServer != nil {
+			if err := metricsServer.Shutdown(context.Background()); err != nil {
+				log.Error("failure to shutdown metrics Server", logging.Err(err))
+			}
 		}
 	}
 
 }
+
+// reload loads the config again and applies the settings which may change
+// while the server runs, the log level is kept unless it is changed.
+func reload(
+	log *slog.Logger, cfg *config.StorageServer, path string, logLevel *slog.LevelVar,
+) {
+	var next config.StorageServer
+
+	if err := config.Load(&next, path, flag.CommandLine); err != nil {
+		log.Error("failure to reload config", logging.Err(err))
+		return
+	}
+
+	previousLevel := cfg.Log.Level
+
+	if restart := cfg.Reload(next); len(restart) > 0 {
+		log.Warn("changed settings take effect on restart", slog.Any("settings", restart))
+	}
+
+	if cfg.Log.Level != previousLevel {
+		// The level is validated by Load.
+		level, _ := logging.ParseLevel(cfg.Log.Level)
+		logLevel.Set(level)
+	}
+
+	log.Info("config is reloaded")
+}
+
+// fatal logs the error and exits.
+func fatal(log *slog.Logger, msg string, args ...any) {
+	log.Error(msg, args...)
+	os.Exit(1)
+}
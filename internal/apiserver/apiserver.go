@@ -3,47 +3,144 @@ package apiserver
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"simple-storage/internal/chunkcache"
 	cm "simple-storage/internal/chunkmanager"
+	"simple-storage/internal/encryption"
+	"simple-storage/internal/logging"
+	"simple-storage/internal/tracing"
 	"simple-storage/internal/utils"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
-	ErrUploadCanceled   = errors.New("uploading has been canceled")
-	ErrDownloadCanceled = errors.New("downloading has been canceled")
+	ErrUploadCanceled     = errors.New("uploading has been canceled")
+	ErrDownloadCanceled   = errors.New("downloading has been canceled")
+	ErrChunkCorrupted     = errors.New("chunk is corrupted")
+	ErrContentMD5Mismatch = errors.New("content md5 mismatch")
+	ErrMetadataTooLarge   = errors.New("user metadata is too large")
 )
 
+// maxUserMetadataSize bounds the total size of keys and values of user
+// metadata of an object.
+const maxUserMetadataSize = 2048
+
 type ChunkManager interface {
-	SplitIntoChunks(filename string, size int64) ([]cm.Chunk, error)
-	ChunksInfo(filename string) ([]cm.Chunk, int64, error)
+	SplitIntoChunks(filename string, size int64, cond cm.Conditions) ([]cm.Chunk, error)
+	FileInfo(filename string) (cm.File, error)
+	NumberOfChunks(filesize int64) int
+	PlaceChunk() (cm.Chunk, error)
+	CommitFile(filename string, file cm.File, cond cm.Conditions) (cm.File, error)
+	ReleaseChunks(chunks []cm.Chunk)
+	DeleteFile(filename string, cond cm.Conditions) (cm.File, []cm.File, error)
+	DestroyFile(filename string) ([]cm.File, error)
+	UpdateFile(filename string, update func(file *cm.File) error) error
+	Filenames() []string
+	Versioning(bucket string) bool
+	StatFile(filename, versionID string, cond cm.Conditions) (cm.File, error)
+	Versions(filename string) ([]cm.File, error)
+	RestoreVersion(filename, versionID string) (cm.File, error)
 }
 
+// StorageServer transfers chunks of a storage server. Transfers are aborted
+// once ctx is done.
 type StorageServer interface {
-	UploadChunk(chunkID string, buf []byte) error
-	DownloadChunk(chunkID string, buf []byte) error
+	// UploadChunk stores size bytes read from r, the storage server keeps
+	// the chunk only if its content matches checksum.
+	UploadChunk(
+		ctx context.Context, chunkID string, checksum uint32, size int64, r io.Reader,
+	) error
+	// DownloadChunk writes the chunk to w.
+	DownloadChunk(ctx context.Context, chunkID string, w io.Writer) error
+	DeleteChunk(ctx context.Context, chunkID string) error
 }
 
 type APIServer struct {
-	log            *log.Logger
+	log            *slog.Logger
 	config         Config
 	cm             ChunkManager
 	storageServers storageServerKeeper
+	uploads        uploadKeeper
+	latencies      latencies
+	masterKeys     masterKeys
+	jobs           jobKeeper
+	metrics        metrics
+}
+
+type Config struct {
+	// HedgePercentile is the percentile of chunk download latency after which
+	// the same chunk is requested from another replica. Zero disables hedging.
+	HedgePercentile float64
+	// HedgeMinDelay is the lower bound of the hedging delay.
+	HedgeMinDelay time.Duration
+	// Compression is the codec of chunks uploaded without one requested.
+	Compression string
+	// MasterKey wraps data keys of objects. Objects uploaded without a
+	// customer key are stored in plaintext if it is empty.
+	MasterKey []byte
+	// MasterKeyFile is the file MasterKey has been loaded from, it is read
+	// again by RotateMasterKey. Empty disables rotation.
+	MasterKeyFile string
+	// Cache keeps downloaded chunks as they are stored, nil disables
+	// caching.
+	Cache *chunkcache.Cache
+	// PresignSecret signs urls granting access to one object without
+	// credentials. Empty disables url signing.
+	PresignSecret []byte
+	// UploadExpiry is how long a resumable upload is kept after it has
+	// been created or written, see ExpireUploads. Zero keeps uploads until
+	// they are completed or terminated.
+	UploadExpiry time.Duration
+	// Registerer receives metrics of failed transfers, they are not
+	// exported if it is nil.
+	Registerer prometheus.Registerer
+}
+
+// PutOptions declares optional parameters of an uploaded object.
+type PutOptions struct {
+	// ContentMD5 is the expected MD5 digest of the object content.
+	ContentMD5 []byte
+	// Compression is the codec of the object chunks, the server default if
+	// empty.
+	Compression string
+	// CustomerKey wraps the data key of the object instead of the master key.
+	CustomerKey []byte
+	// Metadata is kept with the object and returned to clients.
+	Metadata cm.Metadata
+	// Conditions are checked against the current version of the object
+	// atomically with committing the new one.
+	Conditions cm.Conditions
 }
 
-type Config struct{}
+// GetOptions declares optional parameters of a downloaded object.
+type GetOptions struct {
+	// CustomerKey is the key the object has been uploaded with.
+	CustomerKey []byte
+	// VersionID is the version of the object, the current one if empty.
+	VersionID string
+	// Conditions are checked against the requested version of the object.
+	Conditions cm.Conditions
+}
 
 type StorageServerClientCreatorFunc func(address string) StorageServer
 
 func New(
-	log *log.Logger, config Config,
+	log *slog.Logger, config Config,
 	chunkManager ChunkManager, ssClientCreator StorageServerClientCreatorFunc,
 ) *APIServer {
-	log = utils.LoggerExtendWithPrefix(log, "api-server ->")
+	log = logging.Component(log, "api-server")
 
-	return &APIServer{
+	s := &APIServer{
 		log:    log,
 		config: config,
 		cm:     chunkManager,
@@ -51,55 +148,195 @@ func New(
 			storageServers:                 map[string]StorageServer{},
 			storageServerClientCreatorFunc: ssClientCreator,
 		},
+		uploads: uploadKeeper{
+			uploads: map[string]*upload{},
+		},
+		masterKeys: masterKeys{
+			keys: map[string][]byte{},
+		},
+		jobs: jobKeeper{
+			jobs: map[string]*Job{},
+		},
+		metrics: newMetrics(config.Registerer),
 	}
+
+	if len(config.MasterKey) > 0 {
+		s.masterKeys.add(config.MasterKey)
+	}
+
+	return s
 }
 
 func (s *APIServer) PutObject(
 	ctx context.Context, filename string, r io.Reader, size int64,
-) error {
-	chunks, err := s.cm.SplitIntoChunks(filename, size)
+	opts PutOptions,
+) (cm.File, error) {
+	ctx, span := tracing.Start(ctx, "PutObject", trace.WithAttributes(
+		attrFilename.String(filename), attrBytes.Int64(size)))
+
+	file, err := s.putObject(ctx, filename, r, size, opts)
+	s.metrics.uploadFailed(err)
+	endSpan(span, err)
+
+	return file, err
+}
+
+func (s *APIServer) putObject(
+	ctx context.Context, filename string, r io.Reader, size int64,
+	opts PutOptions,
+) (cm.File, error) {
+	codec := opts.Compression
+	if codec == "" {
+		codec = s.config.Compression
+	}
+
+	if _, _, err := compress(codec, nil); err != nil {
+		return cm.File{}, err
+	}
+
+	if err := checkMetadata(opts.Metadata); err != nil {
+		return cm.File{}, err
+	}
+
+	file := cm.File{Size: size, Metadata: opts.Metadata}
+
+	dataKey, err := s.newDataKey(opts.CustomerKey)
 	if err != nil {
-		return fmt.Errorf("failure to split file into chunks: %w", err)
+		return cm.File{}, fmt.Errorf("failure to generate data key: %w", err)
+	}
+
+	chunks, err := s.cm.SplitIntoChunks(filename, size, opts.Conditions)
+	if err != nil {
+		return cm.File{}, fmt.Errorf("failure to split file into chunks: %w", err)
 	}
 
 	chunkSize := utils.ChunkSize(size, len(chunks))
 	buf := make([]byte, chunkSize)
+	restsize := int(size)
+	hash := md5.New()
 
-	for _, chunk := range chunks {
+	for i := range chunks {
 		select {
 		case <-ctx.Done():
-			return ErrUploadCanceled
+			s.abortPutObject(chunks, i)
+			return cm.File{}, ErrUploadCanceled
 		default:
 		}
 
-		ss := s.storageServers.get(chunk.StorageServer)
+		n, err := io.ReadFull(r, buf[:min(restsize, chunkSize)])
+		if err != nil {
+			s.abortPutObject(chunks, i)
+			return cm.File{}, fmt.Errorf(
+				"failure to read filename: %s: %w ", filename, err)
+		}
+
+		hash.Write(buf[:n])
 
-		n, err := r.Read(buf)
+		stored, err := encodeChunk(&chunks[i], codec, dataKey, buf[:n])
 		if err != nil {
-			return fmt.Errorf("failure to read filename: %s: %w ", filename, err)
+			s.abortPutObject(chunks, i)
+			return cm.File{}, fmt.Errorf(
+				"failure to encode filename: %s: %w ", filename, err)
 		}
 
-		err = ss.UploadChunk(chunk.ID, buf[:n])
+		err = s.uploadChunk(ctx, chunks[i], stored)
 		if err != nil {
-			return fmt.Errorf("failure to upload "+
-				"filename: %s chunk: %s storage-server: %s: %w ",
-				filename, chunk.ID, chunk.StorageServer, err)
+			s.abortPutObject(chunks, i+1)
+
+			if ctx.Err() != nil {
+				return cm.File{}, ErrUploadCanceled
+			}
+
+			return cm.File{}, fmt.Errorf("failure to upload "+
+				"filename: %s: %w ", filename, err)
 		}
+
+		restsize -= n
+	}
+
+	digest := hash.Sum(nil)
+
+	if opts.ContentMD5 != nil && !bytes.Equal(opts.ContentMD5, digest) {
+		s.abortPutObject(chunks, len(chunks))
+		return cm.File{}, ErrContentMD5Mismatch
+	}
+
+	file.Chunks = chunks
+	file.ETag = hex.EncodeToString(digest)
+
+	file, err = s.commitFile(
+		filename, file, dataKey, opts.CustomerKey, opts.Conditions)
+	if err != nil {
+		s.abortPutObject(chunks, len(chunks))
+		return cm.File{}, fmt.Errorf(
+			"failure to commit filename: %s: %w", filename, err)
+	}
+
+	return file, nil
+}
+
+func checkMetadata(metadata cm.Metadata) error {
+	size := 0
+
+	for key, value := range metadata.User {
+		size += len(key) + len(value)
+	}
+
+	if size > maxUserMetadataSize {
+		return ErrMetadataTooLarge
 	}
 
 	return nil
 }
 
+// abortPutObject releases the chunks of an unfinished upload and deletes the
+// first uploaded of them from storage servers.
+func (s *APIServer) abortPutObject(chunks []cm.Chunk, uploaded int) {
+	s.cm.ReleaseChunks(chunks[uploaded:])
+	s.discardChunks(chunks[:uploaded])
+}
+
+// StatObject returns information about a stored object in the version and
+// under the conditions of opts. The object is returned with
+// chunkmanager.ErrNotModified too.
+func (s *APIServer) StatObject(filename string, opts GetOptions) (cm.File, error) {
+	file, err := s.cm.StatFile(filename, opts.VersionID, opts.Conditions)
+	if err != nil {
+		return file, fmt.Errorf("failure to get file's info: %w", err)
+	}
+
+	return file, nil
+}
+
 func (s *APIServer) GetObject(
-	ctx context.Context, filename string, w io.Writer,
+	ctx context.Context, filename string, w io.Writer, opts GetOptions,
 ) error {
-	chunks, filesize, err := s.cm.ChunksInfo(filename)
+	ctx, span := tracing.Start(ctx, "GetObject",
+		trace.WithAttributes(attrFilename.String(filename)))
+
+	err := s.getObject(ctx, filename, w, opts)
+	s.metrics.downloadFailed(err)
+	endSpan(span, err)
+
+	return err
+}
+
+func (s *APIServer) getObject(
+	ctx context.Context, filename string, w io.Writer, opts GetOptions,
+) error {
+	file, err := s.cm.StatFile(filename, opts.VersionID, opts.Conditions)
 	if err != nil {
 		return fmt.Errorf("failure to get file's info: %w", err)
 	}
 
+	dataKey, err := s.dataKey(file, opts.CustomerKey)
+	if err != nil {
+		return fmt.Errorf("failure to get data key of filename: %s: %w", filename, err)
+	}
+
+	chunks, filesize := file.Chunks, file.Size
+
 	chunksize := utils.ChunkSize(filesize, len(chunks))
-	buf := make([]byte, chunksize)
 	restsize := int(filesize)
 
 	for _, chunk := range chunks {
@@ -109,21 +346,33 @@ func (s *APIServer) GetObject(
 		default:
 		}
 
-		ss := s.storageServers.get(chunk.StorageServer)
 		n := min(restsize, chunksize)
+		stored := n
+
+		if chunk.StoredSize > 0 {
+			stored = chunk.StoredSize
+		}
 
-		err := ss.DownloadChunk(chunk.ID, buf[:n])
+		buf, err := s.downloadChunk(ctx, chunk, stored)
 		if err != nil {
+			if errors.Is(err, ErrDownloadCanceled) {
+				return ErrDownloadCanceled
+			}
+
 			return fmt.Errorf("failure to download "+
-				"chunk: %s of filename: %s from storage-server: %s: %w",
-				filename, chunk.ID, chunk.StorageServer, err)
+				"chunk: %s of filename: %s: %w", chunk.ID, filename, err)
 		}
 
-		_, err = io.Copy(w, bytes.NewReader(buf[:n]))
+		buf, err = decodeChunk(chunk, dataKey, buf, n)
+		if err != nil {
+			return fmt.Errorf("failure to decode "+
+				"chunk: %s of filename: %s: %w", chunk.ID, filename, err)
+		}
+
+		_, err = io.Copy(w, bytes.NewReader(buf))
 		if err != nil {
 			return fmt.Errorf("failure to upload "+
-				"chunk: %s of filename: %s from storage-server: %s: %w",
-				filename, chunk.ID, chunk.StorageServer, err)
+				"chunk: %s of filename: %s: %w", chunk.ID, filename, err)
 		}
 
 		restsize -= n
@@ -131,3 +380,254 @@ func (s *APIServer) GetObject(
 
 	return nil
 }
+
+// encodeChunk compresses buf with codec, encrypts it with dataKey if it is
+// set and describes the stored data in chunk.
+func encodeChunk(
+	chunk *cm.Chunk, codec string, dataKey []byte, buf []byte,
+) ([]byte, error) {
+	stored, codec, err := compress(codec, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if dataKey != nil {
+		stored, err = encryption.Seal(dataKey, stored, []byte(chunk.ID))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chunk.Codec = codec
+	chunk.StoredSize = len(stored)
+	chunk.Checksum = utils.Checksum(stored)
+
+	return stored, nil
+}
+
+// decodeChunk restores a chunk of the given size from its stored data.
+func decodeChunk(
+	chunk cm.Chunk, dataKey []byte, stored []byte, size int,
+) ([]byte, error) {
+	var err error
+
+	if dataKey != nil {
+		stored, err = encryption.Open(dataKey, stored, []byte(chunk.ID))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return decompress(chunk.Codec, stored, size)
+}
+
+// uploadChunk uploads a chunk to every storage server keeping it, each
+// transfer in its own span.
+func (s *APIServer) uploadChunk(ctx context.Context, chunk cm.Chunk, buf []byte) error {
+	for _, address := range chunk.StorageServers() {
+		ss := s.storageServers.get(address)
+
+		ctx, span := tracing.Start(ctx, "UploadChunk", trace.WithAttributes(
+			attrChunkID.String(chunk.ID),
+			attrStorageServer.String(address),
+			attrBytes.Int(len(buf)),
+		))
+
+		err := ss.UploadChunk(
+			ctx, chunk.ID, chunk.Checksum, int64(len(buf)), bytes.NewReader(buf))
+		tracing.End(span, err)
+
+		if err != nil {
+			return &storageServerError{err: fmt.Errorf("failure to upload "+
+				"chunk: %s storage-server: %s: %w", chunk.ID, address, err)}
+		}
+	}
+
+	return nil
+}
+
+type downloadResult struct {
+	address string
+	buf     []byte
+	err     error
+}
+
+// downloadChunk returns a chunk of the given size from the cache or downloads
+// it. When a replica fails the next one is tried. When a replica is slower
+// than the hedging delay the next one is requested as well and the slower
+// request is canceled. Every request to a storage server has its own span.
+func (s *APIServer) downloadChunk(
+	ctx context.Context, chunk cm.Chunk, size int,
+) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "DownloadChunk", trace.WithAttributes(
+		attrChunkID.String(chunk.ID), attrBytes.Int(size)))
+	defer func() { tracing.End(span, err) }()
+
+	if buf, ok := s.config.Cache.Get(chunk.ID); ok {
+		if len(buf) == size && utils.Checksum(buf) == chunk.Checksum {
+			span.SetAttributes(attribute.Bool("cache_hit", true))
+
+			return buf, nil
+		}
+
+		s.log.ErrorContext(ctx, "cached chunk is corrupted", logging.ChunkID(chunk.ID))
+		s.config.Cache.Remove(chunk.ID)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		replicas = chunk.StorageServers()
+		results  = make(chan downloadResult, len(replicas))
+		next     = 0
+		inflight = 0
+		hedge    <-chan time.Time
+		errs     []string
+		lastErr  error
+	)
+
+	// A request reuses the buffer of a failed one, so that sequential
+	// attempts hold one chunk; only hedged requests allocate another.
+	request := func(buf []byte) {
+		if buf == nil {
+			buf = make([]byte, size)
+		}
+
+		address := replicas[next]
+		hedged := inflight > 0
+		next++
+		inflight++
+
+		go func() {
+			var (
+				ss    = s.storageServers.get(address)
+				w     = &chunkBuffer{buf: buf}
+				start = time.Now()
+			)
+
+			ctx, span := tracing.Start(ctx, "DownloadChunk replica", trace.WithAttributes(
+				attrChunkID.String(chunk.ID),
+				attrStorageServer.String(address),
+				attribute.Bool("hedged", hedged),
+			))
+
+			err := ss.DownloadChunk(ctx, chunk.ID, w)
+			if err == nil && w.n != size {
+				err = fmt.Errorf("%w: chunk is %d bytes, not %d",
+					ErrChunkCorrupted, w.n, size)
+			}
+
+			if err == nil && utils.Checksum(w.buf) != chunk.Checksum {
+				err = ErrChunkCorrupted
+			}
+
+			if err == nil {
+				s.latencies.add(time.Since(start))
+			}
+
+			// A request canceled because another replica has served the
+			// chunk has not failed.
+			if err != nil && ctx.Err() != nil {
+				span.SetAttributes(attribute.Bool("canceled", true))
+				tracing.End(span, nil)
+			} else {
+				span.SetAttributes(attrBytes.Int(w.n))
+				tracing.End(span, err)
+			}
+
+			results <- downloadResult{address: address, buf: w.buf, err: err}
+		}()
+	}
+
+	request(nil)
+
+	if delay, ok := s.hedgeDelay(); ok && next < len(replicas) {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		hedge = timer.C
+	}
+
+	for inflight > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ErrDownloadCanceled
+		case <-hedge:
+			hedge = nil
+
+			if next < len(replicas) {
+				s.log.DebugContext(ctx, "chunk download is hedged",
+					logging.ChunkID(chunk.ID), logging.StorageServer(replicas[next]))
+				request(nil)
+			}
+		case res := <-results:
+			inflight--
+
+			if res.err == nil {
+				s.log.DebugContext(ctx, "chunk is downloaded",
+					logging.ChunkID(chunk.ID), logging.StorageServer(res.address))
+				span.SetAttributes(attrStorageServer.String(res.address))
+
+				s.config.Cache.Add(chunk.ID, res.buf)
+
+				return res.buf, nil
+			}
+
+			s.log.ErrorContext(ctx, "failure to download chunk",
+				logging.ChunkID(chunk.ID), logging.StorageServer(res.address),
+				logging.Err(res.err))
+
+			errs = append(errs, fmt.Sprintf("storage-server: %s: %s", res.address, res.err))
+			lastErr = res.err
+
+			if next < len(replicas) {
+				request(res.buf)
+			}
+		}
+	}
+
+	return nil, &storageServerError{err: fmt.Errorf("all replicas failed [%s]: %w",
+		strings.Join(errs, "; "), lastErr)}
+}
+
+// chunkBuffer receives a downloaded chunk of a known size.
+type chunkBuffer struct {
+	buf []byte
+	n   int
+}
+
+func (b *chunkBuffer) Write(p []byte) (int, error) {
+	if len(p) > len(b.buf)-b.n {
+		return 0, fmt.Errorf("%w: chunk is larger than %d bytes",
+			ErrChunkCorrupted, len(b.buf))
+	}
+
+	b.n += copy(b.buf[b.n:], p)
+
+	return len(p), nil
+}
+
+// hedgeDelay returns how long to wait for a replica before requesting the
+// next one.
+func (s *APIServer) hedgeDelay() (time.Duration, bool) {
+	if s.config.HedgePercentile <= 0 {
+		return 0, false
+	}
+
+	delay, ok := s.latencies.percentile(s.config.HedgePercentile)
+	if !ok {
+		return 0, false
+	}
+
+	if delay < s.config.HedgeMinDelay {
+		delay = s.config.HedgeMinDelay
+	}
+
+	return delay, true
+}
+
+// CacheStats describes the usage of the chunk cache.
+func (s *APIServer) CacheStats() chunkcache.Stats {
+	return s.config.Cache.Stats()
+}
@@ -1,17 +1,40 @@
 package apiserver
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
 	"context"
-	"log"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"simple-storage/internal/chunkcache"
 	"simple-storage/internal/chunkmanager"
+	"simple-storage/internal/encryption"
+	"simple-storage/internal/utils"
 	"simple-storage/tests/mock"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestAPIServer_PutObject(t *testing.T) {
@@ -19,6 +42,7 @@ func TestAPIServer_PutObject(t *testing.T) {
 		filename string
 		chunks   []chunkmanager.Chunk
 		buf      string
+		etag     string
 	}{
 		{
 			filename: "file1",
@@ -26,7 +50,8 @@ func TestAPIServer_PutObject(t *testing.T) {
 				{ID: "id1", StorageServer: "0.0.0.0:9001"},
 				{ID: "id2", StorageServer: "0.0.0.0:9002"},
 			},
-			buf: "Hello World!",
+			buf:  "Hello World!",
+			etag: "ed076287532e86365e841e92bfc50d8c",
 		},
 	}
 
@@ -37,21 +62,30 @@ func TestAPIServer_PutObject(t *testing.T) {
 
 	for _, tc := range tt {
 		cm := mock.NewMockChunkManager(ctrl)
-		cm.EXPECT().SplitIntoChunks(tc.filename, int64(len(tc.buf))).
+		cm.EXPECT().SplitIntoChunks(tc.filename, int64(len(tc.buf)), gomock.Any()).
 			Return(tc.chunks, nil).Times(1)
 
+		cm.EXPECT().CommitFile(tc.filename, gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ string, file chunkmanager.File, _ chunkmanager.Conditions) (chunkmanager.File, error) {
+				return file, nil
+			},
+		).Times(1)
+
 		ssClientCreator := func(_ string) StorageServer {
 			ss := mock.NewMockStorageServer(ctrl)
-			ss.EXPECT().UploadChunk(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+			ss.EXPECT().UploadChunk(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(nil).Times(1)
 
 			return ss
 		}
 
-		apiserver := New(log.Default(), Config{}, cm, ssClientCreator)
+		apiserver := New(slog.Default(), Config{}, cm, ssClientCreator)
 
 		r := strings.NewReader(tc.buf)
-		err := apiserver.PutObject(ctx, tc.filename, r, int64(len(tc.buf)))
+		file, err := apiserver.PutObject(
+			ctx, tc.filename, r, int64(len(tc.buf)), PutOptions{})
 		require.NoError(t, err)
+		require.Equal(t, tc.etag, file.ETag)
 	}
 }
 
@@ -76,22 +110,25 @@ func TestAPIServer_PutObject_contextCancelation(t *testing.T) {
 
 	for _, tc := range tt {
 		cm := mock.NewMockChunkManager(ctrl)
-		cm.EXPECT().SplitIntoChunks(tc.filename, int64(len(tc.buf))).
+		cm.EXPECT().SplitIntoChunks(tc.filename, int64(len(tc.buf)), gomock.Any()).
 			Return(tc.chunks, nil).Times(1)
 
+		cm.EXPECT().ReleaseChunks(gomock.Any()).Times(2)
+
 		ssClientCreator := func(_ string) StorageServer {
 			ss := mock.NewMockStorageServer(ctrl)
-			ss.EXPECT().UploadChunk(gomock.Any(), gomock.Any()).DoAndReturn(
-				func(id string, buf []byte) error {
+			ss.EXPECT().UploadChunk(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, id string, _ uint32, _ int64, _ io.Reader) error {
 					time.Sleep(100 * time.Millisecond)
 					return nil
 				},
 			).Times(1)
+			ss.EXPECT().DeleteChunk(gomock.Any(), gomock.Any()).Return(nil).Times(1)
 
 			return ss
 		}
 
-		apiserver := New(log.Default(), Config{}, cm, ssClientCreator)
+		apiserver := New(slog.Default(), Config{}, cm, ssClientCreator)
 
 		ctx, cancel := context.WithCancel(context.Background())
 		r := strings.NewReader(tc.buf)
@@ -101,7 +138,8 @@ func TestAPIServer_PutObject_contextCancelation(t *testing.T) {
 			cancel()
 		}()
 
-		err := apiserver.PutObject(ctx, tc.filename, r, int64(len(tc.buf)))
+		_, err := apiserver.PutObject(
+			ctx, tc.filename, r, int64(len(tc.buf)), PutOptions{})
 		require.Equal(t, err, ErrUploadCanceled)
 	}
 }
@@ -118,8 +156,16 @@ func TestAPIServer_GetObject(t *testing.T) {
 			filename: "file1",
 			filesize: 12,
 			chunks: []chunkmanager.Chunk{
-				{ID: "chunkID1", StorageServer: "0.0.0.0:9001"},
-				{ID: "chunkID2", StorageServer: "0.0.0.0:9002"},
+				{
+					ID:            "chunkID1",
+					StorageServer: "0.0.0.0:9001",
+					Checksum:      utils.Checksum([]byte("Hello ")),
+				},
+				{
+					ID:            "chunkID2",
+					StorageServer: "0.0.0.0:9002",
+					Checksum:      utils.Checksum([]byte("World!")),
+				},
 			},
 			ssResponce: map[string][]byte{
 				"chunkID1": []byte("Hello "),
@@ -136,16 +182,16 @@ func TestAPIServer_GetObject(t *testing.T) {
 
 	for _, tc := range tt {
 		cm := mock.NewMockChunkManager(ctrl)
-		cm.EXPECT().ChunksInfo(tc.filename).
-			Return(tc.chunks, tc.filesize, nil).Times(1)
+		cm.EXPECT().StatFile(tc.filename, "", gomock.Any()).
+			Return(chunkmanager.File{Chunks: tc.chunks, Size: tc.filesize}, nil).Times(1)
 
 		ssClientCreator := func(_ string) StorageServer {
 			ss := mock.NewMockStorageServer(ctrl)
-			ss.EXPECT().DownloadChunk(gomock.Any(), gomock.Any()).
+			ss.EXPECT().DownloadChunk(gomock.Any(), gomock.Any(), gomock.Any()).
 				DoAndReturn(
-					func(id string, buf []byte) error {
+					func(_ context.Context, id string, w io.Writer) error {
 						res := tc.ssResponce[id]
-						copy(buf, res)
+						w.Write(res)
 						return nil
 					},
 				).Times(1)
@@ -153,16 +199,98 @@ func TestAPIServer_GetObject(t *testing.T) {
 			return ss
 		}
 
-		apiserver := New(log.Default(), Config{}, cm, ssClientCreator)
+		apiserver := New(slog.Default(), Config{}, cm, ssClientCreator)
 
 		buf := new(bytes.Buffer)
 
-		err := apiserver.GetObject(ctx, tc.filename, buf)
+		err := apiserver.GetObject(ctx, tc.filename, buf, GetOptions{})
 		require.NoError(t, err)
 		require.Equal(t, buf.String(), tc.result)
 	}
 }
 
+func TestAPIServer_GetObject_cache(t *testing.T) {
+	tt := []struct {
+		filename   string
+		filesize   int64
+		chunks     []chunkmanager.Chunk
+		ssResponce map[string][]byte
+		result     string
+	}{
+		{
+			filename: "file1",
+			filesize: 12,
+			chunks: []chunkmanager.Chunk{
+				{
+					ID:            "chunkID1",
+					StorageServer: "0.0.0.0:9001",
+					Checksum:      utils.Checksum([]byte("Hello ")),
+				},
+				{
+					ID:            "chunkID2",
+					StorageServer: "0.0.0.0:9001",
+					Checksum:      utils.Checksum([]byte("World!")),
+				},
+			},
+			ssResponce: map[string][]byte{
+				"chunkID1": []byte("Hello "),
+				"chunkID2": []byte("World!"),
+			},
+			result: "Hello World!",
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	for _, tc := range tt {
+		cache, err := chunkcache.New(chunkcache.Config{MaxBytes: 1 << 10})
+		require.NoError(t, err)
+
+		cm := mock.NewMockChunkManager(ctrl)
+		cm.EXPECT().StatFile(tc.filename, "", gomock.Any()).
+			Return(chunkmanager.File{Chunks: tc.chunks, Size: tc.filesize}, nil).Times(3)
+
+		ssClientCreator := func(_ string) StorageServer {
+			ss := mock.NewMockStorageServer(ctrl)
+			ss.EXPECT().DownloadChunk(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(
+					func(_ context.Context, id string, w io.Writer) error {
+						w.Write(tc.ssResponce[id])
+						return nil
+					},
+				).Times(len(tc.chunks) + 1)
+			ss.EXPECT().DeleteChunk(gomock.Any(), tc.chunks[0].ID).Return(nil).Times(1)
+
+			return ss
+		}
+
+		apiserver := New(slog.Default(), Config{Cache: cache}, cm, ssClientCreator)
+
+		// The second download is served from the cache.
+		for i := 0; i < 2; i++ {
+			buf := new(bytes.Buffer)
+
+			err = apiserver.GetObject(ctx, tc.filename, buf, GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tc.result, buf.String())
+		}
+
+		require.Equal(t, int64(len(tc.chunks)), apiserver.CacheStats().Hits)
+
+		// A deleted chunk is downloaded again.
+		require.NoError(t, apiserver.deleteChunk(ctx, tc.chunks[0]))
+
+		buf := new(bytes.Buffer)
+
+		err = apiserver.GetObject(ctx, tc.filename, buf, GetOptions{})
+		require.NoError(t, err)
+		require.Equal(t, tc.result, buf.String())
+	}
+}
+
 func TestAPIServer_GetObject_contextCancelation(t *testing.T) {
 	tt := []struct {
 		filename   string
@@ -175,8 +303,16 @@ func TestAPIServer_GetObject_contextCancelation(t *testing.T) {
 			filename: "file1",
 			filesize: 12,
 			chunks: []chunkmanager.Chunk{
-				{ID: "chunkID1", StorageServer: "0.0.0.0:9001"},
-				{ID: "chunkID2", StorageServer: "0.0.0.0:9002"},
+				{
+					ID:            "chunkID1",
+					StorageServer: "0.0.0.0:9001",
+					Checksum:      utils.Checksum([]byte("Hello ")),
+				},
+				{
+					ID:            "chunkID2",
+					StorageServer: "0.0.0.0:9002",
+					Checksum:      utils.Checksum([]byte("World!")),
+				},
 			},
 			ssResponce: map[string][]byte{
 				"chunkID1": []byte("Hello "),
@@ -191,15 +327,16 @@ func TestAPIServer_GetObject_contextCancelation(t *testing.T) {
 
 	for _, tc := range tt {
 		cm := mock.NewMockChunkManager(ctrl)
-		cm.EXPECT().ChunksInfo(tc.filename).
-			Return(tc.chunks, tc.filesize, nil).Times(1)
+		cm.EXPECT().StatFile(tc.filename, "", gomock.Any()).
+			Return(chunkmanager.File{Chunks: tc.chunks, Size: tc.filesize}, nil).Times(1)
 
 		ssClientCreator := func(_ string) StorageServer {
 			ss := mock.NewMockStorageServer(ctrl)
-			ss.EXPECT().DownloadChunk(gomock.Any(), gomock.Any()).
+			ss.EXPECT().DownloadChunk(gomock.Any(), gomock.Any(), gomock.Any()).
 				DoAndReturn(
-					func(_ string, _ []byte) error {
+					func(_ context.Context, id string, w io.Writer) error {
 						time.Sleep(100 * time.Millisecond)
+						w.Write(tc.ssResponce[id])
 						return nil
 					},
 				).Times(1)
@@ -207,7 +344,7 @@ func TestAPIServer_GetObject_contextCancelation(t *testing.T) {
 			return ss
 		}
 
-		apiserver := New(log.Default(), Config{}, cm, ssClientCreator)
+		apiserver := New(slog.Default(), Config{}, cm, ssClientCreator)
 
 		ctx, cancel := context.WithCancel(context.Background())
 		buf := new(bytes.Buffer)
@@ -217,7 +354,1300 @@ func TestAPIServer_GetObject_contextCancelation(t *testing.T) {
 			cancel()
 		}()
 
-		err := apiserver.GetObject(ctx, tc.filename, buf)
+		err := apiserver.GetObject(ctx, tc.filename, buf, GetOptions{})
 		require.Equal(t, err, ErrDownloadCanceled)
 	}
 }
+
+func TestAPIServer_WriteUpload_resumeAfterDisconnect(t *testing.T) {
+	tt := []struct {
+		filename string
+		chunks   []chunkmanager.Chunk
+		buf      string
+		received int
+		result   map[string]string
+	}{
+		{
+			filename: "file1",
+			chunks: []chunkmanager.Chunk{
+				{ID: "id1", StorageServer: "0.0.0.0:9001"},
+				{ID: "id2", StorageServer: "0.0.0.0:9002"},
+			},
+			buf:      "Hello World!",
+			received: 7,
+			result: map[string]string{
+				"id1": "Hello ",
+				"id2": "World!",
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	for _, tc := range tt {
+		size := int64(len(tc.buf))
+
+		cm := mock.NewMockChunkManager(ctrl)
+		cm.EXPECT().FileInfo(tc.filename).
+			Return(chunkmanager.File{}, chunkmanager.ErrNotFound).Times(1)
+		cm.EXPECT().NumberOfChunks(size).Return(len(tc.chunks)).Times(1)
+		for _, chunk := range tc.chunks {
+			cm.EXPECT().PlaceChunk().Return(chunk, nil).Times(1)
+		}
+		cm.EXPECT().CommitFile(tc.filename, gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ string, file chunkmanager.File, _ chunkmanager.Conditions) (chunkmanager.File, error) {
+				return file, nil
+			},
+		).Times(1)
+
+		uploaded := map[string]string{}
+
+		ssClientCreator := func(_ string) StorageServer {
+			ss := mock.NewMockStorageServer(ctrl)
+			ss.EXPECT().UploadChunk(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, id string, _ uint32, _ int64, r io.Reader) error {
+					buf, _ := io.ReadAll(r)
+					uploaded[id] = string(buf)
+					return nil
+				},
+			).Times(1)
+
+			return ss
+		}
+
+		apiserver := New(slog.Default(), Config{}, cm, ssClientCreator)
+
+		id, err := apiserver.CreateUpload(tc.filename, size, chunkmanager.Metadata{}, "")
+		require.NoError(t, err)
+
+		disconnected := io.MultiReader(
+			strings.NewReader(tc.buf[:tc.received]),
+			iotest.ErrReader(errors.New("connection reset by peer")),
+		)
+
+		offset, err := apiserver.WriteUpload(ctx, id, 0, size, disconnected)
+		require.Error(t, err)
+		require.Equal(t, int64(tc.received), offset)
+
+		_, err = apiserver.WriteUpload(ctx, id, 0, size, strings.NewReader(tc.buf))
+		require.ErrorIs(t, err, ErrUploadOffsetMismatch)
+
+		offset, _, err = apiserver.UploadStatus(id)
+		require.NoError(t, err)
+		require.Equal(t, int64(tc.received), offset)
+
+		_, err = apiserver.WriteUpload(
+			ctx, id, offset, size-offset+1, strings.NewReader(tc.buf[offset:]+"!"))
+		require.ErrorIs(t, err, ErrUploadTooLarge)
+
+		offset, _, err = apiserver.UploadStatus(id)
+		require.NoError(t, err)
+		require.Equal(t, int64(tc.received), offset)
+
+		offset, err = apiserver.WriteUpload(
+			ctx, id, offset, size-offset, strings.NewReader(tc.buf[offset:]))
+		require.NoError(t, err)
+		require.Equal(t, size, offset)
+		require.Equal(t, tc.result, uploaded)
+
+		_, _, err = apiserver.UploadStatus(id)
+		require.ErrorIs(t, err, ErrUploadNotFound)
+	}
+}
+
+func TestAPIServer_expireUploads(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	chunk := chunkmanager.Chunk{ID: "id1", StorageServer: "0.0.0.0:9001"}
+
+	cm := mock.NewMockChunkManager(ctrl)
+	cm.EXPECT().FileInfo("file1").
+		Return(chunkmanager.File{}, chunkmanager.ErrNotFound).Times(1)
+	cm.EXPECT().NumberOfChunks(int64(12)).Return(2).Times(1)
+	cm.EXPECT().PlaceChunk().Return(chunk, nil).Times(1)
+	cm.EXPECT().ReleaseChunks(gomock.Len(1)).Times(1)
+
+	ssClientCreator := func(_ string) StorageServer {
+		ss := mock.NewMockStorageServer(ctrl)
+		ss.EXPECT().UploadChunk(gomock.Any(), "id1", gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(nil).Times(1)
+		ss.EXPECT().DeleteChunk(gomock.Any(), "id1").Return(nil).Times(1)
+
+		return ss
+	}
+
+	apiserver := New(slog.Default(), Config{UploadExpiry: time.Hour}, cm, ssClientCreator)
+
+	id, err := apiserver.CreateUpload("file1", 12, chunkmanager.Metadata{}, "")
+	require.NoError(t, err)
+
+	offset, err := apiserver.WriteUpload(context.Background(), id, 0, 6, strings.NewReader("Hello "))
+	require.NoError(t, err)
+	require.Equal(t, int64(6), offset)
+
+	expires, err := apiserver.UploadExpires(id)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(time.Hour), expires, time.Minute)
+
+	apiserver.expireUploads(time.Now())
+
+	_, _, err = apiserver.UploadStatus(id)
+	require.NoError(t, err)
+
+	apiserver.expireUploads(expires.Add(time.Second))
+
+	_, _, err = apiserver.UploadStatus(id)
+	require.ErrorIs(t, err, ErrUploadNotFound)
+
+	_, err = apiserver.WriteUpload(context.Background(), id, 6, 6, strings.NewReader("World!"))
+	require.ErrorIs(t, err, ErrUploadNotFound)
+}
+
+func TestAPIServer_GetObject_corruptedChunk(t *testing.T) {
+	tt := []struct {
+		filename   string
+		filesize   int64
+		chunks     []chunkmanager.Chunk
+		ssResponce map[string][]byte
+	}{
+		{
+			filename: "file1",
+			filesize: 6,
+			chunks: []chunkmanager.Chunk{
+				{
+					ID:            "chunkID1",
+					StorageServer: "0.0.0.0:9001",
+					Checksum:      utils.Checksum([]byte("Hello ")),
+				},
+			},
+			ssResponce: map[string][]byte{
+				"chunkID1": []byte("Hallo "),
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	for _, tc := range tt {
+		cm := mock.NewMockChunkManager(ctrl)
+		cm.EXPECT().StatFile(tc.filename, "", gomock.Any()).
+			Return(chunkmanager.File{Chunks: tc.chunks, Size: tc.filesize}, nil).Times(1)
+
+		ssClientCreator := func(_ string) StorageServer {
+			ss := mock.NewMockStorageServer(ctrl)
+			ss.EXPECT().DownloadChunk(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(
+					func(_ context.Context, id string, w io.Writer) error {
+						w.Write(tc.ssResponce[id])
+						return nil
+					},
+				).Times(1)
+
+			return ss
+		}
+
+		apiserver := New(slog.Default(), Config{}, cm, ssClientCreator)
+
+		err := apiserver.GetObject(ctx, tc.filename, new(bytes.Buffer), GetOptions{})
+		require.ErrorIs(t, err, ErrChunkCorrupted)
+	}
+}
+
+func TestAPIServer_GetObject_replicaFailover(t *testing.T) {
+	tt := []struct {
+		filename   string
+		filesize   int64
+		chunks     []chunkmanager.Chunk
+		ssResponce map[string][]byte
+		ssErr      map[string]error
+		result     string
+	}{
+		{
+			filename: "file1",
+			filesize: 6,
+			chunks: []chunkmanager.Chunk{
+				{
+					ID:            "chunkID1",
+					StorageServer: "0.0.0.0:9001",
+					Replicas:      []string{"0.0.0.0:9002"},
+					Checksum:      utils.Checksum([]byte("Hello ")),
+				},
+			},
+			ssResponce: map[string][]byte{
+				"0.0.0.0:9001": []byte("Hallo "),
+				"0.0.0.0:9002": []byte("Hello "),
+			},
+			result: "Hello ",
+		},
+		{
+			filename: "file1",
+			filesize: 6,
+			chunks: []chunkmanager.Chunk{
+				{
+					ID:            "chunkID1",
+					StorageServer: "0.0.0.0:9001",
+					Replicas:      []string{"0.0.0.0:9002"},
+					Checksum:      utils.Checksum([]byte("Hello ")),
+				},
+			},
+			ssResponce: map[string][]byte{
+				"0.0.0.0:9002": []byte("Hello "),
+			},
+			ssErr: map[string]error{
+				"0.0.0.0:9001": errors.New("connection refused"),
+			},
+			result: "Hello ",
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	for _, tc := range tt {
+		cm := mock.NewMockChunkManager(ctrl)
+		cm.EXPECT().StatFile(tc.filename, "", gomock.Any()).
+			Return(chunkmanager.File{Chunks: tc.chunks, Size: tc.filesize}, nil).Times(1)
+
+		ssClientCreator := func(address string) StorageServer {
+			ss := mock.NewMockStorageServer(ctrl)
+			ss.EXPECT().DownloadChunk(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(
+					func(_ context.Context, _ string, w io.Writer) error {
+						w.Write(tc.ssResponce[address])
+						return tc.ssErr[address]
+					},
+				).Times(1)
+
+			return ss
+		}
+
+		apiserver := New(slog.Default(), Config{}, cm, ssClientCreator)
+
+		buf := new(bytes.Buffer)
+
+		err := apiserver.GetObject(ctx, tc.filename, buf, GetOptions{})
+		require.NoError(t, err)
+		require.Equal(t, tc.result, buf.String())
+	}
+}
+
+func TestAPIServer_GetObject_hedgedRead(t *testing.T) {
+	tt := []struct {
+		filename string
+		filesize int64
+		chunks   []chunkmanager.Chunk
+		slow     string
+		result   string
+	}{
+		{
+			filename: "file1",
+			filesize: 6,
+			chunks: []chunkmanager.Chunk{
+				{
+					ID:            "chunkID1",
+					StorageServer: "0.0.0.0:9001",
+					Replicas:      []string{"0.0.0.0:9002"},
+					Checksum:      utils.Checksum([]byte("Hello ")),
+				},
+			},
+			slow:   "0.0.0.0:9001",
+			result: "Hello ",
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	for _, tc := range tt {
+		cm := mock.NewMockChunkManager(ctrl)
+		cm.EXPECT().StatFile(tc.filename, "", gomock.Any()).
+			Return(chunkmanager.File{Chunks: tc.chunks, Size: tc.filesize}, nil).Times(1)
+
+		canceled := make(chan struct{})
+
+		ssClientCreator := func(address string) StorageServer {
+			ss := mock.NewMockStorageServer(ctrl)
+			ss.EXPECT().DownloadChunk(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(
+					func(ctx context.Context, _ string, w io.Writer) error {
+						if address == tc.slow {
+							<-ctx.Done()
+							close(canceled)
+							return ctx.Err()
+						}
+
+						io.WriteString(w, tc.result)
+						return nil
+					},
+				).Times(1)
+
+			return ss
+		}
+
+		apiserver := New(slog.Default(), Config{
+			HedgePercentile: 50,
+			HedgeMinDelay:   10 * time.Millisecond,
+		}, cm, ssClientCreator)
+
+		for i := 0; i < latencyMinSamples; i++ {
+			apiserver.latencies.add(time.Millisecond)
+		}
+
+		buf := new(bytes.Buffer)
+
+		err := apiserver.GetObject(ctx, tc.filename, buf, GetOptions{})
+		require.NoError(t, err)
+		require.Equal(t, tc.result, buf.String())
+
+		select {
+		case <-canceled:
+		case <-time.After(time.Second):
+			t.Fatal("slow replica request has not been canceled")
+		}
+	}
+}
+
+func TestAPIServer_PutObject_compression(t *testing.T) {
+	incompressible := make([]byte, 1024)
+	rand.New(rand.NewSource(1)).Read(incompressible)
+
+	tt := []struct {
+		filename    string
+		chunks      []chunkmanager.Chunk
+		buf         string
+		compression string
+		codec       string
+	}{
+		{
+			filename: "file1",
+			chunks: []chunkmanager.Chunk{
+				{ID: "id1", StorageServer: "0.0.0.0:9001"},
+				{ID: "id2", StorageServer: "0.0.0.0:9002"},
+			},
+			buf:         strings.Repeat("Hello World!", 100),
+			compression: CodecZstd,
+			codec:       CodecZstd,
+		},
+		{
+			filename: "file1",
+			chunks: []chunkmanager.Chunk{
+				{ID: "id1", StorageServer: "0.0.0.0:9001"},
+			},
+			buf:         strings.Repeat("Hello World!", 100),
+			compression: CodecGzip,
+			codec:       CodecGzip,
+		},
+		{
+			filename: "file1",
+			chunks: []chunkmanager.Chunk{
+				{ID: "id1", StorageServer: "0.0.0.0:9001"},
+			},
+			buf:         string(incompressible),
+			compression: CodecZstd,
+			codec:       "",
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	for _, tc := range tt {
+		var (
+			size      = int64(len(tc.buf))
+			stored    = map[string][]byte{}
+			committed chunkmanager.File
+		)
+
+		cm := mock.NewMockChunkManager(ctrl)
+		cm.EXPECT().SplitIntoChunks(tc.filename, size, gomock.Any()).
+			Return(append([]chunkmanager.Chunk(nil), tc.chunks...), nil).Times(1)
+		cm.EXPECT().CommitFile(tc.filename, gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ string, file chunkmanager.File, _ chunkmanager.Conditions) (chunkmanager.File, error) {
+				committed = file
+				return file, nil
+			},
+		).Times(1)
+
+		ssClientCreator := func(_ string) StorageServer {
+			ss := mock.NewMockStorageServer(ctrl)
+			ss.EXPECT().UploadChunk(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, id string, _ uint32, _ int64, r io.Reader) error {
+					buf, _ := io.ReadAll(r)
+					stored[id] = append([]byte(nil), buf...)
+					return nil
+				},
+			).Times(1)
+			ss.EXPECT().DownloadChunk(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, id string, w io.Writer) error {
+					w.Write(stored[id])
+					return nil
+				},
+			).Times(1)
+
+			return ss
+		}
+
+		apiserver := New(slog.Default(), Config{}, cm, ssClientCreator)
+
+		_, err := apiserver.PutObject(ctx, tc.filename,
+			strings.NewReader(tc.buf), size, PutOptions{Compression: tc.compression})
+		require.NoError(t, err)
+
+		for _, chunk := range committed.Chunks {
+			require.Equal(t, tc.codec, chunk.Codec)
+			require.Equal(t, len(stored[chunk.ID]), chunk.StoredSize)
+		}
+
+		cm.EXPECT().StatFile(tc.filename, "", gomock.Any()).
+			Return(committed, nil).Times(1)
+
+		buf := new(bytes.Buffer)
+
+		err = apiserver.GetObject(ctx, tc.filename, buf, GetOptions{})
+		require.NoError(t, err)
+		require.Equal(t, tc.buf, buf.String())
+	}
+}
+
+func TestAPIServer_PutObject_encryption(t *testing.T) {
+	var (
+		masterKey   = bytes.Repeat([]byte{1}, encryption.KeySize)
+		customerKey = bytes.Repeat([]byte{2}, encryption.KeySize)
+		otherKey    = bytes.Repeat([]byte{3}, encryption.KeySize)
+	)
+
+	tt := []struct {
+		filename       string
+		chunks         []chunkmanager.Chunk
+		buf            string
+		putCustomerKey []byte
+		getCustomerKey []byte
+		err            error
+	}{
+		{
+			filename: "file1",
+			chunks: []chunkmanager.Chunk{
+				{ID: "id1", StorageServer: "0.0.0.0:9001"},
+				{ID: "id2", StorageServer: "0.0.0.0:9002"},
+			},
+			buf: "Hello World!",
+		},
+		{
+			filename: "file1",
+			chunks: []chunkmanager.Chunk{
+				{ID: "id1", StorageServer: "0.0.0.0:9001"},
+			},
+			buf:            "Hello World!",
+			putCustomerKey: customerKey,
+			getCustomerKey: customerKey,
+		},
+		{
+			filename: "file1",
+			chunks: []chunkmanager.Chunk{
+				{ID: "id1", StorageServer: "0.0.0.0:9001"},
+			},
+			buf:            "Hello World!",
+			putCustomerKey: customerKey,
+			getCustomerKey: otherKey,
+			err:            ErrCustomerKeyMismatch,
+		},
+		{
+			filename: "file1",
+			chunks: []chunkmanager.Chunk{
+				{ID: "id1", StorageServer: "0.0.0.0:9001"},
+			},
+			buf:            "Hello World!",
+			putCustomerKey: customerKey,
+			err:            ErrCustomerKeyRequired,
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	for _, tc := range tt {
+		var (
+			size      = int64(len(tc.buf))
+			stored    = map[string][]byte{}
+			committed chunkmanager.File
+		)
+
+		cm := mock.NewMockChunkManager(ctrl)
+		cm.EXPECT().SplitIntoChunks(tc.filename, size, gomock.Any()).
+			Return(append([]chunkmanager.Chunk(nil), tc.chunks...), nil).Times(1)
+		cm.EXPECT().CommitFile(tc.filename, gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ string, file chunkmanager.File, _ chunkmanager.Conditions) (chunkmanager.File, error) {
+				committed = file
+				return file, nil
+			},
+		).Times(1)
+
+		ssClientCreator := func(_ string) StorageServer {
+			ss := mock.NewMockStorageServer(ctrl)
+			ss.EXPECT().UploadChunk(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, id string, _ uint32, _ int64, r io.Reader) error {
+					buf, _ := io.ReadAll(r)
+					stored[id] = append([]byte(nil), buf...)
+					return nil
+				},
+			).Times(1)
+			ss.EXPECT().DownloadChunk(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, id string, w io.Writer) error {
+					w.Write(stored[id])
+					return nil
+				},
+			).AnyTimes()
+
+			return ss
+		}
+
+		apiserver := New(slog.Default(), Config{MasterKey: masterKey}, cm, ssClientCreator)
+
+		_, err := apiserver.PutObject(ctx, tc.filename,
+			strings.NewReader(tc.buf), size, PutOptions{CustomerKey: tc.putCustomerKey})
+		require.NoError(t, err)
+		require.NotNil(t, committed.WrappedKey)
+
+		for _, chunk := range committed.Chunks {
+			require.NotContains(t, string(stored[chunk.ID]), tc.buf[:5])
+		}
+
+		cm.EXPECT().StatFile(tc.filename, "", gomock.Any()).Return(committed, nil).Times(1)
+
+		buf := new(bytes.Buffer)
+
+		err = apiserver.GetObject(ctx, tc.filename, buf,
+			GetOptions{CustomerKey: tc.getCustomerKey})
+		require.ErrorIs(t, err, tc.err)
+
+		if tc.err == nil {
+			require.Equal(t, tc.buf, buf.String())
+		}
+	}
+}
+
+func TestAPIServer_RotateMasterKey(t *testing.T) {
+	var (
+		oldKey      = bytes.Repeat([]byte{1}, encryption.KeySize)
+		newKey      = bytes.Repeat([]byte{2}, encryption.KeySize)
+		customerKey = bytes.Repeat([]byte{3}, encryption.KeySize)
+		dataKey     = bytes.Repeat([]byte{4}, encryption.KeySize)
+	)
+
+	wrap := func(key []byte) []byte {
+		wrapped, err := encryption.Seal(key, dataKey, nil)
+		require.NoError(t, err)
+
+		return wrapped
+	}
+
+	tt := []struct {
+		files map[string]chunkmanager.File
+		keyID map[string]string
+	}{
+		{
+			files: map[string]chunkmanager.File{
+				"file1": {
+					WrappedKey:  wrap(oldKey),
+					MasterKeyID: encryption.KeyID(oldKey),
+				},
+				"file2": {
+					WrappedKey:     wrap(customerKey),
+					CustomerKeyMD5: CustomerKeyMD5(customerKey),
+				},
+				"file3": {},
+			},
+			keyID: map[string]string{
+				"file1": encryption.KeyID(newKey),
+				"file2": "",
+				"file3": "",
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range tt {
+		var filenames []string
+		for filename := range tc.files {
+			filenames = append(filenames, filename)
+		}
+
+		cm := mock.NewMockChunkManager(ctrl)
+		cm.EXPECT().Filenames().Return(filenames).Times(1)
+		cm.EXPECT().UpdateFile(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(filename string, update func(file *chunkmanager.File) error) error {
+				file := tc.files[filename]
+
+				if err := update(&file); err != nil {
+					return err
+				}
+
+				tc.files[filename] = file
+
+				return nil
+			},
+		).Times(len(tc.files))
+
+		keyFile := filepath.Join(t.TempDir(), "master.key")
+		err := os.WriteFile(keyFile, oldKey, 0o600)
+		require.NoError(t, err)
+
+		apiserver := New(slog.Default(),
+			Config{MasterKey: oldKey, MasterKeyFile: keyFile}, cm, nil)
+
+		_, err = apiserver.RotateMasterKey()
+		require.ErrorIs(t, err, ErrSameMasterKey)
+
+		// The new key replaces the old one in the configured file.
+		err = os.WriteFile(keyFile, newKey, 0o600)
+		require.NoError(t, err)
+
+		jobID, err := apiserver.RotateMasterKey()
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			job, err := apiserver.Job(jobID)
+			return err == nil && job.State == JobDone && job.Processed == len(tc.files)
+		}, time.Second, 10*time.Millisecond)
+
+		for filename, file := range tc.files {
+			require.Equal(t, tc.keyID[filename], file.MasterKeyID)
+		}
+
+		key, err := apiserver.dataKey(tc.files["file1"], nil)
+		require.NoError(t, err)
+		require.Equal(t, dataKey, key)
+
+		_, err = apiserver.RotateMasterKey()
+		require.ErrorIs(t, err, ErrSameMasterKey)
+
+		require.Len(t, apiserver.masterKeys.keys, 1)
+	}
+
+	apiserver := New(slog.Default(), Config{MasterKey: oldKey}, nil, nil)
+
+	_, err := apiserver.RotateMasterKey()
+	require.ErrorIs(t, err, ErrNoMasterKeyFile)
+}
+
+func TestAPIServer_ShredObject(t *testing.T) {
+	tt := []struct {
+		filename string
+		file     chunkmanager.File
+	}{
+		{
+			filename: "file1",
+			file: chunkmanager.File{
+				Chunks: []chunkmanager.Chunk{
+					{ID: "id1", StorageServer: "0.0.0.0:9001", Replicas: []string{"0.0.0.0:9002"}},
+					{ID: "id2", StorageServer: "0.0.0.0:9002", Replicas: []string{"0.0.0.0:9001"}},
+				},
+				WrappedKey: []byte("wrapped"),
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range tt {
+		cm := mock.NewMockChunkManager(ctrl)
+		cm.EXPECT().DestroyFile(tc.filename).
+			Return([]chunkmanager.File{tc.file}, nil).Times(1)
+
+		ssClientCreator := func(_ string) StorageServer {
+			ss := mock.NewMockStorageServer(ctrl)
+			ss.EXPECT().DeleteChunk(gomock.Any(), gomock.Any()).Return(nil).Times(len(tc.file.Chunks))
+
+			return ss
+		}
+
+		apiserver := New(slog.Default(), Config{}, cm, ssClientCreator)
+
+		jobID, err := apiserver.ShredObject(tc.filename)
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			job, err := apiserver.Job(jobID)
+			return err == nil && job.State == JobDone &&
+				job.Processed == len(tc.file.Chunks)
+		}, time.Second, 10*time.Millisecond)
+	}
+}
+
+func TestAPIServer_DeleteObject(t *testing.T) {
+	tt := []struct {
+		filename string
+		marker   chunkmanager.File
+		removed  []chunkmanager.File
+		deleted  int
+	}{
+		{
+			filename: "photos/cat.png",
+			marker:   chunkmanager.File{VersionID: "v3", DeleteMarker: true},
+		},
+		{
+			filename: "file1",
+			removed: []chunkmanager.File{
+				{Chunks: []chunkmanager.Chunk{
+					{ID: "id1", StorageServer: "0.0.0.0:9001", Replicas: []string{"0.0.0.0:9002"}},
+				}},
+				{Chunks: []chunkmanager.Chunk{
+					{ID: "id2", StorageServer: "0.0.0.0:9002"},
+				}},
+			},
+			deleted: 3,
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	for _, tc := range tt {
+		cm := mock.NewMockChunkManager(ctrl)
+		cm.EXPECT().DeleteFile(tc.filename, gomock.Any()).
+			Return(tc.marker, tc.removed, nil).Times(1)
+
+		var deleted atomic.Int32
+
+		ssClientCreator := func(_ string) StorageServer {
+			ss := mock.NewMockStorageServer(ctrl)
+			ss.EXPECT().DeleteChunk(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ string) error {
+				deleted.Add(1)
+				return nil
+			}).AnyTimes()
+
+			return ss
+		}
+
+		apiserver := New(slog.Default(), Config{}, cm, ssClientCreator)
+
+		marker, err := apiserver.DeleteObject(tc.filename, chunkmanager.Conditions{})
+		require.NoError(t, err)
+		require.Equal(t, tc.marker, marker)
+
+		require.Eventually(t, func() bool {
+			return int(deleted.Load()) == tc.deleted
+		}, time.Second, 10*time.Millisecond)
+	}
+}
+
+func TestAPIServer_PutObject_metadata(t *testing.T) {
+	tt := []struct {
+		filename string
+		chunks   []chunkmanager.Chunk
+		buf      string
+		metadata chunkmanager.Metadata
+		err      error
+	}{
+		{
+			filename: "file1.html",
+			chunks: []chunkmanager.Chunk{
+				{ID: "id1", StorageServer: "0.0.0.0:9001"},
+			},
+			buf: "<p>Hello World!</p>",
+			metadata: chunkmanager.Metadata{
+				ContentType:        "text/html",
+				ContentDisposition: `attachment; filename="file1.html"`,
+				CacheControl:       "max-age=3600",
+				User:               map[string]string{"Owner": "Max"},
+			},
+		},
+		{
+			filename: "file1.html",
+			buf:      "<p>Hello World!</p>",
+			metadata: chunkmanager.Metadata{
+				User: map[string]string{"Owner": strings.Repeat("x", maxUserMetadataSize)},
+			},
+			err: ErrMetadataTooLarge,
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	for _, tc := range tt {
+		var (
+			size      = int64(len(tc.buf))
+			committed chunkmanager.File
+		)
+
+		cm := mock.NewMockChunkManager(ctrl)
+
+		if tc.err == nil {
+			cm.EXPECT().SplitIntoChunks(tc.filename, size, gomock.Any()).
+				Return(tc.chunks, nil).Times(1)
+			cm.EXPECT().CommitFile(tc.filename, gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ string, file chunkmanager.File, _ chunkmanager.Conditions) (chunkmanager.File, error) {
+					committed = file
+					return file, nil
+				},
+			).Times(1)
+		}
+
+		ssClientCreator := func(_ string) StorageServer {
+			ss := mock.NewMockStorageServer(ctrl)
+			ss.EXPECT().UploadChunk(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(nil).Times(1)
+
+			return ss
+		}
+
+		apiserver := New(slog.Default(), Config{}, cm, ssClientCreator)
+
+		_, err := apiserver.PutObject(ctx, tc.filename,
+			strings.NewReader(tc.buf), size, PutOptions{Metadata: tc.metadata})
+		require.ErrorIs(t, err, tc.err)
+
+		if tc.err == nil {
+			require.Equal(t, tc.metadata, committed.Metadata)
+		}
+	}
+}
+
+func TestAPIServer_ArchiveObjects(t *testing.T) {
+	files := map[string]chunkmanager.File{
+		"a.txt": {
+			Chunks: []chunkmanager.Chunk{{
+				ID:            "chunkID1",
+				StorageServer: "0.0.0.0:9001",
+				Checksum:      utils.Checksum([]byte("Hello ")),
+			}},
+			Size:      6,
+			VersionID: "v1",
+		},
+		"logs/b.txt": {
+			Chunks: []chunkmanager.Chunk{{
+				ID:            "chunkID2",
+				StorageServer: "0.0.0.0:9001",
+				Checksum:      utils.Checksum([]byte("World!")),
+			}},
+			Size:      6,
+			VersionID: "v2",
+		},
+		"secret.txt": {CustomerKeyMD5: "md5", VersionID: "v3"},
+		// The second chunk of broken.txt cannot be read.
+		"broken.txt": {
+			Chunks: []chunkmanager.Chunk{
+				{
+					ID:            "chunkID1",
+					StorageServer: "0.0.0.0:9001",
+					Checksum:      utils.Checksum([]byte("Hello ")),
+				},
+				{ID: "chunkID3", StorageServer: "0.0.0.0:9001"},
+			},
+			Size:      12,
+			VersionID: "v4",
+		},
+		ArchiveManifest: {VersionID: "v5"},
+		"/a.txt":        {VersionID: "v6"},
+	}
+	ssResponce := map[string][]byte{
+		"chunkID1": []byte("Hello "),
+		"chunkID2": []byte("World!"),
+	}
+	filenames := []string{
+		"a.txt", "missing.txt", "logs/b.txt", "secret.txt",
+		ArchiveManifest, "/", "/a.txt", "a.txt",
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	for _, format := range []string{ArchiveTar, ArchiveZip} {
+		cm := mock.NewMockChunkManager(ctrl)
+		cm.EXPECT().StatFile(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(filename, _ string, _ chunkmanager.Conditions) (chunkmanager.File, error) {
+				file, ok := files[filename]
+				if !ok {
+					return chunkmanager.File{}, chunkmanager.ErrNotFound
+				}
+
+				return file, nil
+			},
+		).AnyTimes()
+
+		ssClientCreator := func(_ string) StorageServer {
+			ss := mock.NewMockStorageServer(ctrl)
+			ss.EXPECT().DownloadChunk(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+				func(_ context.Context, id string, w io.Writer) error {
+					buf, ok := ssResponce[id]
+					if !ok {
+						return os.ErrNotExist
+					}
+
+					w.Write(buf)
+					return nil
+				},
+			).AnyTimes()
+
+			return ss
+		}
+
+		apiserver := New(slog.Default(), Config{}, cm, ssClientCreator)
+
+		buf := new(bytes.Buffer)
+
+		err := apiserver.ArchiveObjects(ctx, buf, format, filenames)
+		require.NoError(t, err)
+
+		entries := map[string]string{}
+
+		if format == ArchiveTar {
+			r := tar.NewReader(buf)
+
+			for {
+				header, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+
+				content, err := io.ReadAll(r)
+				require.NoError(t, err)
+
+				entries[header.Name] = string(content)
+			}
+		} else {
+			r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			require.NoError(t, err)
+
+			for _, f := range r.File {
+				rc, err := f.Open()
+				require.NoError(t, err)
+
+				content, err := io.ReadAll(rc)
+				require.NoError(t, err)
+
+				entries[f.Name] = string(content)
+			}
+		}
+
+		require.Len(t, entries, 3)
+		require.Equal(t, "Hello ", entries["a.txt"])
+		require.Equal(t, "World!", entries["logs/b.txt"])
+
+		manifest := Manifest{}
+		require.NoError(t, json.Unmarshal([]byte(entries[ArchiveManifest]), &manifest))
+		require.Len(t, manifest.Objects, 2)
+
+		missing := []string{}
+		for _, m := range manifest.Missing {
+			missing = append(missing, m.Name)
+		}
+
+		require.Equal(t, []string{
+			"missing.txt", "secret.txt", ArchiveManifest, "/", "/a.txt",
+		}, missing)
+		require.Contains(t, manifest.Missing[2].Error, ErrReservedEntryName.Error())
+		require.Contains(t, manifest.Missing[3].Error, ErrInvalidEntryName.Error())
+		require.Contains(t, manifest.Missing[4].Error, ErrDuplicateEntryName.Error())
+
+		// An object failing after its entry has been started aborts the
+		// archive.
+		err = apiserver.ArchiveObjects(ctx, io.Discard, format, []string{"a.txt", "broken.txt"})
+		require.ErrorContains(t, err, "broken.txt")
+	}
+
+	err := New(slog.Default(), Config{}, nil, nil).
+		ArchiveObjects(ctx, io.Discard, "rar", filenames)
+	require.ErrorIs(t, err, ErrUnknownArchiveFormat)
+}
+
+func TestAPIServer_ImportArchive(t *testing.T) {
+	type entry struct {
+		name     string
+		typeflag byte
+		content  string
+	}
+
+	tt := []struct {
+		entries []entry
+		results []ImportResult
+	}{
+		{
+			entries: []entry{
+				{name: "data/", typeflag: tar.TypeDir},
+				{name: "./data/a.json", typeflag: tar.TypeReg, content: "Hello"},
+				{name: "data/link", typeflag: tar.TypeSymlink},
+				{name: "data/exists.txt", typeflag: tar.TypeReg, content: "World!"},
+				{name: "../empty.txt", typeflag: tar.TypeReg},
+				{name: "private/b.txt", typeflag: tar.TypeReg, content: "!"},
+			},
+			results: []ImportResult{
+				{Name: "data/a.json", Size: 5, ETag: "8b1a9953c4611296a827abf8c47804d7"},
+				{Name: "data/link", Error: "entry data/link is not a regular file"},
+				{Name: "data/exists.txt", Size: 6, Error: "failure to split file into chunks: " +
+					chunkmanager.ErrAlreadyExist.Error()},
+				{Name: "empty.txt", ETag: "d41d8cd98f00b204e9800998ecf8427e"},
+				{Name: "private/b.txt", Size: 1, Error: "access denied"},
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	for _, tc := range tt {
+		buf := new(bytes.Buffer)
+		tw := tar.NewWriter(buf)
+
+		for _, e := range tc.entries {
+			err := tw.WriteHeader(&tar.Header{
+				Name:     e.name,
+				Typeflag: e.typeflag,
+				Size:     int64(len(e.content)),
+				Mode:     0o644,
+			})
+			require.NoError(t, err)
+
+			_, err = tw.Write([]byte(e.content))
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, tw.Close())
+
+		committed := map[string]chunkmanager.File{}
+
+		cm := mock.NewMockChunkManager(ctrl)
+		cm.EXPECT().SplitIntoChunks(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(filename string, size int64, _ chunkmanager.Conditions) ([]chunkmanager.Chunk, error) {
+				if filename == "data/exists.txt" {
+					return nil, chunkmanager.ErrAlreadyExist
+				}
+
+				if size == 0 {
+					return nil, nil
+				}
+
+				return []chunkmanager.Chunk{{ID: filename, StorageServer: "0.0.0.0:9001"}}, nil
+			},
+		).Times(3)
+		cm.EXPECT().CommitFile(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+			func(filename string, file chunkmanager.File, _ chunkmanager.Conditions) (chunkmanager.File, error) {
+				committed[filename] = file
+				return file, nil
+			},
+		).Times(2)
+
+		ssClientCreator := func(_ string) StorageServer {
+			ss := mock.NewMockStorageServer(ctrl)
+			ss.EXPECT().UploadChunk(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(nil).Times(1)
+
+			return ss
+		}
+
+		apiserver := New(slog.Default(), Config{}, cm, ssClientCreator)
+
+		allow := func(name string) error {
+			if strings.HasPrefix(name, "private/") {
+				return errors.New("access denied")
+			}
+
+			return nil
+		}
+
+		results, err := apiserver.ImportArchive(ctx, buf, PutOptions{}, allow)
+		require.NoError(t, err)
+		require.Equal(t, tc.results, results)
+
+		require.Equal(t, "application/json", committed["data/a.json"].Metadata.ContentType)
+	}
+}
+
+func TestAPIServer_PresignURL(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	apiserver := New(slog.Default(), Config{PresignSecret: secret}, nil, nil)
+
+	query, err := apiserver.PresignURL(http.MethodPut, "file1", time.Minute, 100)
+	require.NoError(t, err)
+	require.True(t, apiserver.Presigned(query))
+
+	maxLength, err := apiserver.VerifyURL(http.MethodPut, "file1", query)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), maxLength)
+
+	// The url is bound to the method, the object and the limit.
+	_, err = apiserver.VerifyURL(http.MethodGet, "file1", query)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = apiserver.VerifyURL(http.MethodPut, "file2", query)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	tampered := url.Values{}
+	for key, values := range query {
+		tampered[key] = values
+	}
+	tampered.Set(PresignMaxLengthParam, "1000")
+
+	_, err = apiserver.VerifyURL(http.MethodPut, "file1", tampered)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	expired := url.Values{}
+	expires := time.Now().Add(-time.Second).Unix()
+	expired.Set(PresignExpiresParam, strconv.FormatInt(expires, 10))
+	expired.Set(PresignSignatureParam,
+		apiserver.presignSignature(http.MethodGet, "file1", expires, 0))
+
+	_, err = apiserver.VerifyURL(http.MethodGet, "file1", expired)
+	require.ErrorIs(t, err, ErrSignatureExpired)
+
+	_, err = apiserver.PresignURL(http.MethodDelete, "file1", time.Minute, 0)
+	require.ErrorIs(t, err, ErrUnsignedMethod)
+
+	_, err = New(slog.Default(), Config{}, nil, nil).
+		PresignURL(http.MethodGet, "file1", time.Minute, 0)
+	require.ErrorIs(t, err, ErrPresignDisabled)
+}
+
+func TestAPIServer_GetObject_failureMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+
+	chunk := chunkmanager.Chunk{
+		ID:            "chunkID1",
+		StorageServer: "0.0.0.0:9001",
+		Checksum:      utils.Checksum([]byte("Hello ")),
+	}
+
+	cm := mock.NewMockChunkManager(ctrl)
+	cm.EXPECT().StatFile("missing", "", gomock.Any()).
+		Return(chunkmanager.File{}, chunkmanager.ErrNotFound).Times(1)
+	cm.EXPECT().StatFile("file1", "", gomock.Any()).
+		Return(chunkmanager.File{Chunks: []chunkmanager.Chunk{chunk}, Size: 6}, nil).Times(1)
+	cm.EXPECT().StatFile("file2", "", gomock.Any()).
+		Return(chunkmanager.File{}, chunkmanager.ErrNotModified).Times(1)
+
+	ssClientCreator := func(_ string) StorageServer {
+		ss := mock.NewMockStorageServer(ctrl)
+		ss.EXPECT().DownloadChunk(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(errors.New("connection refused")).Times(1)
+
+		return ss
+	}
+
+	registry := prometheus.NewRegistry()
+
+	apiserver := New(slog.Default(), Config{Registerer: registry}, cm, ssClientCreator)
+
+	err := apiserver.GetObject(ctx, "missing", io.Discard, GetOptions{})
+	require.ErrorIs(t, err, chunkmanager.ErrNotFound)
+
+	err = apiserver.GetObject(ctx, "file1", io.Discard, GetOptions{})
+	require.Error(t, err)
+
+	// A not modified object is not a failure.
+	err = apiserver.GetObject(ctx, "file2", io.Discard, GetOptions{})
+	require.ErrorIs(t, err, chunkmanager.ErrNotModified)
+
+	failures := apiserver.metrics.downloadFailures
+	require.Equal(t, 1.0, testutil.ToFloat64(failures.WithLabelValues("not_found")))
+	require.Equal(t, 1.0, testutil.ToFloat64(failures.WithLabelValues("storage_server")))
+	require.Equal(t, 2, testutil.CollectAndCount(failures))
+}
+
+func TestAPIServer_GetObject_spans(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	recorder := tracetest.NewSpanRecorder()
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	defer otel.SetTracerProvider(previous)
+
+	chunk := chunkmanager.Chunk{
+		ID:            "chunkID1",
+		StorageServer: "0.0.0.0:9001",
+		Replicas:      []string{"0.0.0.0:9002"},
+		Checksum:      utils.Checksum([]byte("Hello ")),
+	}
+
+	cm := mock.NewMockChunkManager(ctrl)
+	cm.EXPECT().StatFile("file1", "", gomock.Any()).
+		Return(chunkmanager.File{Chunks: []chunkmanager.Chunk{chunk}, Size: 6}, nil).Times(1)
+
+	ssClientCreator := func(address string) StorageServer {
+		ss := mock.NewMockStorageServer(ctrl)
+
+		if address == chunk.StorageServer {
+			ss.EXPECT().DownloadChunk(gomock.Any(), chunk.ID, gomock.Any()).
+				Return(errors.New("connection refused")).Times(1)
+
+			return ss
+		}
+
+		ss.EXPECT().DownloadChunk(gomock.Any(), chunk.ID, gomock.Any()).
+			DoAndReturn(func(ctx context.Context, _ string, w io.Writer) error {
+				// Clients propagate the span of the transfer.
+				require.True(t, trace.SpanContextFromContext(ctx).IsValid())
+
+				_, err := w.Write([]byte("Hello "))
+				return err
+			}).Times(1)
+
+		return ss
+	}
+
+	apiserver := New(slog.Default(), Config{}, cm, ssClientCreator)
+
+	err := apiserver.GetObject(context.Background(), "file1", io.Discard, GetOptions{})
+	require.NoError(t, err)
+
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+
+	require.Len(t, spans["GetObject"], 1)
+	require.Len(t, spans["DownloadChunk"], 1)
+	require.Len(t, spans["DownloadChunk replica"], 2)
+
+	traceID := spans["GetObject"][0].SpanContext().TraceID()
+
+	for _, span := range recorder.Ended() {
+		require.Equal(t, traceID, span.SpanContext().TraceID())
+	}
+
+	require.Contains(t, spans["DownloadChunk"][0].Attributes(),
+		attrStorageServer.String("0.0.0.0:9002"))
+
+	for _, span := range spans["DownloadChunk replica"] {
+		require.Equal(t, spans["DownloadChunk"][0].SpanContext().SpanID(), span.Parent().SpanID())
+
+		if span.Status().Code == codes.Error {
+			require.Contains(t, span.Attributes(), attrStorageServer.String("0.0.0.0:9001"))
+		} else {
+			require.Contains(t, span.Attributes(), attrStorageServer.String("0.0.0.0:9002"))
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package apiserver
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	cm "simple-storage/internal/chunkmanager"
+	"time"
+)
+
+var (
+	ErrUnknownArchiveFormat = errors.New("unknown archive format")
+	ErrInvalidEntryName     = errors.New("object name is not a valid archive entry name")
+	ErrReservedEntryName    = errors.New("archive entry name is reserved for the manifest")
+	ErrDuplicateEntryName   = errors.New("archive entry name is taken by another object")
+)
+
+const (
+	ArchiveTar = "tar"
+	ArchiveZip = "zip"
+)
+
+// ArchiveManifest is the name of the archive entry describing which objects
+// have been archived and which have been skipped. An object with this name is
+// skipped.
+const ArchiveManifest = ".manifest.json"
+
+// Manifest describes the content of an archive.
+type Manifest struct {
+	Objects []ManifestObject  `json:"objects"`
+	Missing []ManifestMissing `json:"missing"`
+}
+
+type ManifestObject struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	ETag      string `json:"etag"`
+	VersionID string `json:"version_id"`
+}
+
+type ManifestMissing struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// ArchiveObjects streams current versions of objects to w as a tar or zip
+// archive, one entry per object followed by the manifest entry. Objects that
+// cannot be read, or whose names are not valid distinct entry names, are
+// reported in the manifest instead. Objects are streamed into their entries,
+// the size of an entry is taken from the stored object, so a failure to read
+// an object after its entry has been started aborts the archive rather than
+// leaving a truncated entry.
+func (s *APIServer) ArchiveObjects(
+	ctx context.Context, w io.Writer, format string, filenames []string,
+) error {
+	var archive archiveWriter
+
+	switch format {
+	case ArchiveTar:
+		archive = tarArchive{tar.NewWriter(w)}
+	case ArchiveZip:
+		archive = zipArchive{zip.NewWriter(w)}
+	default:
+		return fmt.Errorf("format: %s: %w", format, ErrUnknownArchiveFormat)
+	}
+
+	manifest := Manifest{
+		Objects: []ManifestObject{},
+		Missing: []ManifestMissing{},
+	}
+	seen := map[string]struct{}{}
+	// entries are names of archived entries.
+	entries := map[string]struct{}{}
+
+	for _, filename := range filenames {
+		if _, ok := seen[filename]; ok {
+			continue
+		}
+
+		seen[filename] = struct{}{}
+		name := cleanPath(filename)
+
+		file, err := s.archiveObject(ctx, archive, name, filename, entries)
+		if errors.Is(err, ErrDownloadCanceled) {
+			return ErrDownloadCanceled
+		}
+
+		var entryErr *entryError
+		if errors.As(err, &entryErr) {
+			return fmt.Errorf("failure to archive filename: %s: %w", filename, entryErr.err)
+		}
+
+		if err != nil {
+			manifest.Missing = append(manifest.Missing, ManifestMissing{
+				Name:  filename,
+				Error: err.Error(),
+			})
+
+			continue
+		}
+
+		entries[name] = struct{}{}
+
+		manifest.Objects = append(manifest.Objects, ManifestObject{
+			Name:      filename,
+			Size:      file.Size,
+			ETag:      file.ETag,
+			VersionID: file.VersionID,
+		})
+	}
+
+	buf, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failure to marshal manifest: %w", err)
+	}
+
+	entry, err := archive.create(ArchiveManifest, cm.File{
+		Size:    int64(len(buf)),
+		Created: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failure to archive manifest: %w", err)
+	}
+
+	if _, err := entry.Write(buf); err != nil {
+		return fmt.Errorf("failure to archive manifest: %w", err)
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failure to close archive: %w", err)
+	}
+
+	return nil
+}
+
+// entryError is a failure to write an archive entry, which aborts the
+// archive.
+type entryError struct {
+	err error
+}
+
+func (e *entryError) Error() string { return e.err.Error() }
+
+// archiveObject writes the object to the archive entry name. Errors other
+// than entryError and ErrDownloadCanceled are returned before the entry is
+// started and leave the archive unchanged.
+func (s *APIServer) archiveObject(
+	ctx context.Context, archive archiveWriter, name, filename string,
+	entries map[string]struct{},
+) (cm.File, error) {
+	switch {
+	case name == "":
+		return cm.File{}, ErrInvalidEntryName
+	case name == ArchiveManifest:
+		return cm.File{}, ErrReservedEntryName
+	}
+
+	if _, ok := entries[name]; ok {
+		return cm.File{}, ErrDuplicateEntryName
+	}
+
+	file, err := s.readableObject(filename)
+	if err != nil {
+		return cm.File{}, err
+	}
+
+	// The entry is started only once the object can be decrypted.
+	if _, err := s.dataKey(file, nil); err != nil {
+		return cm.File{}, err
+	}
+
+	entry, err := archive.create(name, file)
+	if err != nil {
+		return cm.File{}, &entryError{err}
+	}
+
+	err = s.GetObject(ctx, filename, entry, GetOptions{VersionID: file.VersionID})
+	if errors.Is(err, ErrDownloadCanceled) {
+		return cm.File{}, err
+	}
+
+	if err != nil {
+		return cm.File{}, &entryError{err}
+	}
+
+	return file, nil
+}
+
+// readableObject returns the current version of an object if it can be read
+// without a customer key.
+func (s *APIServer) readableObject(filename string) (cm.File, error) {
+	file, err := s.cm.StatFile(filename, "", cm.Conditions{})
+	if err != nil {
+		return cm.File{}, err
+	}
+
+	if file.CustomerKeyMD5 != "" {
+		return cm.File{}, ErrCustomerKeyRequired
+	}
+
+	return file, nil
+}
+
+// cleanPath makes an archive entry path relative and free of dot segments, so
+// it cannot point outside of the extraction directory. It is empty for names
+// without a file name, such as "/".
+func cleanPath(filename string) string {
+	return path.Clean("/" + filename)[1:]
+}
+
+type archiveWriter interface {
+	// create starts a new entry for a file, its content is written to the
+	// returned writer.
+	create(name string, file cm.File) (io.Writer, error)
+	Close() error
+}
+
+type tarArchive struct {
+	*tar.Writer
+}
+
+func (a tarArchive) create(name string, file cm.File) (io.Writer, error) {
+	err := a.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     file.Size,
+		Mode:     0o644,
+		ModTime:  file.Created,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a.Writer, nil
+}
+
+type zipArchive struct {
+	*zip.Writer
+}
+
+func (a zipArchive) create(name string, file cm.File) (io.Writer, error) {
+	return a.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: file.Created,
+	})
+}
@@ -0,0 +1,83 @@
+package apiserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CodecNone = "none"
+	CodecGzip = "gzip"
+	CodecZstd = "zstd"
+)
+
+var ErrUnknownCodec = errors.New("unknown compression codec")
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// compress compresses a chunk and returns the codec it is stored with.
+// A chunk that does not shrink is stored raw with an empty codec.
+func compress(codec string, buf []byte) ([]byte, string, error) {
+	var compressed []byte
+
+	switch codec {
+	case CodecNone, "":
+		return buf, "", nil
+	case CodecGzip:
+		b := &bytes.Buffer{}
+		w := gzip.NewWriter(b)
+
+		if _, err := w.Write(buf); err != nil {
+			return nil, "", err
+		}
+
+		if err := w.Close(); err != nil {
+			return nil, "", err
+		}
+
+		compressed = b.Bytes()
+	case CodecZstd:
+		compressed = zstdEncoder.EncodeAll(buf, nil)
+	default:
+		return nil, "", fmt.Errorf("codec: %s: %w", codec, ErrUnknownCodec)
+	}
+
+	if len(compressed) >= len(buf) {
+		return buf, "", nil
+	}
+
+	return compressed, codec, nil
+}
+
+// decompress restores a chunk of the given size stored with codec.
+func decompress(codec string, buf []byte, size int) ([]byte, error) {
+	switch codec {
+	case "":
+		return buf, nil
+	case CodecGzip:
+		r, err := gzip.NewReader(bytes.NewReader(buf))
+		if err != nil {
+			return nil, err
+		}
+
+		out := make([]byte, size)
+
+		if _, err := io.ReadFull(r, out); err != nil {
+			return nil, err
+		}
+
+		return out, nil
+	case CodecZstd:
+		return zstdDecoder.DecodeAll(buf, make([]byte, 0, size))
+	default:
+		return nil, fmt.Errorf("codec: %s: %w", codec, ErrUnknownCodec)
+	}
+}
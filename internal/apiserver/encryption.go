@@ -0,0 +1,272 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	cm "simple-storage/internal/chunkmanager"
+	"simple-storage/internal/encryption"
+	"simple-storage/internal/logging"
+	"sync"
+)
+
+var (
+	ErrCustomerKeyRequired = errors.New("object is encrypted with a customer key")
+	ErrCustomerKeyMismatch = errors.New("customer key does not match")
+	ErrMasterKeyRequired   = errors.New("master key is not available")
+	ErrRotationInProgress  = errors.New("master key rotation is in progress")
+	ErrSameMasterKey       = errors.New("master key has not changed")
+	ErrNoMasterKeyFile     = errors.New("master key file is not configured")
+)
+
+// CustomerKeyMD5 returns base64 encoded MD5 digest of a customer key.
+func CustomerKeyMD5(key []byte) string {
+	digest := md5.Sum(key)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// masterKeys keeps the current master key and, during rotation, the retired
+// ones still wrapping data keys.
+type masterKeys struct {
+	currentID string
+	keys      map[string][]byte
+	rotating  bool
+	sync.RWMutex
+}
+
+func (k *masterKeys) add(key []byte) string {
+	id := encryption.KeyID(key)
+
+	k.keys[id] = key
+	k.currentID = id
+
+	return id
+}
+
+// newDataKey generates the data key of a new object. It returns nil if the
+// object is not going to be encrypted.
+func (s *APIServer) newDataKey(customerKey []byte) ([]byte, error) {
+	if customerKey != nil && len(customerKey) != encryption.KeySize {
+		return nil, encryption.ErrInvalidKey
+	}
+
+	s.masterKeys.RLock()
+	enabled := s.masterKeys.currentID != ""
+	s.masterKeys.RUnlock()
+
+	if customerKey == nil && !enabled {
+		return nil, nil
+	}
+
+	return encryption.NewKey()
+}
+
+// commitFile wraps the data key of an uploaded object either with the
+// customer key or with the current master key and commits the object if the
+// conditions hold. The
+// master key cannot be rotated in between, so rotation sees every object
+// wrapped by a retired key.
+func (s *APIServer) commitFile(
+	filename string, file cm.File, dataKey, customerKey []byte,
+	cond cm.Conditions,
+) (cm.File, error) {
+	s.masterKeys.RLock()
+	defer s.masterKeys.RUnlock()
+
+	if dataKey != nil {
+		wrappingKey := customerKey
+
+		if customerKey != nil {
+			file.CustomerKeyMD5 = CustomerKeyMD5(customerKey)
+		} else {
+			wrappingKey = s.masterKeys.keys[s.masterKeys.currentID]
+			file.MasterKeyID = s.masterKeys.currentID
+		}
+
+		wrapped, err := encryption.Seal(wrappingKey, dataKey, nil)
+		if err != nil {
+			return cm.File{}, fmt.Errorf("failure to wrap data key: %w", err)
+		}
+
+		file.WrappedKey = wrapped
+	}
+
+	return s.cm.CommitFile(filename, file, cond)
+}
+
+// dataKey unwraps the data key of a stored object. It returns nil if the
+// object is not encrypted.
+func (s *APIServer) dataKey(file cm.File, customerKey []byte) ([]byte, error) {
+	if file.WrappedKey == nil {
+		return nil, nil
+	}
+
+	if file.CustomerKeyMD5 != "" {
+		if customerKey == nil {
+			return nil, ErrCustomerKeyRequired
+		}
+
+		if subtle.ConstantTimeCompare(
+			[]byte(CustomerKeyMD5(customerKey)), []byte(file.CustomerKeyMD5)) != 1 {
+			return nil, ErrCustomerKeyMismatch
+		}
+
+		return encryption.Open(customerKey, file.WrappedKey, nil)
+	}
+
+	s.masterKeys.RLock()
+	masterKey, ok := s.masterKeys.keys[file.MasterKeyID]
+	s.masterKeys.RUnlock()
+
+	if !ok {
+		return nil, ErrMasterKeyRequired
+	}
+
+	return encryption.Open(masterKey, file.WrappedKey, nil)
+}
+
+// RotateMasterKey reads Config.MasterKeyFile again, makes the key stored in
+// it the master key and starts a job re-wrapping every data key wrapped by a
+// retired master key. Chunks are not rewritten. Retired keys are forgotten
+// once the job succeeds. The file is the one loaded on start, so the new key
+// is kept across restarts.
+func (s *APIServer) RotateMasterKey() (string, error) {
+	if s.config.MasterKeyFile == "" {
+		return "", ErrNoMasterKeyFile
+	}
+
+	key, err := encryption.LoadKey(s.config.MasterKeyFile)
+	if err != nil {
+		return "", err
+	}
+
+	s.masterKeys.Lock()
+
+	if s.masterKeys.rotating {
+		s.masterKeys.Unlock()
+		return "", ErrRotationInProgress
+	}
+
+	if encryption.KeyID(key) == s.masterKeys.currentID {
+		s.masterKeys.Unlock()
+		return "", ErrSameMasterKey
+	}
+
+	currentID := s.masterKeys.add(key)
+	s.masterKeys.rotating = true
+
+	keys := make(map[string][]byte, len(s.masterKeys.keys))
+	for id, key := range s.masterKeys.keys {
+		keys[id] = key
+	}
+
+	s.masterKeys.Unlock()
+
+	filenames := s.cm.Filenames()
+	jobID := s.jobs.start(JobRotateMasterKey, currentID, len(filenames))
+
+	s.log.Info("rotate master key",
+		slog.String("key_id", currentID), slog.String("job_id", jobID))
+
+	go s.rotateMasterKey(jobID, filenames, currentID, keys)
+
+	return jobID, nil
+}
+
+func (s *APIServer) rotateMasterKey(
+	jobID string, filenames []string, currentID string, keys map[string][]byte,
+) {
+	for _, filename := range filenames {
+		err := s.cm.UpdateFile(filename, func(file *cm.File) error {
+			if file.WrappedKey == nil || file.CustomerKeyMD5 != "" ||
+				file.MasterKeyID == currentID {
+				return nil
+			}
+
+			retiredKey, ok := keys[file.MasterKeyID]
+			if !ok {
+				return ErrMasterKeyRequired
+			}
+
+			dataKey, err := encryption.Open(retiredKey, file.WrappedKey, nil)
+			if err != nil {
+				return err
+			}
+
+			wrapped, err := encryption.Seal(keys[currentID], dataKey, nil)
+			if err != nil {
+				return err
+			}
+
+			file.WrappedKey = wrapped
+			file.MasterKeyID = currentID
+
+			return nil
+		})
+
+		if errors.Is(err, cm.ErrNotFound) {
+			err = nil
+		}
+
+		if err != nil {
+			s.log.Error("failure to rewrap data key",
+				logging.Object(filename), logging.Err(err))
+
+			err = fmt.Errorf("filename: %s: %w", filename, err)
+		}
+
+		s.jobs.progress(jobID, err)
+	}
+
+	job, _ := s.jobs.get(jobID)
+
+	s.masterKeys.Lock()
+
+	if job.Failed == 0 {
+		for id := range s.masterKeys.keys {
+			if id != currentID {
+				delete(s.masterKeys.keys, id)
+			}
+		}
+	}
+
+	s.masterKeys.rotating = false
+	s.masterKeys.Unlock()
+
+	s.jobs.finish(jobID)
+
+	s.log.Info("master key rotation job finished", slog.String("job_id", jobID),
+		slog.Int("failed", job.Failed), slog.Int("total", job.Total))
+}
+
+// ShredObject deletes an object with all its versions regardless of
+// versioning. Their wrapped data keys are dropped together with the object
+// metadata, so the object cannot be read anymore even before storage servers
+// reclaim its chunks in the background job.
+func (s *APIServer) ShredObject(filename string) (string, error) {
+	versions, err := s.cm.DestroyFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("failure to delete filename: %s: %w", filename, err)
+	}
+
+	var chunks []cm.Chunk
+	for _, file := range versions {
+		chunks = append(chunks, file.Chunks...)
+	}
+
+	jobID := s.jobs.start(JobShredObject, filename, len(chunks))
+
+	go func() {
+		for _, chunk := range chunks {
+			s.jobs.progress(jobID, s.deleteChunk(context.Background(), chunk))
+		}
+
+		s.jobs.finish(jobID)
+	}()
+
+	return jobID, nil
+}
@@ -0,0 +1,101 @@
+package apiserver
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"simple-storage/internal/logging"
+)
+
+// ImportResult reports what has happened to one entry of an imported archive.
+type ImportResult struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	ETag      string `json:"etag,omitempty"`
+	VersionID string `json:"version_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ImportArchive reads a tar stream and uploads every regular file in it as an
+// object named by the entry path. Entries are uploaded one by one while the
+// stream is read. A failed entry is reported in its result and does not stop
+// the import. Directories are skipped, other entries are reported as failed.
+// opts apply to every object, the content type is guessed by the entry name
+// if it is not set. Results of entries processed so far are returned together
+// with an error if the stream itself cannot be read. If allow is set, an entry
+// is only uploaded if allow returns no error for its name.
+func (s *APIServer) ImportArchive(
+	ctx context.Context, r io.Reader, opts PutOptions,
+	allow func(name string) error,
+) ([]ImportResult, error) {
+	var (
+		tr      = tar.NewReader(r)
+		results []ImportResult
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return results, ErrUploadCanceled
+		default:
+		}
+
+		header, err := tr.Next()
+		if err == io.EOF {
+			return results, nil
+		}
+
+		if err != nil {
+			return results, fmt.Errorf("failure to read archive: %w", err)
+		}
+
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		name := cleanPath(header.Name)
+		res := ImportResult{Name: name, Size: header.Size}
+
+		if header.Typeflag != tar.TypeReg || name == "" {
+			res.Error = fmt.Sprintf("entry %s is not a regular file", header.Name)
+			results = append(results, res)
+
+			continue
+		}
+
+		if allow != nil {
+			if err := allow(name); err != nil {
+				res.Error = err.Error()
+				results = append(results, res)
+
+				continue
+			}
+		}
+
+		entryOpts := opts
+		if entryOpts.Metadata.ContentType == "" {
+			entryOpts.Metadata.ContentType = mime.TypeByExtension(path.Ext(name))
+		}
+
+		file, err := s.PutObject(ctx, name, tr, header.Size, entryOpts)
+		if err != nil {
+			if errors.Is(err, ErrUploadCanceled) {
+				return results, ErrUploadCanceled
+			}
+
+			s.log.ErrorContext(ctx, "failure to import object",
+				logging.Object(name), logging.Err(err))
+
+			res.Error = err.Error()
+		} else {
+			res.ETag = file.ETag
+			res.VersionID = file.VersionID
+		}
+
+		results = append(results, res)
+	}
+}
@@ -0,0 +1,140 @@
+package apiserver
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	JobRotateMasterKey = "rotate-master-key"
+	JobShredObject     = "shred-object"
+
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// maxFinishedJobs bounds how many finished jobs are kept for reporting.
+const maxFinishedJobs = 1024
+
+var ErrJobNotFound = errors.New("job not found")
+
+// Job reports progress of a background administrative operation.
+type Job struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind"`
+	Target     string    `json:"target,omitempty"`
+	State      string    `json:"state"`
+	Total      int       `json:"total"`
+	Processed  int       `json:"processed"`
+	Failed     int       `json:"failed"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+}
+
+type jobKeeper struct {
+	jobs     map[string]*Job
+	finished []string
+	sync.RWMutex
+}
+
+func (k *jobKeeper) start(kind, target string, total int) string {
+	k.Lock()
+	defer k.Unlock()
+
+	job := &Job{
+		ID:        uuid.New().String(),
+		Kind:      kind,
+		Target:    target,
+		State:     JobRunning,
+		Total:     total,
+		StartedAt: time.Now(),
+	}
+
+	k.jobs[job.ID] = job
+
+	return job.ID
+}
+
+// progress counts one processed item of a job, err marks it as failed.
+func (k *jobKeeper) progress(id string, err error) {
+	k.Lock()
+	defer k.Unlock()
+
+	job := k.jobs[id]
+	job.Processed++
+
+	if err != nil {
+		job.Failed++
+		job.Error = err.Error()
+	}
+}
+
+func (k *jobKeeper) finish(id string) {
+	k.Lock()
+	defer k.Unlock()
+
+	job := k.jobs[id]
+	job.State = JobDone
+	job.FinishedAt = time.Now()
+
+	if job.Failed > 0 {
+		job.State = JobFailed
+	}
+
+	k.finished = append(k.finished, id)
+
+	if len(k.finished) > maxFinishedJobs {
+		delete(k.jobs, k.finished[0])
+		k.finished = k.finished[1:]
+	}
+}
+
+func (k *jobKeeper) get(id string) (Job, bool) {
+	k.RLock()
+	defer k.RUnlock()
+
+	job, ok := k.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+
+	return *job, true
+}
+
+func (k *jobKeeper) list() []Job {
+	k.RLock()
+	defer k.RUnlock()
+
+	jobs := make([]Job, 0, len(k.jobs))
+
+	for _, job := range k.jobs {
+		jobs = append(jobs, *job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt.Before(jobs[j].StartedAt)
+	})
+
+	return jobs
+}
+
+// Job returns progress of a background operation.
+func (s *APIServer) Job(id string) (Job, error) {
+	job, ok := s.jobs.get(id)
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+
+	return job, nil
+}
+
+// Jobs returns progress of all known background operations.
+func (s *APIServer) Jobs() []Job {
+	return s.jobs.list()
+}
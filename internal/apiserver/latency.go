@@ -0,0 +1,50 @@
+package apiserver
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	latencyWindow     = 256
+	latencyMinSamples = 16
+)
+
+// latencies keeps a window of recent chunk download latencies.
+type latencies struct {
+	samples []time.Duration
+	next    int
+	sync.Mutex
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	if len(l.samples) < latencyWindow {
+		l.samples = append(l.samples, d)
+		return
+	}
+
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencyWindow
+}
+
+// percentile returns the p-th percentile of the window. It reports false
+// until enough samples are collected.
+func (l *latencies) percentile(p float64) (time.Duration, bool) {
+	l.Lock()
+	samples := append([]time.Duration(nil), l.samples...)
+	l.Unlock()
+
+	if len(samples) < latencyMinSamples {
+		return 0, false
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	i := int(float64(len(samples)-1) * p / 100)
+
+	return samples[i], true
+}
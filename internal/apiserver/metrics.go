@@ -0,0 +1,91 @@
+package apiserver
+
+import (
+	"errors"
+	"io"
+	cm "simple-storage/internal/chunkmanager"
+	"simple-storage/internal/resilience"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics counts failed transfers of objects by cause.
+type metrics struct {
+	uploadFailures   *prometheus.CounterVec
+	downloadFailures *prometheus.CounterVec
+}
+
+func newMetrics(registerer prometheus.Registerer) metrics {
+	m := metrics{
+		uploadFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simple_storage_object_upload_failures_total",
+			Help: "Failed object uploads by cause.",
+		}, []string{"cause"}),
+		downloadFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simple_storage_object_download_failures_total",
+			Help: "Failed object downloads by cause.",
+		}, []string{"cause"}),
+	}
+
+	if registerer != nil {
+		registerer.MustRegister(m.uploadFailures, m.downloadFailures)
+	}
+
+	return m
+}
+
+func (m metrics) uploadFailed(err error) {
+	if cause := failureCause(err); cause != "" {
+		m.uploadFailures.WithLabelValues(cause).Inc()
+	}
+}
+
+func (m metrics) downloadFailed(err error) {
+	if cause := failureCause(err); cause != "" {
+		m.downloadFailures.WithLabelValues(cause).Inc()
+	}
+}
+
+// storageServerError marks failures of chunk transfers to or from storage
+// servers.
+type storageServerError struct{ err error }
+
+func (e *storageServerError) Error() string { return e.err.Error() }
+func (e *storageServerError) Unwrap() error { return e.err }
+
+// failureCause classifies err for metrics, it is empty if err is not a
+// failure.
+func failureCause(err error) string {
+	var ssErr *storageServerError
+
+	switch {
+	case err == nil, errors.Is(err, cm.ErrNotModified):
+		return ""
+	case errors.Is(err, ErrUploadCanceled), errors.Is(err, ErrDownloadCanceled):
+		return "canceled"
+	case errors.Is(err, ErrChunkCorrupted), errors.Is(err, ErrContentMD5Mismatch):
+		return "integrity"
+	case errors.Is(err, resilience.ErrCircuitOpen):
+		return "circuit_open"
+	case errors.As(err, &ssErr):
+		return "storage_server"
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "client"
+	case errors.Is(err, cm.ErrNotFound), errors.Is(err, cm.ErrDeleteMarker),
+		errors.Is(err, ErrUploadNotFound):
+		return "not_found"
+	case errors.Is(err, cm.ErrPreconditionFailed), errors.Is(err, cm.ErrAlreadyExist),
+		errors.Is(err, ErrUploadOffsetMismatch):
+		return "precondition"
+	case errors.Is(err, cm.ErrNoStorageServerAvailable),
+		errors.Is(err, cm.ErrNotEnoughStorageServers):
+		return "no_storage_server"
+	case errors.Is(err, ErrCustomerKeyRequired), errors.Is(err, ErrCustomerKeyMismatch),
+		errors.Is(err, ErrMasterKeyRequired):
+		return "encryption"
+	case errors.Is(err, ErrMetadataTooLarge), errors.Is(err, ErrUnknownCodec):
+		return "bad_request"
+	default:
+		return "internal"
+	}
+}
@@ -0,0 +1,111 @@
+package apiserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrPresignDisabled   = errors.New("url signing is disabled")
+	ErrInvalidSignature  = errors.New("invalid url signature")
+	ErrSignatureExpired  = errors.New("url signature has expired")
+	ErrUnsignedMethod    = errors.New("only GET and PUT urls can be signed")
+	ErrInvalidPresignTTL = errors.New("url expiry should be positive")
+)
+
+// Query parameters of presigned urls.
+const (
+	PresignExpiresParam   = "X-Expires"
+	PresignMaxLengthParam = "X-Max-Length"
+	PresignSignatureParam = "X-Signature"
+)
+
+// PresignURL returns query parameters allowing the method on one object until
+// ttl passes without credentials. A positive maxLength limits the size of the
+// request body.
+func (s *APIServer) PresignURL(
+	method, filename string, ttl time.Duration, maxLength int64,
+) (url.Values, error) {
+	if len(s.config.PresignSecret) == 0 {
+		return nil, ErrPresignDisabled
+	}
+
+	if method != http.MethodGet && method != http.MethodPut {
+		return nil, fmt.Errorf("method: %s: %w", method, ErrUnsignedMethod)
+	}
+
+	if ttl <= 0 {
+		return nil, ErrInvalidPresignTTL
+	}
+
+	expires := time.Now().Add(ttl).Unix()
+
+	query := url.Values{}
+	query.Set(PresignExpiresParam, strconv.FormatInt(expires, 10))
+
+	if maxLength > 0 {
+		query.Set(PresignMaxLengthParam, strconv.FormatInt(maxLength, 10))
+	}
+
+	query.Set(PresignSignatureParam, s.presignSignature(method, filename, expires, maxLength))
+
+	return query, nil
+}
+
+// Presigned reports whether url query parameters carry a signature.
+func (s *APIServer) Presigned(query url.Values) bool {
+	_, ok := query[PresignSignatureParam]
+	return ok
+}
+
+// VerifyURL checks the signature of a presigned url for the method and the
+// object. It returns the request body size limit, zero if there is none.
+func (s *APIServer) VerifyURL(
+	method, filename string, query url.Values,
+) (int64, error) {
+	if len(s.config.PresignSecret) == 0 {
+		return 0, ErrPresignDisabled
+	}
+
+	expires, err := strconv.ParseInt(query.Get(PresignExpiresParam), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidSignature
+	}
+
+	var maxLength int64
+
+	if value := query.Get(PresignMaxLengthParam); value != "" {
+		maxLength, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || maxLength <= 0 {
+			return 0, ErrInvalidSignature
+		}
+	}
+
+	signature := s.presignSignature(method, filename, expires, maxLength)
+
+	if !hmac.Equal([]byte(signature), []byte(query.Get(PresignSignatureParam))) {
+		return 0, ErrInvalidSignature
+	}
+
+	if time.Now().Unix() > expires {
+		return 0, ErrSignatureExpired
+	}
+
+	return maxLength, nil
+}
+
+func (s *APIServer) presignSignature(
+	method, filename string, expires, maxLength int64,
+) string {
+	mac := hmac.New(sha256.New, s.config.PresignSecret)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%d", method, filename, expires, maxLength)
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
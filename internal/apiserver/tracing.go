@@ -0,0 +1,29 @@
+package apiserver
+
+import (
+	"simple-storage/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attributes of spans of chunk transfers.
+const (
+	attrFilename      = attribute.Key("filename")
+	attrChunkID       = attribute.Key("chunk_id")
+	attrStorageServer = attribute.Key("storage_server")
+	attrBytes         = attribute.Key("bytes")
+)
+
+// endSpan ends span of an object operation, err is recorded only if it is a
+// failure, with its cause.
+func endSpan(span trace.Span, err error) {
+	cause := failureCause(err)
+	if cause == "" {
+		err = nil
+	} else {
+		span.SetAttributes(attribute.String("failure_cause", cause))
+	}
+
+	tracing.End(span, err)
+}
@@ -0,0 +1,54 @@
+package apiserver
+
+import (
+	"sync"
+	"time"
+)
+
+type uploadKeeper struct {
+	uploads map[string]*upload
+	sync.RWMutex
+}
+
+func (k *uploadKeeper) get(id string) (*upload, bool) {
+	k.RLock()
+	defer k.RUnlock()
+
+	u, ok := k.uploads[id]
+
+	return u, ok
+}
+
+func (k *uploadKeeper) add(id string, u *upload) {
+	k.Lock()
+	defer k.Unlock()
+
+	k.uploads[id] = u
+}
+
+func (k *uploadKeeper) remove(id string) (*upload, bool) {
+	k.Lock()
+	defer k.Unlock()
+
+	u, ok := k.uploads[id]
+	delete(k.uploads, id)
+
+	return u, ok
+}
+
+// removeExpired removes and returns uploads which expire before now.
+func (k *uploadKeeper) removeExpired(now time.Time) map[string]*upload {
+	k.Lock()
+	defer k.Unlock()
+
+	expired := map[string]*upload{}
+
+	for id, u := range k.uploads {
+		if expires := u.expiresAt(); !expires.IsZero() && expires.Before(now) {
+			expired[id] = u
+			delete(k.uploads, id)
+		}
+	}
+
+	return expired
+}
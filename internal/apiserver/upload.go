@@ -0,0 +1,384 @@
+package apiserver
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	cm "simple-storage/internal/chunkmanager"
+	"simple-storage/internal/logging"
+	"simple-storage/internal/tracing"
+	"simple-storage/internal/utils"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	ErrEmptyUpload          = errors.New("upload length should be positive")
+	ErrUploadTooLarge       = errors.New("upload data exceeds the upload length")
+)
+
+// upload is a resumable upload session. Received bytes are accumulated in buf
+// until a whole chunk is available, then the chunk is placed and uploaded.
+type upload struct {
+	// expires is the Unix time in nanoseconds the session is discarded at
+	// unless it is written, zero if it does not expire. It is read without
+	// the lock, so that sessions being written are not waited for.
+	expires  atomic.Int64
+	filename string
+	// owner identifies the client which created the session, only it may
+	// write or terminate the session.
+	owner     string
+	size      int64
+	offset    int64
+	chunkSize int
+	chunks    []cm.Chunk
+	buf       []byte
+	hash      hash.Hash
+	dataKey   []byte
+	metadata  cm.Metadata
+	sync.Mutex
+}
+
+// expiresAt returns the time the session expires at, zero if it does not
+// expire.
+func (u *upload) expiresAt() time.Time {
+	expires := u.expires.Load()
+	if expires == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, expires)
+}
+
+// touch postpones the expiry of the session by Config.UploadExpiry.
+func (s *APIServer) touch(u *upload) {
+	if s.config.UploadExpiry > 0 {
+		u.expires.Store(time.Now().Add(s.config.UploadExpiry).UnixNano())
+	}
+}
+
+// chunkLen returns the length of the chunk that is being accumulated in buf.
+func (u *upload) chunkLen() int {
+	rest := u.size - u.offset + int64(len(u.buf))
+
+	if rest < int64(u.chunkSize) {
+		return int(rest)
+	}
+
+	return u.chunkSize
+}
+
+// CreateUpload starts a resumable upload of size bytes for owner and returns
+// its ID.
+func (s *APIServer) CreateUpload(
+	filename string, size int64, metadata cm.Metadata, owner string,
+) (string, error) {
+	if size <= 0 {
+		return "", ErrEmptyUpload
+	}
+
+	if err := checkMetadata(metadata); err != nil {
+		return "", err
+	}
+
+	if _, err := s.cm.FileInfo(filename); err == nil &&
+		!s.cm.Versioning(cm.Bucket(filename)) {
+		return "", fmt.Errorf("filename: %s: %w", filename, cm.ErrAlreadyExist)
+	}
+
+	dataKey, err := s.newDataKey(nil)
+	if err != nil {
+		return "", fmt.Errorf("failure to generate data key: %w", err)
+	}
+
+	chunkSize := utils.ChunkSize(size, s.cm.NumberOfChunks(size))
+	id := uuid.New().String()
+
+	u := &upload{
+		filename:  filename,
+		owner:     owner,
+		size:      size,
+		chunkSize: chunkSize,
+		buf:       make([]byte, 0, chunkSize),
+		hash:      md5.New(),
+		dataKey:   dataKey,
+		metadata:  metadata,
+	}
+
+	s.touch(u)
+	s.uploads.add(id, u)
+
+	s.log.Info("create upload", slog.String("upload_id", id),
+		logging.Object(filename), slog.Int64("size", size))
+
+	return id, nil
+}
+
+// UploadStatus returns the acknowledged offset and the length of an upload.
+func (s *APIServer) UploadStatus(id string) (int64, int64, error) {
+	u, ok := s.uploads.get(id)
+	if !ok {
+		return 0, 0, ErrUploadNotFound
+	}
+
+	u.Lock()
+	defer u.Unlock()
+
+	return u.offset, u.size, nil
+}
+
+// UploadOwner returns the filename of an upload and the owner it has been
+// created for.
+func (s *APIServer) UploadOwner(id string) (string, string, error) {
+	u, ok := s.uploads.get(id)
+	if !ok {
+		return "", "", ErrUploadNotFound
+	}
+
+	// Both are set once the session is created.
+	return u.filename, u.owner, nil
+}
+
+// UploadExpires returns the time an upload is discarded at unless it is
+// written, zero if uploads do not expire.
+func (s *APIServer) UploadExpires(id string) (time.Time, error) {
+	u, ok := s.uploads.get(id)
+	if !ok {
+		return time.Time{}, ErrUploadNotFound
+	}
+
+	return u.expiresAt(), nil
+}
+
+// WriteUpload appends length bytes read from r to the upload starting at
+// offset. Data running past the length of the upload is rejected before
+// anything is read. Everything read before r fails stays acknowledged, so the
+// returned offset is valid even when an error is returned and the client can
+// resume from it.
+func (s *APIServer) WriteUpload(
+	ctx context.Context, id string, offset, length int64, r io.Reader,
+) (int64, error) {
+	ctx, span := tracing.Start(ctx, "WriteUpload", trace.WithAttributes(
+		attribute.String("upload_id", id), attribute.Int64("offset", offset)))
+
+	offset, err := s.writeUpload(ctx, id, offset, length, r)
+	s.metrics.uploadFailed(err)
+	endSpan(span, err)
+
+	return offset, err
+}
+
+func (s *APIServer) writeUpload(
+	ctx context.Context, id string, offset, length int64, r io.Reader,
+) (int64, error) {
+	u, ok := s.uploads.get(id)
+	if !ok {
+		return 0, ErrUploadNotFound
+	}
+
+	u.Lock()
+	defer u.Unlock()
+
+	// The session is not expired while it is written and the client has the
+	// whole expiry to resume from the last write.
+	s.touch(u)
+	defer s.touch(u)
+
+	if offset != u.offset {
+		return u.offset, ErrUploadOffsetMismatch
+	}
+
+	if length > u.size-u.offset {
+		return u.offset, fmt.Errorf("%w: %d bytes at offset %d, upload length is %d",
+			ErrUploadTooLarge, length, u.offset, u.size)
+	}
+
+	eof := false
+
+	for {
+		if len(u.buf) > 0 && len(u.buf) == u.chunkLen() {
+			if err := s.flushUpload(ctx, u); err != nil {
+				return u.offset, err
+			}
+		}
+
+		if u.offset == u.size || eof {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return u.offset, ErrUploadCanceled
+		default:
+		}
+
+		n, err := r.Read(u.buf[len(u.buf):u.chunkLen()])
+		u.buf = u.buf[:len(u.buf)+n]
+		u.offset += int64(n)
+
+		switch {
+		case errors.Is(err, io.EOF):
+			eof = true
+		case err != nil:
+			return u.offset, fmt.Errorf("failure to read upload: %s: %w", id, err)
+		}
+	}
+
+	if u.offset == u.size {
+		if err := s.commitUpload(id, u); err != nil {
+			return u.offset, err
+		}
+	}
+
+	return u.offset, nil
+}
+
+// TerminateUpload discards an upload and every chunk uploaded for it.
+func (s *APIServer) TerminateUpload(id string) error {
+	u, ok := s.uploads.remove(id)
+	if !ok {
+		return ErrUploadNotFound
+	}
+
+	u.Lock()
+	defer u.Unlock()
+
+	s.discardChunks(u.chunks)
+
+	s.log.Info("terminate upload", slog.String("upload_id", id), logging.Object(u.filename))
+
+	return nil
+}
+
+func (s *APIServer) flushUpload(ctx context.Context, u *upload) error {
+	chunk, err := s.cm.PlaceChunk()
+	if err != nil {
+		return fmt.Errorf("failure to place chunk: %w", err)
+	}
+
+	stored, err := encodeChunk(&chunk, s.config.Compression, u.dataKey, u.buf)
+	if err != nil {
+		s.cm.ReleaseChunks([]cm.Chunk{chunk})
+
+		return fmt.Errorf("failure to encode "+
+			"filename: %s: %w ", u.filename, err)
+	}
+
+	err = s.uploadChunk(ctx, chunk, stored)
+	if err != nil {
+		s.discardChunks([]cm.Chunk{chunk})
+
+		return fmt.Errorf("failure to upload "+
+			"filename: %s: %w ", u.filename, err)
+	}
+
+	u.chunks = append(u.chunks, chunk)
+	u.hash.Write(u.buf)
+	u.buf = u.buf[:0]
+
+	return nil
+}
+
+// ExpireUploads discards uploads which have not been written for
+// Config.UploadExpiry and every chunk uploaded for them, until ctx is done.
+// It returns at once if uploads do not expire.
+func (s *APIServer) ExpireUploads(ctx context.Context) {
+	if s.config.UploadExpiry <= 0 {
+		return
+	}
+
+	interval := s.config.UploadExpiry
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.expireUploads(now)
+		}
+	}
+}
+
+func (s *APIServer) expireUploads(now time.Time) {
+	for id, u := range s.uploads.removeExpired(now) {
+		u.Lock()
+		s.discardChunks(u.chunks)
+		u.Unlock()
+
+		s.log.Info("expire upload", slog.String("upload_id", id), logging.Object(u.filename))
+	}
+}
+
+func (s *APIServer) commitUpload(id string, u *upload) error {
+	if _, ok := s.uploads.remove(id); !ok {
+		// The upload has been terminated or has expired while it was
+		// written, its chunks are discarded by the one which has removed it.
+		return ErrUploadNotFound
+	}
+
+	_, err := s.commitFile(u.filename, cm.File{
+		Chunks:   u.chunks,
+		Size:     u.size,
+		ETag:     hex.EncodeToString(u.hash.Sum(nil)),
+		Metadata: u.metadata,
+	}, u.dataKey, nil, cm.Conditions{})
+	if err != nil {
+		s.discardChunks(u.chunks)
+
+		return fmt.Errorf("failure to commit filename: %s: %w", u.filename, err)
+	}
+
+	s.log.Info("complete upload", slog.String("upload_id", id), logging.Object(u.filename))
+
+	return nil
+}
+
+// discardChunks releases chunks and deletes them from storage servers, the
+// deletion is not bound to the request which has failed.
+func (s *APIServer) discardChunks(chunks []cm.Chunk) {
+	s.cm.ReleaseChunks(chunks)
+
+	for _, chunk := range chunks {
+		s.deleteChunk(context.Background(), chunk)
+	}
+}
+
+// deleteChunk deletes a chunk from the cache and from every storage server
+// keeping it.
+func (s *APIServer) deleteChunk(ctx context.Context, chunk cm.Chunk) error {
+	s.config.Cache.Remove(chunk.ID)
+
+	var lastErr error
+
+	for _, address := range chunk.StorageServers() {
+		ss := s.storageServers.get(address)
+
+		if err := ss.DeleteChunk(ctx, chunk.ID); err != nil {
+			s.log.ErrorContext(ctx, "failure to delete chunk",
+				logging.ChunkID(chunk.ID), logging.StorageServer(address), logging.Err(err))
+
+			lastErr = fmt.Errorf("failure to delete "+
+				"chunk: %s storage-server: %s: %w", chunk.ID, address, err)
+		}
+	}
+
+	return lastErr
+}
@@ -0,0 +1,54 @@
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	cm "simple-storage/internal/chunkmanager"
+)
+
+// DeleteObject deletes an object if the conditions hold. If versioning is
+// enabled for its bucket, a delete marker is written and returned. Otherwise
+// all versions of the object are forgotten and their chunks are reclaimed
+// from storage servers in the background.
+func (s *APIServer) DeleteObject(
+	filename string, cond cm.Conditions,
+) (cm.File, error) {
+	marker, removed, err := s.cm.DeleteFile(filename, cond)
+	if err != nil {
+		return cm.File{}, fmt.Errorf("failure to delete filename: %s: %w", filename, err)
+	}
+
+	if len(removed) > 0 {
+		go func() {
+			for _, file := range removed {
+				for _, chunk := range file.Chunks {
+					s.deleteChunk(context.Background(), chunk)
+				}
+			}
+		}()
+	}
+
+	return marker, nil
+}
+
+// ObjectVersions returns all versions of an object including delete markers,
+// the current one first.
+func (s *APIServer) ObjectVersions(filename string) ([]cm.File, error) {
+	versions, err := s.cm.Versions(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failure to get versions of filename: %s: %w", filename, err)
+	}
+
+	return versions, nil
+}
+
+// RestoreObjectVersion makes an older version of an object current again.
+func (s *APIServer) RestoreObjectVersion(filename, versionID string) (cm.File, error) {
+	file, err := s.cm.RestoreVersion(filename, versionID)
+	if err != nil {
+		return cm.File{}, fmt.Errorf("failure to restore "+
+			"version: %s of filename: %s: %w", versionID, filename, err)
+	}
+
+	return file, nil
+}
@@ -0,0 +1,205 @@
+// Package auth authenticates API clients by secret keys and authorizes their
+// requests by grants given per bucket or key prefix.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUnauthenticated    = errors.New("credentials required")
+	ErrForbidden          = errors.New("access denied")
+	ErrInvalidPolicy      = errors.New("invalid policy")
+)
+
+// Action is an operation granted on objects.
+type Action string
+
+const (
+	Read   Action = "read"
+	Write  Action = "write"
+	Delete Action = "delete"
+	List   Action = "list"
+	// Admin allows to configure buckets and to run admin endpoints.
+	Admin Action = "admin"
+)
+
+// APIKeyHeader carries a secret key as an alternative to a bearer token.
+const APIKeyHeader = "X-Api-Key"
+
+// Grant allows actions on objects whose keys start with Prefix. If Bucket is
+// set, the objects must belong to the bucket too.
+type Grant struct {
+	Bucket  string   `json:"bucket"`
+	Prefix  string   `json:"prefix"`
+	Actions []Action `json:"actions"`
+}
+
+// Principal is an identity of a client.
+type Principal struct {
+	ID     string  `json:"id"`
+	Key    string  `json:"key"`
+	Grants []Grant `json:"grants"`
+	// Cluster is set for the cluster credential, which only allows storage
+	// servers to register.
+	Cluster bool `json:"-"`
+}
+
+// Policy keeps principals by their secret keys.
+type Policy struct {
+	principals map[[sha256.Size]byte]*Principal
+}
+
+type policyFile struct {
+	// ClusterKey is the credential of storage servers.
+	ClusterKey string      `json:"cluster_key"`
+	Principals []Principal `json:"principals"`
+}
+
+// Load reads a policy from a JSON file.
+func Load(path string) (*Policy, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failure to read policy: %w", err)
+	}
+
+	return Parse(buf)
+}
+
+// Parse decodes a JSON policy.
+func Parse(buf []byte) (*Policy, error) {
+	var f policyFile
+
+	if err := json.Unmarshal(buf, &f); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPolicy, err)
+	}
+
+	p := &Policy{principals: map[[sha256.Size]byte]*Principal{}}
+
+	add := func(principal *Principal) error {
+		if principal.Key == "" {
+			return fmt.Errorf("%w: principal %q has no key", ErrInvalidPolicy, principal.ID)
+		}
+
+		id := sha256.Sum256([]byte(principal.Key))
+
+		if _, ok := p.principals[id]; ok {
+			return fmt.Errorf("%w: principal %q reuses a key", ErrInvalidPolicy, principal.ID)
+		}
+
+		p.principals[id] = principal
+
+		return nil
+	}
+
+	if f.ClusterKey != "" {
+		err := add(&Principal{ID: "cluster", Key: f.ClusterKey, Cluster: true})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range f.Principals {
+		principal := &f.Principals[i]
+
+		for _, grant := range principal.Grants {
+			for _, action := range grant.Actions {
+				switch action {
+				case Read, Write, Delete, List, Admin:
+				default:
+					return nil, fmt.Errorf("%w: principal %q: unknown action %q",
+						ErrInvalidPolicy, principal.ID, action)
+				}
+			}
+		}
+
+		if err := add(principal); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Authenticate returns the request context with the principal of the request
+// credentials. Requests without credentials are anonymous and keep their
+// context.
+func (p *Policy) Authenticate(r *http.Request) (context.Context, error) {
+	return p.AuthenticateKey(r.Context(), Credential(r))
+}
+
+// AuthenticateKey returns the context with the principal of the secret key.
+// An empty key is anonymous and keeps the context.
+func (p *Policy) AuthenticateKey(ctx context.Context, key string) (context.Context, error) {
+	if key == "" {
+		return ctx, nil
+	}
+
+	principal, ok := p.principals[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	return context.WithValue(ctx, principalCtx{}, principal), nil
+}
+
+// Credential returns the secret key of a request, either a bearer token or
+// the API key header.
+func Credential(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+
+	return BearerToken(r.Header.Get("Authorization"))
+}
+
+// BearerToken returns the token of an Authorization header value, empty if
+// it is not a bearer token.
+func BearerToken(authorization string) string {
+	const bearer = "Bearer "
+
+	if len(authorization) > len(bearer) &&
+		strings.EqualFold(authorization[:len(bearer)], bearer) {
+		return strings.TrimSpace(authorization[len(bearer):])
+	}
+
+	return ""
+}
+
+type principalCtx struct{}
+
+// FromContext returns the principal of an authenticated request.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalCtx{}).(*Principal)
+	return principal, ok
+}
+
+// Allowed reports whether the principal is granted the action on the key. For
+// listing the key is the listed prefix.
+func (p *Principal) Allowed(action Action, key string) bool {
+	for _, grant := range p.Grants {
+		if grant.Bucket != "" && !strings.HasPrefix(key, grant.Bucket+"/") {
+			continue
+		}
+
+		if !strings.HasPrefix(key, grant.Prefix) {
+			continue
+		}
+
+		for _, a := range grant.Actions {
+			if a == action {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `{
+	"cluster_key": "cluster-secret",
+	"principals": [
+		{
+			"id": "photos",
+			"key": "photos-secret",
+			"grants": [
+				{"bucket": "photos", "actions": ["read", "list"]},
+				{"bucket": "photos", "prefix": "photos/uploads/", "actions": ["write", "delete"]}
+			]
+		},
+		{
+			"id": "admin",
+			"key": "admin-secret",
+			"grants": [{"actions": ["read", "write", "delete", "list", "admin"]}]
+		}
+	]
+}`
+
+func TestParse(t *testing.T) {
+	tt := []struct {
+		policy string
+		err    error
+	}{
+		{policy: testPolicy},
+		{policy: `{"principals": [{"id": "a", "grants": []}]}`, err: ErrInvalidPolicy},
+		{policy: `{"principals": [{"id": "a", "key": "k", "grants": [{"actions": ["own"]}]}]}`,
+			err: ErrInvalidPolicy},
+		{policy: `{"cluster_key": "k", "principals": [{"id": "a", "key": "k"}]}`,
+			err: ErrInvalidPolicy},
+		{policy: `{`, err: ErrInvalidPolicy},
+	}
+
+	for _, tc := range tt {
+		_, err := Parse([]byte(tc.policy))
+		require.ErrorIs(t, err, tc.err, tc.policy)
+	}
+}
+
+func TestPolicy_Authenticate(t *testing.T) {
+	policy, err := Parse([]byte(testPolicy))
+	require.NoError(t, err)
+
+	tt := []struct {
+		header    string
+		value     string
+		principal string
+		cluster   bool
+		err       error
+	}{
+		{},
+		{header: "Authorization", value: "Bearer photos-secret", principal: "photos"},
+		{header: "Authorization", value: "bearer admin-secret", principal: "admin"},
+		{header: APIKeyHeader, value: "photos-secret", principal: "photos"},
+		{header: "Authorization", value: "Bearer cluster-secret", principal: "cluster", cluster: true},
+		{header: "Authorization", value: "Bearer unknown", err: ErrInvalidCredentials},
+		{header: "Authorization", value: "Basic cGhvdG9zLXNlY3JldA=="},
+	}
+
+	for _, tc := range tt {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.header != "" {
+			r.Header.Set(tc.header, tc.value)
+		}
+
+		ctx, err := policy.Authenticate(r)
+		require.ErrorIs(t, err, tc.err)
+
+		if err != nil {
+			continue
+		}
+
+		principal, ok := FromContext(ctx)
+		require.Equal(t, tc.principal != "", ok)
+
+		if ok {
+			require.Equal(t, tc.principal, principal.ID)
+			require.Equal(t, tc.cluster, principal.Cluster)
+		}
+	}
+}
+
+func TestPrincipal_Allowed(t *testing.T) {
+	policy, err := Parse([]byte(testPolicy))
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer photos-secret")
+
+	ctx, err := policy.Authenticate(r)
+	require.NoError(t, err)
+
+	photos, ok := FromContext(ctx)
+	require.True(t, ok)
+
+	tt := []struct {
+		action  Action
+		key     string
+		allowed bool
+	}{
+		{action: Read, key: "photos/cat.jpg", allowed: true},
+		{action: List, key: "photos/", allowed: true},
+		{action: Write, key: "photos/cat.jpg"},
+		{action: Write, key: "photos/uploads/cat.jpg", allowed: true},
+		{action: Delete, key: "photos/uploads/cat.jpg", allowed: true},
+		{action: Read, key: "photosets/cat.jpg"},
+		{action: Read, key: "photos"},
+		{action: List, key: ""},
+		{action: Admin, key: "photos/"},
+	}
+
+	for _, tc := range tt {
+		require.Equal(t, tc.allowed, photos.Allowed(tc.action, tc.key),
+			"%s on %s", tc.action, tc.key)
+	}
+}
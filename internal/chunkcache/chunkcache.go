@@ -0,0 +1,472 @@
+// Package chunkcache keeps contents of recently read chunks in memory and
+// optionally spills chunks evicted from memory to a local directory. Chunks
+// are immutable, so cached contents only have to be removed once a chunk is
+// deleted.
+package chunkcache
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrForeignDir is returned for a cache dir with files of someone else.
+var ErrForeignDir = errors.New("cache dir is not empty and has no cache marker")
+
+const (
+	// markerFile marks a dir created by the cache.
+	markerFile = ".chunkcache"
+	// chunkSuffix ends names of spilled chunks, only such files are removed.
+	chunkSuffix = ".chunk"
+	tmpSuffix   = ".tmp"
+)
+
+type Config struct {
+	// MaxBytes bounds the total size of chunks kept in memory.
+	MaxBytes int64
+	// Dir is the directory chunks evicted from memory are spilled to. Chunks
+	// spilled before are removed on start. A dir with other files is used
+	// only if it has been created by the cache. Empty disables spilling.
+	Dir string
+	// MaxDiskBytes bounds the total size of chunks spilled to Dir.
+	MaxDiskBytes int64
+}
+
+// Stats describes the cache usage.
+type Stats struct {
+	Hits        int64   `json:"hits"`
+	Misses      int64   `json:"misses"`
+	HitRatio    float64 `json:"hit_ratio"`
+	Bytes       int64   `json:"bytes"`
+	Entries     int     `json:"entries"`
+	DiskBytes   int64   `json:"disk_bytes"`
+	DiskEntries int     `json:"disk_entries"`
+}
+
+// Cache is a size bounded LRU cache of chunk contents keyed by chunk ID. A nil
+// Cache caches nothing.
+type Cache struct {
+	dir    string
+	memory lru
+	// disk keeps sizes of spilled chunks, nil if spilling is disabled.
+	disk *lru
+	// spilling are chunks evicted from memory which are being written to
+	// disk. Removed chunks are dropped from it, so that they are not kept
+	// once written.
+	spilling map[string]*entry
+	hits     int64
+	misses   int64
+	sync.Mutex
+}
+
+func New(config Config) (*Cache, error) {
+	c := &Cache{
+		dir:    config.Dir,
+		memory: newLRU(config.MaxBytes),
+	}
+
+	if config.Dir != "" {
+		if err := prepareDir(config.Dir); err != nil {
+			return nil, err
+		}
+
+		disk := newLRU(config.MaxDiskBytes)
+		c.disk = &disk
+		c.spilling = map[string]*entry{}
+	}
+
+	return c, nil
+}
+
+// prepareDir creates the cache dir and marks it, or removes chunks spilled
+// to it before if it is marked. It refuses a dir with files without the
+// marker, so that files of someone else are never removed.
+func prepareDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failure to create cache dir: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failure to read cache dir: %w", err)
+	}
+
+	marked := false
+
+	for _, e := range entries {
+		if e.Name() == markerFile {
+			marked = true
+		}
+	}
+
+	if !marked {
+		if len(entries) > 0 {
+			return fmt.Errorf("%w: %s", ErrForeignDir, dir)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, markerFile), nil, 0o600); err != nil {
+			return fmt.Errorf("failure to mark cache dir: %w", err)
+		}
+
+		return nil
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+
+		if e.Type().IsRegular() && (strings.HasSuffix(name, chunkSuffix) ||
+			strings.HasSuffix(name, chunkSuffix+tmpSuffix)) {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return fmt.Errorf("failure to clean cache dir: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Get returns the content of a cached chunk.
+func (c *Cache) Get(id string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.Lock()
+
+	if e, ok := c.memory.get(id); ok {
+		c.hits++
+		c.Unlock()
+
+		return e.buf, true
+	}
+
+	if c.disk == nil {
+		c.misses++
+		c.Unlock()
+
+		return nil, false
+	}
+
+	_, ok := c.disk.get(id)
+	c.Unlock()
+
+	var (
+		buf []byte
+		err error
+	)
+
+	if ok {
+		buf, err = os.ReadFile(c.path(id))
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if !ok || err != nil {
+		if ok {
+			c.disk.remove(id)
+		}
+
+		c.misses++
+
+		return nil, false
+	}
+
+	c.hits++
+
+	return buf, true
+}
+
+// Add caches the content of a chunk. The content must not be changed
+// afterwards.
+func (c *Cache) Add(id string, buf []byte) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+
+	if _, ok := c.memory.items[id]; ok {
+		c.Unlock()
+		return
+	}
+
+	evicted := c.memory.add(&entry{id: id, size: int64(len(buf)), buf: buf})
+	c.startSpilling(evicted)
+
+	c.Unlock()
+
+	if c.disk != nil {
+		c.spill(evicted)
+	}
+}
+
+// Remove forgets a chunk.
+func (c *Cache) Remove(id string) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+
+	c.memory.remove(id)
+
+	onDisk := false
+	if c.disk != nil {
+		_, onDisk = c.disk.remove(id)
+		delete(c.spilling, id)
+	}
+
+	c.Unlock()
+
+	if onDisk {
+		os.Remove(c.path(id))
+	}
+}
+
+// Resize changes the limits of the cache. Chunks evicted from memory to fit
+// the new limit are spilled, the disk limit is ignored if spilling is
+// disabled.
+func (c *Cache) Resize(maxBytes, maxDiskBytes int64) {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+
+	evicted := c.memory.resize(maxBytes)
+	c.startSpilling(evicted)
+
+	var dropped []*entry
+	if c.disk != nil {
+		dropped = c.disk.resize(maxDiskBytes)
+	}
+
+	c.Unlock()
+
+	for _, d := range dropped {
+		os.Remove(c.path(d.id))
+	}
+
+	if c.disk != nil {
+		c.spill(evicted)
+	}
+}
+
+func (c *Cache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	stats := Stats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Bytes:   c.memory.size,
+		Entries: len(c.memory.items),
+	}
+
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRatio = float64(c.hits) / float64(total)
+	}
+
+	if c.disk != nil {
+		stats.DiskBytes = c.disk.size
+		stats.DiskEntries = len(c.disk.items)
+	}
+
+	return stats
+}
+
+// startSpilling records chunks evicted from memory before they are spilled,
+// c must be locked.
+func (c *Cache) startSpilling(evicted []*entry) {
+	if c.disk == nil {
+		return
+	}
+
+	for _, e := range evicted {
+		c.spilling[e.id] = e
+	}
+}
+
+// spill writes chunks evicted from memory to the cache dir and removes chunks
+// evicted from the dir in turn.
+func (c *Cache) spill(evicted []*entry) {
+	for _, e := range evicted {
+		c.spillEntry(e)
+	}
+}
+
+// spillEntry writes the chunk to a temporary file, which becomes the chunk
+// file only if the chunk has not been removed or evicted again meanwhile.
+func (c *Cache) spillEntry(e *entry) {
+	c.Lock()
+
+	if c.spilling[e.id] != e {
+		c.Unlock()
+		return
+	}
+
+	if e.size > c.disk.maxBytes {
+		delete(c.spilling, e.id)
+		c.Unlock()
+
+		return
+	}
+
+	c.Unlock()
+
+	tmp, err := c.writeTemp(e)
+
+	c.Lock()
+
+	if c.spilling[e.id] != e || err != nil {
+		if c.spilling[e.id] == e {
+			delete(c.spilling, e.id)
+		}
+
+		c.Unlock()
+
+		if err == nil {
+			os.Remove(tmp)
+		}
+
+		return
+	}
+
+	delete(c.spilling, e.id)
+
+	if err := os.Rename(tmp, c.path(e.id)); err != nil {
+		c.Unlock()
+		os.Remove(tmp)
+
+		return
+	}
+
+	dropped := c.disk.add(&entry{id: e.id, size: e.size})
+
+	c.Unlock()
+
+	for _, d := range dropped {
+		os.Remove(c.path(d.id))
+	}
+}
+
+func (c *Cache) writeTemp(e *entry) (string, error) {
+	file, err := os.CreateTemp(c.dir, filepath.Base(e.id)+"-*"+chunkSuffix+tmpSuffix)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = file.Write(e.buf)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+func (c *Cache) path(id string) string {
+	return filepath.Join(c.dir, filepath.Base(id)+chunkSuffix)
+}
+
+type entry struct {
+	id   string
+	size int64
+	buf  []byte
+}
+
+// lru keeps entries in the order of use, the most recent first.
+type lru struct {
+	maxBytes int64
+	size     int64
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+func newLRU(maxBytes int64) lru {
+	return lru{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+func (l *lru) get(id string) (*entry, bool) {
+	el, ok := l.items[id]
+	if !ok {
+		return nil, false
+	}
+
+	l.ll.MoveToFront(el)
+
+	return el.Value.(*entry), true
+}
+
+// add inserts an entry and returns entries evicted to fit it. An entry larger
+// than the limit is evicted right away.
+func (l *lru) add(e *entry) []*entry {
+	if e.size > l.maxBytes {
+		return []*entry{e}
+	}
+
+	l.remove(e.id)
+
+	l.items[e.id] = l.ll.PushFront(e)
+	l.size += e.size
+
+	return l.evict()
+}
+
+// resize changes the limit and returns entries evicted to fit it.
+func (l *lru) resize(maxBytes int64) []*entry {
+	l.maxBytes = maxBytes
+
+	return l.evict()
+}
+
+// evict removes the least recently used entries until the size fits the
+// limit and returns them.
+func (l *lru) evict() []*entry {
+	var evicted []*entry
+
+	for l.size > l.maxBytes {
+		el := l.ll.Back()
+		old := el.Value.(*entry)
+
+		l.ll.Remove(el)
+		delete(l.items, old.id)
+		l.size -= old.size
+
+		evicted = append(evicted, old)
+	}
+
+	return evicted
+}
+
+func (l *lru) remove(id string) (*entry, bool) {
+	el, ok := l.items[id]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+
+	l.ll.Remove(el)
+	delete(l.items, id)
+	l.size -= e.size
+
+	return e, true
+}
@@ -0,0 +1,207 @@
+package chunkcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_LRU(t *testing.T) {
+	c, err := New(Config{MaxBytes: 10})
+	require.NoError(t, err)
+
+	c.Add("a", []byte("aaaa"))
+	c.Add("b", []byte("bbbb"))
+
+	// a becomes the most recently used one, so b is evicted.
+	buf, ok := c.Get("a")
+	require.True(t, ok)
+	require.Equal(t, "aaaa", string(buf))
+
+	c.Add("c", []byte("cccc"))
+
+	_, ok = c.Get("b")
+	require.False(t, ok)
+
+	_, ok = c.Get("c")
+	require.True(t, ok)
+
+	// Chunks larger than the cache are not kept.
+	c.Add("d", []byte("ddddddddddd"))
+
+	_, ok = c.Get("d")
+	require.False(t, ok)
+
+	c.Remove("a")
+
+	_, ok = c.Get("a")
+	require.False(t, ok)
+
+	require.Equal(t, Stats{
+		Hits:     2,
+		Misses:   3,
+		HitRatio: 0.4,
+		Bytes:    4,
+		Entries:  1,
+	}, c.Stats())
+}
+
+func TestCache_Spill(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+
+	c, err := New(Config{MaxBytes: 4, Dir: dir, MaxDiskBytes: 8})
+	require.NoError(t, err)
+
+	c.Add("a", []byte("aaaa"))
+	c.Add("b", []byte("bbbb"))
+	c.Add("c", []byte("cccc"))
+
+	// a and b are spilled to the disk.
+	for _, id := range []string{"a", "b", "c"} {
+		buf, ok := c.Get(id)
+		require.True(t, ok, id)
+		require.Equal(t, id+id+id+id, string(buf))
+	}
+
+	// c is spilled to the disk as well and a, the least recently used chunk
+	// there, is dropped.
+	c.Add("d", []byte("dddd"))
+
+	_, ok := c.Get("a")
+	require.False(t, ok)
+
+	_, err = os.Stat(c.path("a"))
+	require.True(t, os.IsNotExist(err))
+
+	stats := c.Stats()
+	require.Equal(t, int64(4), stats.Bytes)
+	require.Equal(t, int64(8), stats.DiskBytes)
+	require.Equal(t, 2, stats.DiskEntries)
+
+	// Removed chunks are deleted from the disk.
+	c.Remove("b")
+
+	_, err = os.Stat(c.path("b"))
+	require.True(t, os.IsNotExist(err))
+
+	_, ok = c.Get("b")
+	require.False(t, ok)
+
+	// A lost file is a miss.
+	require.NoError(t, os.Remove(c.path("c")))
+
+	_, ok = c.Get("c")
+	require.False(t, ok)
+	require.Equal(t, 0, c.Stats().DiskEntries)
+}
+
+func TestCache_Resize(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+
+	c, err := New(Config{MaxBytes: 8, Dir: dir, MaxDiskBytes: 8})
+	require.NoError(t, err)
+
+	c.Add("a", []byte("aaaa"))
+	c.Add("b", []byte("bbbb"))
+
+	// a, the least recently used chunk, is spilled to the disk.
+	c.Resize(4, 8)
+
+	stats := c.Stats()
+	require.Equal(t, int64(4), stats.Bytes)
+	require.Equal(t, int64(4), stats.DiskBytes)
+
+	_, err = os.Stat(c.path("a"))
+	require.NoError(t, err)
+
+	// It is dropped once the disk limit shrinks.
+	c.Resize(4, 0)
+
+	_, err = os.Stat(c.path("a"))
+	require.True(t, os.IsNotExist(err))
+
+	// Larger limits keep more chunks.
+	c.Resize(8, 0)
+	c.Add("c", []byte("cccc"))
+
+	for _, id := range []string{"b", "c"} {
+		_, ok := c.Get(id)
+		require.True(t, ok, id)
+	}
+}
+
+func TestCache_Dir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+
+	c, err := New(Config{MaxBytes: 4, Dir: dir, MaxDiskBytes: 8})
+	require.NoError(t, err)
+
+	c.Add("a", []byte("aaaa"))
+	c.Add("b", []byte("bbbb"))
+
+	other := filepath.Join(dir, "notes.txt")
+	require.NoError(t, os.WriteFile(other, []byte("keep"), 0o600))
+
+	// Only chunks spilled by the cache are removed on start.
+	_, err = New(Config{MaxBytes: 4, Dir: dir, MaxDiskBytes: 8})
+	require.NoError(t, err)
+
+	_, err = os.Stat(c.path("a"))
+	require.True(t, os.IsNotExist(err))
+
+	_, err = os.Stat(other)
+	require.NoError(t, err)
+
+	// A dir with files of someone else is refused.
+	foreign := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(foreign, "a.chunk"), nil, 0o600))
+
+	_, err = New(Config{Dir: foreign})
+	require.ErrorIs(t, err, ErrForeignDir)
+
+	_, err = os.Stat(filepath.Join(foreign, "a.chunk"))
+	require.NoError(t, err)
+}
+
+func TestCache_RemoveWhileSpilling(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+
+	c, err := New(Config{MaxBytes: 4, Dir: dir, MaxDiskBytes: 8})
+	require.NoError(t, err)
+
+	c.Add("a", []byte("aaaa"))
+
+	// a is evicted from memory by the add of b and removed before it is
+	// spilled, as if Remove ran concurrently with the spill.
+	c.Lock()
+	evicted := c.memory.add(&entry{id: "b", size: 4, buf: []byte("bbbb")})
+	c.startSpilling(evicted)
+	c.Unlock()
+
+	c.Remove("a")
+	c.spill(evicted)
+
+	_, ok := c.Get("a")
+	require.False(t, ok)
+
+	_, err = os.Stat(c.path("a"))
+	require.True(t, os.IsNotExist(err))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "only the marker is left")
+}
+
+func TestCache_Nil(t *testing.T) {
+	var c *Cache
+
+	c.Add("a", []byte("aaaa"))
+	c.Remove("a")
+	c.Resize(4, 4)
+
+	_, ok := c.Get("a")
+	require.False(t, ok)
+	require.Equal(t, Stats{}, c.Stats())
+}
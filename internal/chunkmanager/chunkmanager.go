@@ -2,59 +2,122 @@ package chunkmanager
 
 import (
 	"errors"
-	"log"
-	"simple-storage/internal/utils"
+	"log/slog"
+	"simple-storage/internal/logging"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var (
 	ErrAlreadyExist             = errors.New("file already exist")
 	ErrNotFound                 = errors.New("file not found")
 	ErrNoStorageServerAvailable = errors.New("no storage server available")
+	ErrNotEnoughStorageServers  = errors.New("not enough storage servers for replication")
+	ErrDeleteMarker             = errors.New("version is a delete marker")
 )
 
 type Chunk struct {
 	ID            string
 	StorageServer string
+	Replicas      []string
+	// Checksum is CRC32C of the chunk as it is stored.
+	Checksum uint32
+	// Codec is the compression codec of the chunk, empty if it is stored raw.
+	Codec string
+	// StoredSize is the size of the chunk as it is stored.
+	StoredSize int
+}
+
+// StorageServers returns addresses of all storage servers keeping the chunk,
+// the primary one first.
+func (c Chunk) StorageServers() []string {
+	return append([]string{c.StorageServer}, c.Replicas...)
 }
 
 type storageServer struct {
 	address        string
 	numberOfChunks int
+	bytes          int64
 }
 
-type file struct {
-	chunks []Chunk
-	size   int64
+// Metadata describes the content of a file for clients.
+type Metadata struct {
+	ContentType        string
+	ContentDisposition string
+	CacheControl       string
+	// User keeps custom metadata of the file.
+	User map[string]string
+}
+
+type File struct {
+	Chunks   []Chunk
+	Size     int64
+	ETag     string
+	Created  time.Time
+	Metadata Metadata
+	// WrappedKey is the encrypted data key of the file chunks, nil if the
+	// chunks are stored in plaintext.
+	WrappedKey []byte
+	// MasterKeyID identifies the master key wrapping the data key.
+	MasterKeyID string
+	// CustomerKeyMD5 identifies the customer key wrapping the data key,
+	// empty if it is wrapped by the master key.
+	CustomerKeyMD5 string
+	// VersionID identifies the version of the file.
+	VersionID string
+	// DeleteMarker is set on versions written by deleting a file from a
+	// bucket with versioning enabled. They have no content.
+	DeleteMarker bool
 }
 
 type ChunkManager struct {
-	log                    *log.Logger
+	log                    *slog.Logger
 	config                 Config
 	storageServerByAddress map[string]struct{} // address
 	storageServers         []storageServer
-	files                  map[string]file
+	// files keeps versions of every file, the current one last.
+	files map[string][]File
+	// index keeps names of files whose current version is not a delete
+	// marker.
+	index      nameIndex
+	versioning map[string]bool // bucket
 	sync.Mutex
 }
 
 type Config struct {
 	MaxChunkSizeBytes     int
 	ErasureCodingFraction int
+	// ReplicationFactor is how many storage servers keep each chunk.
+	// Zero means one.
+	ReplicationFactor int
+	// Available reports whether chunks may be placed on the storage server,
+	// all storage servers are available if it is nil.
+	Available func(address string) bool
+	// Registerer receives metrics of storage servers, they are not exported
+	// if it is nil.
+	Registerer prometheus.Registerer
 }
 
-func New(log *log.Logger, config Config) *ChunkManager {
-	log = utils.LoggerExtendWithPrefix(log, "chunk-manager ->")
+func New(log *slog.Logger, config Config) *ChunkManager {
+	log = logging.Component(log, "chunk-manager")
 
-	return &ChunkManager{
+	cm := &ChunkManager{
 		log:                    log,
 		config:                 config,
 		storageServerByAddress: make(map[string]struct{}),
-		files:                  make(map[string]file),
+		files:                  make(map[string][]File),
+		versioning:             make(map[string]bool),
+	}
+
+	if config.Registerer != nil {
+		config.Registerer.MustRegister(collector{cm: cm})
 	}
 
+	return cm
 }
 
 func (cm *ChunkManager) RegisterStorageServer(address string) error {
@@ -68,68 +131,376 @@ func (cm *ChunkManager) RegisterStorageServer(address string) error {
 			numberOfChunks: 0,
 		})
 
-		cm.log.Printf("Register new storage server %s new ss table %v",
-			address, cm.storageServerByAddress)
+		cm.log.Info("register new storage server",
+			logging.StorageServer(address),
+			slog.Int("storage_servers", len(cm.storageServerByAddress)))
 	}
 
 	return nil
 }
 
+// SplitIntoChunks places chunks of a file about to be uploaded. The conditions
+// are checked early here, but only CommitFile checks them authoritatively.
 func (cm *ChunkManager) SplitIntoChunks(
-	filename string, filesize int64,
+	filename string, filesize int64, cond Conditions,
 ) ([]Chunk, error) {
 	cm.Lock()
 	defer cm.Unlock()
 
-	if _, ok := cm.files[filename]; ok {
-		return nil, ErrAlreadyExist
+	if err := cm.checkWrite(filename, cond); err != nil {
+		return nil, err
 	}
 
-	if len(cm.storageServers) == 0 {
-		return nil, ErrNoStorageServerAvailable
+	if err := cm.checkStorageServers(); err != nil {
+		return nil, err
 	}
 
-	sort.Slice(cm.storageServers, func(i, j int) bool {
-		return cm.storageServers[i].numberOfChunks < cm.storageServers[j].numberOfChunks
-	})
-
 	var (
 		cChunk = numberOfChunks(filesize, cm.config.ErasureCodingFraction, cm.config.MaxChunkSizeBytes)
-		chunks = make([]Chunk, 0, cChunk)
-		j      = 0
+		chunks = cm.placeChunks(cChunk)
 	)
 
-	for i := 0; i < cChunk; i++ {
-		chunks = append(chunks, Chunk{
-			ID:            uuid.New().String(),
-			StorageServer: cm.storageServers[j].address,
-		})
+	cm.log.Debug("split object into chunks", logging.Object(filename),
+		slog.Int64("size", filesize), slog.Int("chunks", len(chunks)))
+
+	return chunks, nil
+}
+
+// NumberOfChunks returns how many chunks a file of the given size is split into.
+func (cm *ChunkManager) NumberOfChunks(filesize int64) int {
+	return numberOfChunks(
+		filesize, cm.config.ErasureCodingFraction, cm.config.MaxChunkSizeBytes)
+}
+
+// PlaceChunk chooses a storage server for a single chunk.
+func (cm *ChunkManager) PlaceChunk() (Chunk, error) {
+	cm.Lock()
+	defer cm.Unlock()
+
+	if err := cm.checkStorageServers(); err != nil {
+		return Chunk{}, err
+	}
+
+	return cm.placeChunks(1)[0], nil
+}
+
+// CommitFile makes a file available once all its chunks are uploaded. If
+// versioning is enabled for the bucket of the file, the file becomes its new
+// current version. The committed version is returned.
+func (cm *ChunkManager) CommitFile(
+	filename string, file File, cond Conditions,
+) (File, error) {
+	cm.Lock()
+	defer cm.Unlock()
+
+	if err := cm.checkWrite(filename, cond); err != nil {
+		return File{}, err
+	}
+
+	if file.Created.IsZero() {
+		file.Created = time.Now()
+	}
+
+	file.VersionID = uuid.New().String()
+	file.DeleteMarker = false
+
+	cm.files[filename] = append(cm.files[filename], file)
+	cm.index.insert(filename)
+
+	for _, chunk := range file.Chunks {
+		cm.account(chunk, 0, int64(chunk.StoredSize))
+	}
+
+	cm.log.Info("commit object", logging.Object(filename),
+		slog.Int64("size", file.Size), slog.String("version_id", file.VersionID),
+		slog.Int("chunks", len(file.Chunks)))
+
+	return file, nil
+}
+
+// ReleaseChunks forgets placed chunks that will never be committed.
+func (cm *ChunkManager) ReleaseChunks(chunks []Chunk) {
+	cm.Lock()
+	defer cm.Unlock()
+
+	for _, chunk := range chunks {
+		cm.account(chunk, -1, 0)
+	}
+}
 
-		cm.storageServers[j].numberOfChunks++
+// DeleteFile deletes a file. If versioning is enabled for the bucket of the
+// file, a delete marker becomes its current version and is returned.
+// Otherwise the file is forgotten with all its versions, which are returned
+// so their chunks can be reclaimed from storage servers.
+func (cm *ChunkManager) DeleteFile(
+	filename string, cond Conditions,
+) (File, []File, error) {
+	cm.Lock()
+	defer cm.Unlock()
+
+	file, exists := cm.current(filename)
+
+	if err := cond.check(file, exists, false); err != nil {
+		return File{}, nil, err
+	}
 
-		j++
+	if !exists {
+		return File{}, nil, ErrNotFound
+	}
 
-		if j >= len(cm.storageServers) {
-			j = 0
+	if cm.versioning[Bucket(filename)] {
+		marker := File{
+			Created:      time.Now(),
+			VersionID:    uuid.New().String(),
+			DeleteMarker: true,
 		}
+
+		cm.files[filename] = append(cm.files[filename], marker)
+		cm.index.remove(filename)
+
+		cm.log.Info("delete object", logging.Object(filename),
+			slog.String("delete_marker", marker.VersionID))
+
+		return marker, nil, nil
 	}
 
-	cm.files[filename] = file{chunks: chunks, size: filesize}
+	return File{}, cm.destroy(filename), nil
+}
+
+// DestroyFile forgets a file with all its versions and delete markers
+// regardless of versioning, and returns them, so their chunks can be
+// reclaimed from storage servers.
+func (cm *ChunkManager) DestroyFile(filename string) ([]File, error) {
+	cm.Lock()
+	defer cm.Unlock()
 
-	cm.log.Printf("Split %s [%d] into %d chunks", filename, filesize, len(chunks))
+	if _, ok := cm.files[filename]; !ok {
+		return nil, ErrNotFound
+	}
 
-	return chunks, nil
+	return cm.destroy(filename), nil
 }
 
-func (cm *ChunkManager) ChunksInfo(filename string) ([]Chunk, int64, error) {
+// UpdateFile changes every version of a file in place, delete markers aside.
+// The update is applied under the chunk manager lock and all changes are
+// discarded if it returns an error for any version.
+func (cm *ChunkManager) UpdateFile(
+	filename string, update func(file *File) error,
+) error {
 	cm.Lock()
 	defer cm.Unlock()
 
-	file, ok := cm.files[filename]
+	versions, ok := cm.files[filename]
+	if !ok {
+		return ErrNotFound
+	}
+
+	updated := append([]File(nil), versions...)
+
+	for i := range updated {
+		if updated[i].DeleteMarker {
+			continue
+		}
 
+		if err := update(&updated[i]); err != nil {
+			return err
+		}
+	}
+
+	cm.files[filename] = updated
+
+	return nil
+}
+
+// Filenames returns names of all files having any versions in
+// lexicographical order.
+func (cm *ChunkManager) Filenames() []string {
+	cm.Lock()
+	defer cm.Unlock()
+
+	filenames := make([]string, 0, len(cm.files))
+	for filename := range cm.files {
+		filenames = append(filenames, filename)
+	}
+
+	sort.Strings(filenames)
+
+	return filenames
+}
+
+// FileInfo returns the current version of a file.
+func (cm *ChunkManager) FileInfo(filename string) (File, error) {
+	cm.Lock()
+	defer cm.Unlock()
+
+	file, ok := cm.current(filename)
 	if !ok {
-		return nil, 0, ErrNotFound
+		return File{}, ErrNotFound
+	}
+
+	return file, nil
+}
+
+// current returns the current version of a file and reports whether it
+// exists and is not a delete marker. It expects the lock to be held.
+func (cm *ChunkManager) current(filename string) (File, bool) {
+	versions, ok := cm.files[filename]
+	if !ok || versions[len(versions)-1].DeleteMarker {
+		return File{}, false
+	}
+
+	return versions[len(versions)-1], true
+}
+
+// checkWrite reports whether a new version of a file can be written. It
+// expects the lock to be held.
+func (cm *ChunkManager) checkWrite(filename string, cond Conditions) error {
+	file, exists := cm.current(filename)
+
+	if err := cond.check(file, exists, false); err != nil {
+		return err
+	}
+
+	if exists && !cm.versioning[Bucket(filename)] {
+		return ErrAlreadyExist
+	}
+
+	return nil
+}
+
+// destroy forgets a file with all its versions and returns them. It expects
+// the lock to be held.
+func (cm *ChunkManager) destroy(filename string) []File {
+	versions := cm.files[filename]
+
+	delete(cm.files, filename)
+	cm.index.remove(filename)
+
+	for _, file := range versions {
+		for _, chunk := range file.Chunks {
+			cm.account(chunk, -1, -int64(chunk.StoredSize))
+		}
+	}
+
+	cm.log.Info("delete object with all versions", logging.Object(filename),
+		slog.Int("versions", len(versions)))
+
+	return versions
+}
+
+// account changes the load of storage servers keeping a chunk. It expects the
+// lock to be held.
+func (cm *ChunkManager) account(chunk Chunk, chunks int, bytes int64) {
+	for _, address := range chunk.StorageServers() {
+		for i := range cm.storageServers {
+			if cm.storageServers[i].address == address {
+				cm.storageServers[i].numberOfChunks += chunks
+				cm.storageServers[i].bytes += bytes
+			}
+		}
+	}
+}
+
+// StorageServerAddresses returns addresses of registered storage servers.
+func (cm *ChunkManager) StorageServerAddresses() []string {
+	cm.Lock()
+	defer cm.Unlock()
+
+	addresses := make([]string, 0, len(cm.storageServers))
+	for _, ss := range cm.storageServers {
+		addresses = append(addresses, ss.address)
+	}
+
+	return addresses
+}
+
+func (cm *ChunkManager) replicationFactor() int {
+	if cm.config.ReplicationFactor < 1 {
+		return 1
+	}
+
+	return cm.config.ReplicationFactor
+}
+
+// Ready returns an error unless enough storage servers are available to
+// place chunks with all their replicas.
+func (cm *ChunkManager) Ready() error {
+	cm.Lock()
+	defer cm.Unlock()
+
+	return cm.checkStorageServers()
+}
+
+// checkStorageServers reports whether chunks can be placed. It expects the
+// lock to be held.
+func (cm *ChunkManager) checkStorageServers() error {
+	available := cm.availableStorageServers()
+
+	switch {
+	case len(available) == 0:
+		return ErrNoStorageServerAvailable
+	case len(available) < cm.replicationFactor():
+		return ErrNotEnoughStorageServers
+	}
+
+	return nil
+}
+
+// availableStorageServers returns indexes of storage servers chunks may be
+// placed on. It expects the lock to be held.
+func (cm *ChunkManager) availableStorageServers() []int {
+	available := make([]int, 0, len(cm.storageServers))
+
+	for i, ss := range cm.storageServers {
+		if cm.config.Available == nil || cm.config.Available(ss.address) {
+			available = append(available, i)
+		}
+	}
+
+	return available
+}
+
+// placeChunks distributes cChunk new chunks and their replicas between
+// available storage servers starting from the one keeping the fewest bytes.
+// It expects the lock to be held and checkStorageServers to have succeeded.
+func (cm *ChunkManager) placeChunks(cChunk int) []Chunk {
+	sort.Slice(cm.storageServers, func(i, j int) bool {
+		if cm.storageServers[i].bytes != cm.storageServers[j].bytes {
+			return cm.storageServers[i].bytes < cm.storageServers[j].bytes
+		}
+
+		return cm.storageServers[i].numberOfChunks < cm.storageServers[j].numberOfChunks
+	})
+
+	var (
+		available = cm.availableStorageServers()
+		chunks    = make([]Chunk, 0, cChunk)
+		j         = 0
+	)
+
+	for i := 0; i < cChunk; i++ {
+		chunk := Chunk{ID: uuid.New().String()}
+
+		for r := 0; r < cm.replicationFactor(); r++ {
+			ss := &cm.storageServers[available[j]]
+
+			if r == 0 {
+				chunk.StorageServer = ss.address
+			} else {
+				chunk.Replicas = append(chunk.Replicas, ss.address)
+			}
+
+			ss.numberOfChunks++
+
+			j++
+
+			if j >= len(available) {
+				j = 0
+			}
+		}
+
+		chunks = append(chunks, chunk)
 	}
 
-	return file.chunks, file.size, nil
+	return chunks
 }
@@ -1,7 +1,7 @@
 package chunkmanager
 
 import (
-	"log"
+	"log/slog"
 	"math"
 	"testing"
 
@@ -30,7 +30,7 @@ func TestChunkManager_RegisterStorageServer(t *testing.T) {
 		},
 	}
 
-	cm := New(log.Default(), Config{})
+	cm := New(slog.Default(), Config{})
 
 	for _, tc := range tt {
 		for _, address := range tc.addresses {
@@ -114,7 +114,7 @@ func TestChunkManager_SplitIntoChunks_SimpleDistribution(t *testing.T) {
 	}
 
 	for _, tc := range tt {
-		cm := New(log.Default(), Config{
+		cm := New(slog.Default(), Config{
 			MaxChunkSizeBytes:     tc.maxChunkSizeBytes,
 			ErasureCodingFraction: tc.erasureCodingFraction,
 		})
@@ -124,7 +124,7 @@ func TestChunkManager_SplitIntoChunks_SimpleDistribution(t *testing.T) {
 			require.NoError(t, err)
 		}
 
-		chunks, err := cm.SplitIntoChunks(tc.filename, tc.filesize)
+		chunks, err := cm.SplitIntoChunks(tc.filename, tc.filesize, Conditions{})
 		require.NoError(t, err)
 		require.Equal(t, tc.cChunk, len(chunks))
 
@@ -173,7 +173,7 @@ func TestChunkManager_SplitIntoChunks_ConsistentDistribution(t *testing.T) {
 	}
 
 	for _, tc := range tt {
-		cm := New(log.Default(), Config{
+		cm := New(slog.Default(), Config{
 			MaxChunkSizeBytes:     tc.maxChunkSizeBytes,
 			ErasureCodingFraction: tc.erasureCodingFraction,
 		})
@@ -183,7 +183,7 @@ func TestChunkManager_SplitIntoChunks_ConsistentDistribution(t *testing.T) {
 			require.NoError(t, err)
 		}
 
-		chunks, err := cm.SplitIntoChunks(tc.firstFilename, tc.firstFilesize)
+		chunks, err := cm.SplitIntoChunks(tc.firstFilename, tc.firstFilesize, Conditions{})
 		require.NoError(t, err)
 
 		distribution := make(map[string]int, len(chunks))
@@ -192,7 +192,7 @@ func TestChunkManager_SplitIntoChunks_ConsistentDistribution(t *testing.T) {
 		}
 		require.Equal(t, tc.firstDistributionChunk, distribution)
 
-		chunks, err = cm.SplitIntoChunks(tc.secondFilename, tc.secondFilesize)
+		chunks, err = cm.SplitIntoChunks(tc.secondFilename, tc.secondFilesize, Conditions{})
 		require.NoError(t, err)
 
 		distribution = make(map[string]int, len(chunks))
@@ -202,3 +202,155 @@ func TestChunkManager_SplitIntoChunks_ConsistentDistribution(t *testing.T) {
 		require.Equal(t, tc.secondDistributionChunk, distribution)
 	}
 }
+
+func TestChunkManager_SplitIntoChunks_Replication(t *testing.T) {
+	tt := []struct {
+		storageServers        []string
+		filename              string
+		filesize              int64
+		maxChunkSizeBytes     int
+		erasureCodingFraction int
+		replicationFactor     int
+		err                   error
+		distributionChunk     map[string]int
+	}{
+		{
+			storageServers: []string{
+				"0.0.0.0:9091",
+				"0.0.0.0:9092",
+				"0.0.0.0:9093",
+			},
+			maxChunkSizeBytes:     int(math.MaxInt64),
+			erasureCodingFraction: 3,
+			replicationFactor:     2,
+			filename:              "file1",
+			filesize:              99,
+			distributionChunk: map[string]int{
+				"0.0.0.0:9091": 2,
+				"0.0.0.0:9092": 2,
+				"0.0.0.0:9093": 2,
+			},
+		},
+		{
+			storageServers: []string{
+				"0.0.0.0:9091",
+			},
+			maxChunkSizeBytes:     int(math.MaxInt64),
+			erasureCodingFraction: 2,
+			replicationFactor:     2,
+			filename:              "file1",
+			filesize:              100,
+			err:                   ErrNotEnoughStorageServers,
+		},
+	}
+
+	for _, tc := range tt {
+		cm := New(slog.Default(), Config{
+			MaxChunkSizeBytes:     tc.maxChunkSizeBytes,
+			ErasureCodingFraction: tc.erasureCodingFraction,
+			ReplicationFactor:     tc.replicationFactor,
+		})
+
+		for _, ss := range tc.storageServers {
+			err := cm.RegisterStorageServer(ss)
+			require.NoError(t, err)
+		}
+
+		chunks, err := cm.SplitIntoChunks(tc.filename, tc.filesize, Conditions{})
+		require.ErrorIs(t, err, tc.err)
+
+		if tc.err != nil {
+			continue
+		}
+
+		distribution := make(map[string]int, len(chunks))
+		for _, chunk := range chunks {
+			servers := chunk.StorageServers()
+			require.Len(t, servers, tc.replicationFactor)
+
+			for _, address := range servers {
+				distribution[address]++
+			}
+		}
+		require.Equal(t, tc.distributionChunk, distribution)
+	}
+}
+
+func TestChunkManager_PlaceChunk_StoredSizeAccounting(t *testing.T) {
+	cm := New(slog.Default(), Config{})
+
+	for _, ss := range []string{"0.0.0.0:9091", "0.0.0.0:9092"} {
+		err := cm.RegisterStorageServer(ss)
+		require.NoError(t, err)
+	}
+
+	big, err := cm.PlaceChunk()
+	require.NoError(t, err)
+	big.StoredSize = 1000
+
+	small, err := cm.PlaceChunk()
+	require.NoError(t, err)
+	small.StoredSize = 10
+
+	_, err = cm.CommitFile("file1", File{Chunks: []Chunk{big, small}, Size: 1010}, Conditions{})
+	require.NoError(t, err)
+
+	chunk, err := cm.PlaceChunk()
+	require.NoError(t, err)
+	require.Equal(t, small.StorageServer, chunk.StorageServer)
+}
+
+func TestChunkManager_PlaceChunk_Available(t *testing.T) {
+	unavailable := map[string]bool{"0.0.0.0:9091": true}
+
+	cm := New(slog.Default(), Config{
+		ReplicationFactor: 2,
+		Available:         func(address string) bool { return !unavailable[address] },
+	})
+
+	for _, ss := range []string{"0.0.0.0:9091", "0.0.0.0:9092", "0.0.0.0:9093"} {
+		err := cm.RegisterStorageServer(ss)
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < 4; i++ {
+		chunk, err := cm.PlaceChunk()
+		require.NoError(t, err)
+		require.NotEqual(t, "0.0.0.0:9091", chunk.StorageServer)
+		require.NotContains(t, chunk.Replicas, "0.0.0.0:9091")
+	}
+
+	unavailable["0.0.0.0:9092"] = true
+
+	_, err := cm.PlaceChunk()
+	require.ErrorIs(t, err, ErrNotEnoughStorageServers)
+}
+
+func TestChunkManager_Ready(t *testing.T) {
+	unavailable := map[string]bool{}
+
+	cm := New(slog.Default(), Config{
+		ReplicationFactor: 2,
+		Available:         func(address string) bool { return !unavailable[address] },
+	})
+
+	require.ErrorIs(t, cm.Ready(), ErrNoStorageServerAvailable)
+
+	for _, ss := range []string{"0.0.0.0:9091", "0.0.0.0:9092"} {
+		err := cm.RegisterStorageServer(ss)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, cm.Ready())
+
+	unavailable["0.0.0.0:9091"] = true
+
+	require.ErrorIs(t, cm.Ready(), ErrNotEnoughStorageServers)
+
+	stats := cm.StorageServers()
+	require.Len(t, stats, 2)
+
+	for _, s := range stats {
+		require.Equal(t, s.Address != "0.0.0.0:9091", s.Alive)
+	}
+}
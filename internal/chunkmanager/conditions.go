@@ -0,0 +1,98 @@
+package chunkmanager
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrNotModified        = errors.New("not modified")
+)
+
+// AnyETag matches any existing file in Conditions.
+const AnyETag = "*"
+
+// Conditions make reading or changing a file depend on its current state.
+// They are evaluated under the chunk manager lock together with the
+// operation, so concurrent writers cannot interleave in between.
+type Conditions struct {
+	// IfMatch requires the file to exist with one of the ETags.
+	IfMatch []string
+	// IfNoneMatch requires the file not to exist with any of the ETags.
+	IfNoneMatch []string
+	// IfModifiedSince requires the file to be created after the time. It is
+	// ignored if IfNoneMatch is set.
+	IfModifiedSince time.Time
+}
+
+// check evaluates conditions against a file, exists is false if there is no
+// such file. A failed condition is reported as ErrNotModified for reads and as
+// ErrPreconditionFailed for writes, except failed IfMatch that is always
+// ErrPreconditionFailed.
+func (c Conditions) check(file File, exists, read bool) error {
+	failed := ErrPreconditionFailed
+	if read {
+		failed = ErrNotModified
+	}
+
+	if len(c.IfMatch) > 0 && (!exists || !matchETag(c.IfMatch, file.ETag)) {
+		return ErrPreconditionFailed
+	}
+
+	if len(c.IfNoneMatch) > 0 {
+		if exists && matchETag(c.IfNoneMatch, file.ETag) {
+			return failed
+		}
+
+		return nil
+	}
+
+	if !c.IfModifiedSince.IsZero() && exists &&
+		!file.Created.Truncate(time.Second).After(c.IfModifiedSince) {
+		return failed
+	}
+
+	return nil
+}
+
+func matchETag(etags []string, etag string) bool {
+	for _, e := range etags {
+		if e == AnyETag || e == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StatFile returns a version of a file, the current one if versionID is
+// empty, if the conditions hold. The file is returned with ErrNotModified
+// too, so clients can be told which version they already have.
+func (cm *ChunkManager) StatFile(
+	filename, versionID string, cond Conditions,
+) (File, error) {
+	cm.Lock()
+	defer cm.Unlock()
+
+	file, exists := cm.current(filename)
+
+	if versionID != "" {
+		i, err := cm.version(filename, versionID)
+		if err != nil {
+			return File{}, err
+		}
+
+		file, exists = cm.files[filename][i], true
+	}
+
+	if err := cond.check(file, exists, true); err != nil {
+		return file, err
+	}
+
+	if !exists {
+		return File{}, ErrNotFound
+	}
+
+	return file, nil
+}
@@ -0,0 +1,90 @@
+package chunkmanager
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkManager_Conditions(t *testing.T) {
+	cm := New(slog.Default(), Config{})
+
+	err := cm.RegisterStorageServer("0.0.0.0:9091")
+	require.NoError(t, err)
+
+	cm.SetVersioning("jobs", true)
+
+	createOnly := Conditions{IfNoneMatch: []string{AnyETag}}
+
+	// Create-only writes succeed exactly once.
+	chunks, err := cm.SplitIntoChunks("jobs/output", 1, createOnly)
+	require.NoError(t, err)
+
+	created, err := cm.CommitFile("jobs/output", File{
+		Chunks: chunks, Size: 1, ETag: "etag1",
+		Created: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, createOnly)
+	require.NoError(t, err)
+
+	_, err = cm.SplitIntoChunks("jobs/output", 1, createOnly)
+	require.ErrorIs(t, err, ErrPreconditionFailed)
+
+	_, err = cm.CommitFile("jobs/output", File{ETag: "etag2"}, createOnly)
+	require.ErrorIs(t, err, ErrPreconditionFailed)
+
+	// Reads.
+	tt := []struct {
+		cond Conditions
+		err  error
+	}{
+		{cond: Conditions{}},
+		{cond: Conditions{IfMatch: []string{"etag1"}}},
+		{cond: Conditions{IfMatch: []string{"etag2"}}, err: ErrPreconditionFailed},
+		{cond: Conditions{IfNoneMatch: []string{"etag2", "etag1"}}, err: ErrNotModified},
+		{cond: Conditions{IfNoneMatch: []string{"etag2"}}},
+		{
+			cond: Conditions{IfModifiedSince: created.Created},
+			err:  ErrNotModified,
+		},
+		{cond: Conditions{IfModifiedSince: created.Created.Add(-time.Second)}},
+		{
+			cond: Conditions{
+				IfNoneMatch:     []string{"etag2"},
+				IfModifiedSince: created.Created,
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		file, err := cm.StatFile("jobs/output", "", tc.cond)
+		if tc.err != nil {
+			require.ErrorIs(t, err, tc.err)
+			continue
+		}
+
+		require.NoError(t, err)
+		require.Equal(t, created.VersionID, file.VersionID)
+	}
+
+	_, err = cm.StatFile("jobs/missing", "", Conditions{IfMatch: []string{AnyETag}})
+	require.ErrorIs(t, err, ErrPreconditionFailed)
+
+	_, err = cm.StatFile("jobs/missing", "", Conditions{})
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Deletes.
+	_, _, err = cm.DeleteFile("jobs/output", Conditions{IfMatch: []string{"etag2"}})
+	require.ErrorIs(t, err, ErrPreconditionFailed)
+
+	_, _, err = cm.DeleteFile("jobs/output", Conditions{IfModifiedSince: created.Created})
+	require.ErrorIs(t, err, ErrPreconditionFailed)
+
+	_, _, err = cm.DeleteFile("jobs/output", Conditions{IfMatch: []string{"etag1"}})
+	require.NoError(t, err)
+
+	// The name is free again once the file is deleted.
+	_, err = cm.CommitFile("jobs/output", File{ETag: "etag2"}, createOnly)
+	require.NoError(t, err)
+}
@@ -0,0 +1,171 @@
+package chunkmanager
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxListLimit bounds the number of entries returned by ListObjects.
+const MaxListLimit = 1000
+
+type ObjectInfo struct {
+	Name      string    `json:"name"`
+	VersionID string    `json:"version_id"`
+	Size      int64     `json:"size"`
+	Created   time.Time `json:"created"`
+	Chunks    int       `json:"chunks"`
+}
+
+type ListResult struct {
+	Objects        []ObjectInfo `json:"objects"`
+	CommonPrefixes []string     `json:"common_prefixes"`
+	IsTruncated    bool         `json:"is_truncated"`
+	// NextStartAfter continues a truncated listing.
+	NextStartAfter string `json:"next_start_after,omitempty"`
+}
+
+// ListObjects returns current versions of files with the given prefix in
+// lexicographical order starting after startAfter. If delimiter is set, files
+// whose names contain it after the prefix are rolled up into common prefixes.
+// Both files and common prefixes count towards limit.
+func (cm *ChunkManager) ListObjects(
+	prefix, delimiter, startAfter string, limit int,
+) ListResult {
+	cm.Lock()
+	defer cm.Unlock()
+
+	if limit <= 0 || limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+
+	res := ListResult{
+		Objects:        []ObjectInfo{},
+		CommonPrefixes: []string{},
+	}
+
+	i := cm.index.after(startAfter)
+	if j := cm.index.search(prefix); j > i {
+		i = j
+	}
+
+	// full marks the result truncated once an entry is found beyond limit,
+	// so that a listing ending exactly at limit is not truncated.
+	full := func() bool {
+		if len(res.Objects)+len(res.CommonPrefixes) < limit {
+			return false
+		}
+
+		res.IsTruncated = true
+
+		return true
+	}
+
+	for i < len(cm.index) && strings.HasPrefix(cm.index[i], prefix) {
+		name := cm.index[i]
+
+		if delimiter != "" {
+			if k := strings.Index(name[len(prefix):], delimiter); k >= 0 {
+				commonPrefix := name[:len(prefix)+k+len(delimiter)]
+
+				// A common prefix equal to startAfter has been returned by the
+				// previous page. The one startAfter falls into has names after
+				// startAfter and is returned.
+				if commonPrefix != startAfter {
+					if full() {
+						break
+					}
+
+					res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix)
+					res.NextStartAfter = commonPrefix
+				}
+
+				i = len(cm.index)
+
+				if next := prefixSuccessor(commonPrefix); next != "" {
+					i = cm.index.search(next)
+				}
+
+				continue
+			}
+		}
+
+		if full() {
+			break
+		}
+
+		versions := cm.files[name]
+		file := versions[len(versions)-1]
+
+		res.Objects = append(res.Objects, ObjectInfo{
+			Name:      name,
+			VersionID: file.VersionID,
+			Size:      file.Size,
+			Created:   file.Created,
+			Chunks:    len(file.Chunks),
+		})
+		res.NextStartAfter = name
+
+		i++
+	}
+
+	if !res.IsTruncated {
+		res.NextStartAfter = ""
+	}
+
+	return res
+}
+
+// nameIndex keeps file names sorted.
+type nameIndex []string
+
+// search returns the position of the first name not less than name.
+func (idx nameIndex) search(name string) int {
+	return sort.SearchStrings(idx, name)
+}
+
+// after returns the position of the first name greater than name.
+func (idx nameIndex) after(name string) int {
+	i := idx.search(name)
+
+	if i < len(idx) && idx[i] == name {
+		i++
+	}
+
+	return i
+}
+
+func (idx *nameIndex) insert(name string) {
+	i := idx.search(name)
+
+	if i < len(*idx) && (*idx)[i] == name {
+		return
+	}
+
+	*idx = append(*idx, "")
+	copy((*idx)[i+1:], (*idx)[i:])
+	(*idx)[i] = name
+}
+
+func (idx *nameIndex) remove(name string) {
+	i := idx.search(name)
+
+	if i < len(*idx) && (*idx)[i] == name {
+		*idx = append((*idx)[:i], (*idx)[i+1:]...)
+	}
+}
+
+// prefixSuccessor returns the smallest string greater than every string with
+// the given prefix, or an empty string if there is no such string.
+func prefixSuccessor(prefix string) string {
+	b := []byte(prefix)
+
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+
+	return ""
+}
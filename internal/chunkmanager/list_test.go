@@ -0,0 +1,139 @@
+package chunkmanager
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkManager_ListObjects(t *testing.T) {
+	filenames := []string{
+		"a.txt",
+		"logs/2022/01.log",
+		"logs/2022/02.log",
+		"logs/2023/01.log",
+		"logs/readme",
+		"z.txt",
+	}
+
+	tt := []struct {
+		prefix         string
+		delimiter      string
+		startAfter     string
+		limit          int
+		objects        []string
+		commonPrefixes []string
+		nextStartAfter string
+	}{
+		{
+			objects:        filenames,
+			commonPrefixes: []string{},
+		},
+		{
+			delimiter:      "/",
+			objects:        []string{"a.txt", "z.txt"},
+			commonPrefixes: []string{"logs/"},
+		},
+		{
+			prefix:         "logs/",
+			delimiter:      "/",
+			objects:        []string{"logs/readme"},
+			commonPrefixes: []string{"logs/2022/", "logs/2023/"},
+		},
+		{
+			prefix:         "logs/",
+			delimiter:      "/",
+			limit:          1,
+			objects:        []string{},
+			commonPrefixes: []string{"logs/2022/"},
+			nextStartAfter: "logs/2022/",
+		},
+		{
+			prefix:         "logs/",
+			delimiter:      "/",
+			startAfter:     "logs/2022/",
+			limit:          1,
+			objects:        []string{},
+			commonPrefixes: []string{"logs/2023/"},
+			nextStartAfter: "logs/2023/",
+		},
+		{
+			startAfter:     "logs/2022/02.log",
+			limit:          2,
+			objects:        []string{"logs/2023/01.log", "logs/readme"},
+			commonPrefixes: []string{},
+			nextStartAfter: "logs/readme",
+		},
+		{
+			prefix:         "logs/",
+			delimiter:      "/",
+			startAfter:     "logs/2022/01.log",
+			objects:        []string{"logs/readme"},
+			commonPrefixes: []string{"logs/2022/", "logs/2023/"},
+		},
+		{
+			delimiter:      "/",
+			startAfter:     "logs/2022/01.log",
+			limit:          2,
+			objects:        []string{"z.txt"},
+			commonPrefixes: []string{"logs/"},
+		},
+		{
+			prefix:         "logs/",
+			delimiter:      "/",
+			startAfter:     "logs/2023/",
+			limit:          1,
+			objects:        []string{"logs/readme"},
+			commonPrefixes: []string{},
+		},
+		{
+			startAfter:     "logs/readme",
+			limit:          1,
+			objects:        []string{"z.txt"},
+			commonPrefixes: []string{},
+		},
+		{
+			prefix:         "logs/2023/",
+			delimiter:      "/",
+			limit:          1,
+			objects:        []string{"logs/2023/01.log"},
+			commonPrefixes: []string{},
+		},
+		{
+			prefix:         "nothing",
+			objects:        []string{},
+			commonPrefixes: []string{},
+		},
+	}
+
+	cm := New(slog.Default(), Config{})
+
+	for i := len(filenames) - 1; i >= 0; i-- {
+		_, err := cm.CommitFile(filenames[i], File{
+			Chunks: []Chunk{{ID: filenames[i]}},
+			Size:   int64(i),
+		}, Conditions{})
+		require.NoError(t, err)
+	}
+
+	for _, tc := range tt {
+		res := cm.ListObjects(tc.prefix, tc.delimiter, tc.startAfter, tc.limit)
+
+		objects := []string{}
+		for _, object := range res.Objects {
+			objects = append(objects, object.Name)
+			require.Equal(t, 1, object.Chunks)
+			require.False(t, object.Created.IsZero())
+		}
+
+		require.Equal(t, tc.objects, objects)
+		require.Equal(t, tc.commonPrefixes, res.CommonPrefixes)
+		require.Equal(t, tc.nextStartAfter != "", res.IsTruncated)
+		require.Equal(t, tc.nextStartAfter, res.NextStartAfter)
+	}
+
+	_, _, err := cm.DeleteFile("a.txt", Conditions{})
+	require.NoError(t, err)
+	require.Equal(t, filenames[1:], cm.Filenames())
+}
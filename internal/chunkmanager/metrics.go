@@ -0,0 +1,61 @@
+package chunkmanager
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	storageServerChunksDesc = prometheus.NewDesc(
+		"simple_storage_storage_server_chunks",
+		"Chunks placed on the storage server.",
+		[]string{"storage_server"}, nil)
+	storageServerBytesDesc = prometheus.NewDesc(
+		"simple_storage_storage_server_bytes",
+		"Bytes of committed chunks kept by the storage server.",
+		[]string{"storage_server"}, nil)
+)
+
+// StorageServerStats describes chunks placed on a storage server.
+type StorageServerStats struct {
+	Address string `json:"address"`
+	// Alive reports whether chunks may be placed on the storage server.
+	Alive  bool  `json:"alive"`
+	Chunks int   `json:"chunks"`
+	Bytes  int64 `json:"bytes"`
+}
+
+// StorageServers returns stats of registered storage servers.
+func (cm *ChunkManager) StorageServers() []StorageServerStats {
+	cm.Lock()
+	defer cm.Unlock()
+
+	stats := make([]StorageServerStats, 0, len(cm.storageServers))
+
+	for _, ss := range cm.storageServers {
+		stats = append(stats, StorageServerStats{
+			Address: ss.address,
+			Alive:   cm.config.Available == nil || cm.config.Available(ss.address),
+			Chunks:  ss.numberOfChunks,
+			Bytes:   ss.bytes,
+		})
+	}
+
+	return stats
+}
+
+// collector exports stats of storage servers when metrics are gathered.
+type collector struct {
+	cm *ChunkManager
+}
+
+func (c collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- storageServerChunksDesc
+	ch <- storageServerBytesDesc
+}
+
+func (c collector) Collect(ch chan<- prometheus.Metric) {
+	for _, ss := range c.cm.StorageServers() {
+		ch <- prometheus.MustNewConstMetric(storageServerChunksDesc,
+			prometheus.GaugeValue, float64(ss.Chunks), ss.Address)
+		ch <- prometheus.MustNewConstMetric(storageServerBytesDesc,
+			prometheus.GaugeValue, float64(ss.Bytes), ss.Address)
+	}
+}
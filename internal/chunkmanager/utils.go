@@ -5,6 +5,10 @@ import (
 )
 
 func numberOfChunks(filesize int64, erasureCodingFraction, maxChunkSize int) int {
+	if filesize <= 0 {
+		return 0
+	}
+
 	chunkSize := int(math.Ceil(float64(filesize) / float64(erasureCodingFraction)))
 
 	if chunkSize < maxChunkSize {
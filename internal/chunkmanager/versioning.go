@@ -0,0 +1,104 @@
+package chunkmanager
+
+import (
+	"log/slog"
+	"simple-storage/internal/logging"
+	"strings"
+)
+
+// Bucket returns the bucket of a file, which is the part of its name before
+// the first slash. Files without a slash belong to the default bucket named
+// by an empty string.
+func Bucket(filename string) string {
+	if i := strings.IndexByte(filename, '/'); i >= 0 {
+		return filename[:i]
+	}
+
+	return ""
+}
+
+// SetVersioning enables or suspends versioning for a bucket. Suspending it
+// keeps existing versions, but uploading an existing file fails with
+// ErrAlreadyExist and deleting a file forgets all its versions again.
+func (cm *ChunkManager) SetVersioning(bucket string, enabled bool) {
+	cm.Lock()
+	defer cm.Unlock()
+
+	if enabled {
+		cm.versioning[bucket] = true
+	} else {
+		delete(cm.versioning, bucket)
+	}
+
+	cm.log.Info("set versioning of bucket",
+		slog.String("bucket", bucket), slog.Bool("enabled", enabled))
+}
+
+// Versioning reports whether versioning is enabled for a bucket.
+func (cm *ChunkManager) Versioning(bucket string) bool {
+	cm.Lock()
+	defer cm.Unlock()
+
+	return cm.versioning[bucket]
+}
+
+// Versions returns all versions of a file including delete markers, the
+// current one first.
+func (cm *ChunkManager) Versions(filename string) ([]File, error) {
+	cm.Lock()
+	defer cm.Unlock()
+
+	versions, ok := cm.files[filename]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	res := make([]File, len(versions))
+	for i, file := range versions {
+		res[len(versions)-1-i] = file
+	}
+
+	return res, nil
+}
+
+// RestoreVersion makes an older version of a file current again. The version
+// keeps its ID and content, newer versions stay in the history.
+func (cm *ChunkManager) RestoreVersion(filename, versionID string) (File, error) {
+	cm.Lock()
+	defer cm.Unlock()
+
+	i, err := cm.version(filename, versionID)
+	if err != nil {
+		return File{}, err
+	}
+
+	versions := cm.files[filename]
+	file := versions[i]
+
+	versions = append(versions[:i:i], versions[i+1:]...)
+	cm.files[filename] = append(versions, file)
+	cm.index.insert(filename)
+
+	cm.log.Info("restore object version", logging.Object(filename),
+		slog.String("version_id", versionID))
+
+	return file, nil
+}
+
+// version returns the position of a version of a file that is not a delete
+// marker. It expects the lock to be held.
+func (cm *ChunkManager) version(filename, versionID string) (int, error) {
+	for i, file := range cm.files[filename] {
+		if file.VersionID != versionID {
+			continue
+		}
+
+		if file.DeleteMarker {
+			return 0, ErrDeleteMarker
+		}
+
+		return i, nil
+	}
+
+	return 0, ErrNotFound
+}
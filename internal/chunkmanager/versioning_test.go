@@ -0,0 +1,99 @@
+package chunkmanager
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkManager_Versioning(t *testing.T) {
+	cm := New(slog.Default(), Config{})
+
+	err := cm.RegisterStorageServer("0.0.0.0:9091")
+	require.NoError(t, err)
+
+	commit := func(filename string, size int64) error {
+		chunks, err := cm.SplitIntoChunks(filename, size, Conditions{})
+		if err != nil {
+			return err
+		}
+
+		_, err = cm.CommitFile(filename, File{Chunks: chunks, Size: size}, Conditions{})
+
+		return err
+	}
+
+	require.Equal(t, "photos", Bucket("photos/cat.png"))
+	require.Equal(t, "", Bucket("cat.png"))
+
+	// Versioning is disabled by default.
+	require.NoError(t, commit("photos/cat.png", 1))
+	require.ErrorIs(t, commit("photos/cat.png", 2), ErrAlreadyExist)
+
+	cm.SetVersioning("photos", true)
+	require.True(t, cm.Versioning("photos"))
+	require.False(t, cm.Versioning(""))
+
+	require.NoError(t, commit("photos/cat.png", 2))
+	require.NoError(t, commit("photos/cat.png", 3))
+
+	versions, err := cm.Versions("photos/cat.png")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	require.Equal(t, int64(3), versions[0].Size)
+	require.Equal(t, int64(1), versions[2].Size)
+
+	file, err := cm.FileInfo("photos/cat.png")
+	require.NoError(t, err)
+	require.Equal(t, versions[0].VersionID, file.VersionID)
+
+	file, err = cm.StatFile("photos/cat.png", versions[2].VersionID, Conditions{})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), file.Size)
+
+	// Deleting writes a delete marker and keeps versions.
+	marker, removed, err := cm.DeleteFile("photos/cat.png", Conditions{})
+	require.NoError(t, err)
+	require.True(t, marker.DeleteMarker)
+	require.Empty(t, removed)
+
+	_, err = cm.FileInfo("photos/cat.png")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.Empty(t, cm.ListObjects("", "", "", 0).Objects)
+
+	_, err = cm.StatFile("photos/cat.png", marker.VersionID, Conditions{})
+	require.ErrorIs(t, err, ErrDeleteMarker)
+
+	_, _, err = cm.DeleteFile("photos/cat.png", Conditions{})
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Restoring makes an older version current again.
+	file, err = cm.RestoreVersion("photos/cat.png", versions[1].VersionID)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), file.Size)
+
+	file, err = cm.FileInfo("photos/cat.png")
+	require.NoError(t, err)
+	require.Equal(t, versions[1].VersionID, file.VersionID)
+
+	res := cm.ListObjects("", "", "", 0)
+	require.Len(t, res.Objects, 1)
+	require.Equal(t, versions[1].VersionID, res.Objects[0].VersionID)
+
+	versions, err = cm.Versions("photos/cat.png")
+	require.NoError(t, err)
+	require.Len(t, versions, 4)
+
+	_, err = cm.RestoreVersion("photos/cat.png", "unknown")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// Without versioning deleting forgets all versions.
+	cm.SetVersioning("photos", false)
+
+	_, removed, err = cm.DeleteFile("photos/cat.png", Conditions{})
+	require.NoError(t, err)
+	require.Len(t, removed, 4)
+	require.Empty(t, cm.Filenames())
+	require.Equal(t, 0, cm.storageServers[0].numberOfChunks)
+}
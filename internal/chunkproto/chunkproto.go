@@ -0,0 +1,436 @@
+// Package chunkproto implements the binary protocol of chunk transfers
+// between api-server and storage servers.
+//
+// Requests and responses are frames of the same layout, integers are big
+// endian:
+//
+//	magic      2 bytes  "SC"
+//	version    1 byte
+//	op         1 byte   PUT_CHUNK, GET_CHUNK, DELETE_CHUNK or STAT
+//	status     1 byte   zero in requests
+//	flags      1 byte
+//	key length 2 bytes
+//	request id 4 bytes  echoed by the response
+//	checksum   4 bytes  CRC32C of a put chunk, FlagChecksum is required
+//	length     8 bytes  of the payload
+//	key        chunk id, empty in responses
+//	metadata   2 bytes length and "name=value" lines if FlagMetadata is set
+//	payload    chunk content, an error message or a stat result
+//	trailer    4 bytes  CRC32C of all preceding bytes of the frame
+//
+// A connection carries any number of frames. Clients may send requests
+// without waiting for responses and match responses by request id.
+//
+// Metadata carries the context of the call, such as the trace context and the
+// request id, so storage servers can attribute the request.
+package chunkproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"simple-storage/internal/utils"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrBadFrame         = errors.New("malformed frame")
+	ErrFrameChecksum    = errors.New("frame checksum mismatch")
+	ErrPayloadTooLarge  = errors.New("frame payload is too large")
+	ErrUnsupportedFrame = errors.New("unsupported frame version")
+	// ErrInvalidHeader is returned by the writer for a header it can not
+	// encode, nothing is written then.
+	ErrInvalidHeader = errors.New("invalid frame header")
+)
+
+const (
+	magic   = 0x5343
+	version = 1
+
+	headerSize  = 24
+	trailerSize = 4
+
+	// MaxKeyLength bounds the length of chunk ids.
+	MaxKeyLength = 1024
+	// MaxMetadataLength bounds the length of encoded metadata.
+	MaxMetadataLength = 1024
+)
+
+// Op is an operation on a chunk.
+type Op uint8
+
+const (
+	OpPutChunk Op = iota + 1
+	OpGetChunk
+	OpDeleteChunk
+	// OpStat responds with the chunk size as an 8 bytes payload.
+	OpStat
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpPutChunk:
+		return "PUT_CHUNK"
+	case OpGetChunk:
+		return "GET_CHUNK"
+	case OpDeleteChunk:
+		return "DELETE_CHUNK"
+	case OpStat:
+		return "STAT"
+	default:
+		return fmt.Sprintf("OP(%d)", uint8(op))
+	}
+}
+
+// Status is the outcome of a request, a response payload of a failed
+// request is the error message.
+type Status uint8
+
+const (
+	StatusOK Status = iota
+	StatusNotFound
+	StatusChecksumMismatch
+	StatusBadRequest
+	StatusError
+)
+
+func (status Status) String() string {
+	switch status {
+	case StatusOK:
+		return "OK"
+	case StatusNotFound:
+		return "NOT_FOUND"
+	case StatusChecksumMismatch:
+		return "CHECKSUM_MISMATCH"
+	case StatusBadRequest:
+		return "BAD_REQUEST"
+	case StatusError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("STATUS(%d)", uint8(status))
+	}
+}
+
+const (
+	// FlagChecksum marks that the checksum field is set.
+	FlagChecksum uint8 = 1 << iota
+	// FlagMetadata marks that the key is followed by metadata, it is set by
+	// Writer if Metadata is not empty.
+	FlagMetadata
+)
+
+// Header describes a frame.
+type Header struct {
+	Op        Op
+	Status    Status
+	Flags     uint8
+	RequestID uint32
+	Checksum  uint32
+	Key       string
+	// Metadata are names and values without "=" and line breaks in names
+	// and line breaks in values.
+	Metadata map[string]string
+	// Length is the payload length.
+	Length uint64
+}
+
+// Writer writes frames.
+type Writer struct {
+	w   *bufio.Writer
+	crc hash.Hash32
+}
+
+// NewWriter returns a frame writer.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w:   bufio.NewWriterSize(w, 64<<10),
+		crc: utils.NewChecksum(),
+	}
+}
+
+// WriteFrame writes a frame with the payload and flushes it. The Length of
+// the header is set from the payload.
+func (fw *Writer) WriteFrame(h Header, payload []byte) error {
+	h.Length = uint64(len(payload))
+
+	return fw.WriteFrameFrom(h, bytes.NewReader(payload))
+}
+
+// WriteFrameFrom writes a frame with Length bytes of the payload read from r
+// and flushes it. The frame is incomplete if it fails, the stream can not be
+// used anymore unless the error is ErrInvalidHeader.
+func (fw *Writer) WriteFrameFrom(h Header, r io.Reader) error {
+	if len(h.Key) > MaxKeyLength {
+		return fmt.Errorf("%w: %w: key is longer than %d bytes",
+			ErrInvalidHeader, ErrBadFrame, MaxKeyLength)
+	}
+
+	var metadata []byte
+
+	if len(h.Metadata) > 0 {
+		encoded, err := encodeMetadata(h.Metadata)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidHeader, err)
+		}
+
+		h.Flags |= FlagMetadata
+		metadata = encoded
+	}
+
+	var header [headerSize]byte
+
+	binary.BigEndian.PutUint16(header[0:], magic)
+	header[2] = version
+	header[3] = uint8(h.Op)
+	header[4] = uint8(h.Status)
+	header[5] = h.Flags
+	binary.BigEndian.PutUint16(header[6:], uint16(len(h.Key)))
+	binary.BigEndian.PutUint32(header[8:], h.RequestID)
+	binary.BigEndian.PutUint32(header[12:], h.Checksum)
+	binary.BigEndian.PutUint64(header[16:], h.Length)
+
+	fw.crc.Reset()
+
+	w := io.MultiWriter(fw.w, fw.crc)
+
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, h.Key); err != nil {
+		return err
+	}
+
+	if metadata != nil {
+		if _, err := w.Write(metadata); err != nil {
+			return err
+		}
+	}
+
+	n, err := io.CopyN(w, r, int64(h.Length))
+	if err == io.EOF {
+		err = fmt.Errorf("%w: payload is %d bytes, not %d", ErrBadFrame, n, h.Length)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var trailer [trailerSize]byte
+
+	binary.BigEndian.PutUint32(trailer[:], fw.crc.Sum32())
+
+	if _, err := fw.w.Write(trailer[:]); err != nil {
+		return err
+	}
+
+	return fw.w.Flush()
+}
+
+// Reader reads frames. The payload of a frame is read by Read, Finish must be
+// called before the next frame is read.
+type Reader struct {
+	r          *bufio.Reader
+	crc        hash.Hash32
+	maxPayload uint64
+	remaining  uint64
+}
+
+// NewReader returns a frame reader rejecting payloads longer than
+// maxPayload.
+func NewReader(r io.Reader, maxPayload uint64) *Reader {
+	return &Reader{
+		r:          bufio.NewReaderSize(r, 64<<10),
+		crc:        utils.NewChecksum(),
+		maxPayload: maxPayload,
+	}
+}
+
+// Next reads the header of the next frame. It returns io.EOF if the stream
+// ends between frames.
+func (fr *Reader) Next() (Header, error) {
+	var header [headerSize]byte
+
+	if _, err := io.ReadFull(fr.r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return Header{}, fmt.Errorf("%w: %s", ErrBadFrame, err)
+		}
+
+		return Header{}, err
+	}
+
+	if binary.BigEndian.Uint16(header[0:]) != magic {
+		return Header{}, fmt.Errorf("%w: bad magic", ErrBadFrame)
+	}
+
+	if header[2] != version {
+		return Header{}, fmt.Errorf("%w: %d", ErrUnsupportedFrame, header[2])
+	}
+
+	h := Header{
+		Op:        Op(header[3]),
+		Status:    Status(header[4]),
+		Flags:     header[5],
+		RequestID: binary.BigEndian.Uint32(header[8:]),
+		Checksum:  binary.BigEndian.Uint32(header[12:]),
+		Length:    binary.BigEndian.Uint64(header[16:]),
+	}
+
+	keyLength := int(binary.BigEndian.Uint16(header[6:]))
+	if keyLength > MaxKeyLength {
+		return Header{}, fmt.Errorf("%w: key is longer than %d bytes", ErrBadFrame, MaxKeyLength)
+	}
+
+	if h.Length > fr.maxPayload {
+		return Header{}, fmt.Errorf("%w: %d bytes", ErrPayloadTooLarge, h.Length)
+	}
+
+	key := make([]byte, keyLength)
+
+	if _, err := io.ReadFull(fr.r, key); err != nil {
+		return Header{}, fmt.Errorf("%w: %s", ErrBadFrame, err)
+	}
+
+	h.Key = string(key)
+
+	fr.crc.Reset()
+	fr.crc.Write(header[:])
+	fr.crc.Write(key)
+
+	if h.Flags&FlagMetadata != 0 {
+		metadata, err := fr.readMetadata()
+		if err != nil {
+			return Header{}, err
+		}
+
+		h.Metadata = metadata
+	}
+
+	fr.remaining = h.Length
+
+	return h, nil
+}
+
+// readMetadata reads the metadata following the key.
+func (fr *Reader) readMetadata() (map[string]string, error) {
+	var length [2]byte
+
+	if _, err := io.ReadFull(fr.r, length[:]); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBadFrame, err)
+	}
+
+	n := int(binary.BigEndian.Uint16(length[:]))
+	if n > MaxMetadataLength {
+		return nil, fmt.Errorf("%w: metadata is longer than %d bytes", ErrBadFrame, MaxMetadataLength)
+	}
+
+	metadata := make([]byte, n)
+
+	if _, err := io.ReadFull(fr.r, metadata); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBadFrame, err)
+	}
+
+	fr.crc.Write(length[:])
+	fr.crc.Write(metadata)
+
+	return decodeMetadata(metadata)
+}
+
+// encodeMetadata returns the length prefixed lines of metadata sorted by
+// name.
+func encodeMetadata(metadata map[string]string) ([]byte, error) {
+	names := make([]string, 0, len(metadata))
+	for name := range metadata {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	buf := bytes.NewBuffer([]byte{0, 0})
+
+	for _, name := range names {
+		value := metadata[name]
+
+		if name == "" || strings.ContainsAny(name, "=\n") || strings.Contains(value, "\n") {
+			return nil, fmt.Errorf("%w: invalid metadata: %q", ErrBadFrame, name)
+		}
+
+		fmt.Fprintf(buf, "%s=%s\n", name, value)
+	}
+
+	encoded := buf.Bytes()
+
+	if len(encoded)-2 > MaxMetadataLength {
+		return nil, fmt.Errorf("%w: metadata is longer than %d bytes", ErrBadFrame, MaxMetadataLength)
+	}
+
+	binary.BigEndian.PutUint16(encoded, uint16(len(encoded)-2))
+
+	return encoded, nil
+}
+
+func decodeMetadata(encoded []byte) (map[string]string, error) {
+	metadata := map[string]string{}
+
+	for _, line := range strings.SplitAfter(string(encoded), "\n") {
+		if line == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(strings.TrimSuffix(line, "\n"), "=")
+		if !ok || name == "" || !strings.HasSuffix(line, "\n") {
+			return nil, fmt.Errorf("%w: malformed metadata", ErrBadFrame)
+		}
+
+		metadata[name] = value
+	}
+
+	return metadata, nil
+}
+
+// Read reads the payload of the current frame, it returns io.EOF at the end
+// of the payload.
+func (fr *Reader) Read(p []byte) (int, error) {
+	if fr.remaining == 0 {
+		return 0, io.EOF
+	}
+
+	if uint64(len(p)) > fr.remaining {
+		p = p[:fr.remaining]
+	}
+
+	n, err := fr.r.Read(p)
+	fr.crc.Write(p[:n])
+	fr.remaining -= uint64(n)
+
+	if err == io.EOF {
+		err = fmt.Errorf("%w: %s", ErrBadFrame, io.ErrUnexpectedEOF)
+	}
+
+	return n, err
+}
+
+// Finish skips the rest of the payload and verifies the trailer of the
+// current frame.
+func (fr *Reader) Finish() error {
+	if _, err := io.Copy(io.Discard, fr); err != nil {
+		return err
+	}
+
+	var trailer [trailerSize]byte
+
+	if _, err := io.ReadFull(fr.r, trailer[:]); err != nil {
+		return fmt.Errorf("%w: %s", ErrBadFrame, err)
+	}
+
+	if binary.BigEndian.Uint32(trailer[:]) != fr.crc.Sum32() {
+		return ErrFrameChecksum
+	}
+
+	return nil
+}
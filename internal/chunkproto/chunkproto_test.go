@@ -0,0 +1,137 @@
+package chunkproto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrame_roundTrip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+
+	require.NoError(t, w.WriteFrame(Header{
+		Op:        OpPutChunk,
+		Flags:     FlagChecksum,
+		RequestID: 7,
+		Checksum:  42,
+		Key:       "chunk-1",
+	}, []byte("Hello World!")))
+
+	require.NoError(t, w.WriteFrame(Header{
+		Op:        OpGetChunk,
+		Status:    StatusNotFound,
+		RequestID: 8,
+	}, nil))
+
+	r := NewReader(buf, 1<<10)
+
+	h, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, Header{
+		Op:        OpPutChunk,
+		Flags:     FlagChecksum,
+		RequestID: 7,
+		Checksum:  42,
+		Key:       "chunk-1",
+		Length:    12,
+	}, h)
+
+	payload, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "Hello World!", string(payload))
+	require.NoError(t, r.Finish())
+
+	// Finish skips a payload which is not read.
+	h, err = r.Next()
+	require.NoError(t, err)
+	require.Equal(t, StatusNotFound, h.Status)
+	require.Equal(t, uint32(8), h.RequestID)
+	require.NoError(t, r.Finish())
+
+	_, err = r.Next()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestFrame_corrupted(t *testing.T) {
+	write := func() []byte {
+		buf := &bytes.Buffer{}
+		require.NoError(t, NewWriter(buf).WriteFrame(
+			Header{Op: OpPutChunk, Key: "chunk-1"}, []byte("Hello World!")))
+
+		return buf.Bytes()
+	}
+
+	// A flipped payload bit fails the trailer.
+	frame := write()
+	frame[headerSize+3] ^= 1
+
+	r := NewReader(bytes.NewReader(frame), 1<<10)
+	_, err := r.Next()
+	require.NoError(t, err)
+	require.ErrorIs(t, r.Finish(), ErrFrameChecksum)
+
+	// A truncated frame is malformed.
+	frame = write()
+
+	r = NewReader(bytes.NewReader(frame[:len(frame)-6]), 1<<10)
+	_, err = r.Next()
+	require.NoError(t, err)
+	require.ErrorIs(t, r.Finish(), ErrBadFrame)
+
+	frame = write()
+	frame[0] = 0
+
+	_, err = NewReader(bytes.NewReader(frame), 1<<10).Next()
+	require.ErrorIs(t, err, ErrBadFrame)
+
+	_, err = NewReader(bytes.NewReader(write()), 4).Next()
+	require.ErrorIs(t, err, ErrPayloadTooLarge)
+}
+
+func TestFrame_metadata(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+
+	metadata := map[string]string{
+		"traceparent":  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"x-request-id": "req=1",
+	}
+
+	require.NoError(t, w.WriteFrame(Header{
+		Op:       OpGetChunk,
+		Key:      "chunk-1",
+		Metadata: metadata,
+	}, []byte("payload")))
+
+	r := NewReader(bytes.NewReader(buf.Bytes()), 1<<10)
+
+	h, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, FlagMetadata, h.Flags)
+	require.Equal(t, metadata, h.Metadata)
+
+	payload, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "payload", string(payload))
+	require.NoError(t, r.Finish())
+
+	// Metadata is covered by the trailer.
+	frame := buf.Bytes()
+	frame[headerSize+len("chunk-1")+4] ^= 1
+
+	r = NewReader(bytes.NewReader(frame), 1<<10)
+	_, err = r.Next()
+	require.NoError(t, err)
+	require.ErrorIs(t, r.Finish(), ErrFrameChecksum)
+
+	err = w.WriteFrame(Header{
+		Op:       OpGetChunk,
+		Key:      "chunk-1",
+		Metadata: map[string]string{"a=b": "c"},
+	}, nil)
+	require.ErrorIs(t, err, ErrBadFrame)
+	require.ErrorIs(t, err, ErrInvalidHeader)
+}
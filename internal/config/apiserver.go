@@ -0,0 +1,284 @@
+package config
+
+import (
+	"flag"
+	"simple-storage/internal/apiserver"
+	"time"
+)
+
+// APIServer are settings of the api-server.
+type APIServer struct {
+	HTTP         HTTP         `yaml:"http"`
+	GRPC         GRPC         `yaml:"grpc"`
+	ChunkManager ChunkManager `yaml:"chunk_manager"`
+	Objects      Objects      `yaml:"objects"`
+	Cache        Cache        `yaml:"cache"`
+	Auth         Auth         `yaml:"auth"`
+	TLS          APIServerTLS `yaml:"tls"`
+	// Transport is the transport to storage-servers: http, grpc or tcp.
+	Transport string    `yaml:"transport"`
+	TCP       TCPClient `yaml:"tcp"`
+	Client    Client    `yaml:"client"`
+	Probe     Probe     `yaml:"probe"`
+	Metrics   Metrics   `yaml:"metrics"`
+	Tracing   Tracing   `yaml:"tracing"`
+	Log       Log       `yaml:"log"`
+}
+
+// GRPC configures the gRPC chunk-manager service storage-servers register
+// at.
+type GRPC struct {
+	// Address disables the service if it is empty.
+	Address string `yaml:"address"`
+}
+
+// ChunkManager configures chunks of objects, see chunkmanager.Config.
+type ChunkManager struct {
+	MaxChunkSizeBytes     int `yaml:"max_chunk_size_bytes"`
+	ErasureCodingFraction int `yaml:"erasure_coding_fraction"`
+	ReplicationFactor     int `yaml:"replication_factor"`
+}
+
+// Objects configures reads and writes of objects, see apiserver.Config.
+type Objects struct {
+	// HedgePercentile disables hedged downloads if it is zero.
+	HedgePercentile   float64       `yaml:"hedge_percentile"`
+	HedgeMinDelay     time.Duration `yaml:"hedge_min_delay"`
+	Compression       string        `yaml:"compression"`
+	MasterKeyFile     string        `yaml:"master_key_file"`
+	PresignSecretFile string        `yaml:"presign_secret_file"`
+	// UploadExpiry keeps resumable uploads until they are completed if it
+	// is zero.
+	UploadExpiry time.Duration `yaml:"upload_expiry"`
+}
+
+// Cache configures the chunk cache, see chunkcache.Config. The cache is
+// disabled if neither its size nor its directory is set.
+type Cache struct {
+	Size     int64  `yaml:"size"`
+	Dir      string `yaml:"dir"`
+	DiskSize int64  `yaml:"disk_size"`
+}
+
+// Enabled reports whether the cache is used.
+func (c Cache) Enabled() bool {
+	return c.Size > 0 || c.Dir != ""
+}
+
+// Auth configures authentication of clients.
+type Auth struct {
+	// File keeps the cluster key and keys of clients with their grants,
+	// authentication is disabled if it is empty.
+	File string `yaml:"file"`
+}
+
+// APIServerTLS configures certificates of the api-server.
+type APIServerTLS struct {
+	TLS `yaml:",inline"`
+	// RegisterIdentities are certificate identities storage-servers may
+	// register with, any storage-server may register if it is empty.
+	RegisterIdentities []string `yaml:"register_identities"`
+}
+
+// TCPClient configures clients of the binary chunk protocol.
+type TCPClient struct {
+	ConnsPerAddress int `yaml:"conns_per_address"`
+}
+
+// Probe configures health probes of storage-servers, see health.Config.
+type Probe struct {
+	// Interval disables probes if it is zero, storage-servers are then
+	// available while their breaker is not open.
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	TTL      time.Duration `yaml:"ttl"`
+}
+
+// Metrics configures Prometheus metrics.
+type Metrics struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// DefaultAPIServer returns the defaults of the api-server.
+func DefaultAPIServer() APIServer {
+	return APIServer{
+		HTTP: HTTP{Address: "0.0.0.0:9000"},
+		ChunkManager: ChunkManager{
+			MaxChunkSizeBytes:     10240,
+			ErasureCodingFraction: 5,
+			ReplicationFactor:     1,
+		},
+		Objects: Objects{
+			HedgePercentile: 95,
+			HedgeMinDelay:   10 * time.Millisecond,
+			Compression:     apiserver.CodecNone,
+			UploadExpiry:    24 * time.Hour,
+		},
+		Cache: Cache{DiskSize: 1 << 30},
+		TLS: APIServerTLS{
+			TLS: TLS{ReloadInterval: 10 * time.Second},
+		},
+		Transport: "http",
+		TCP:       TCPClient{ConnsPerAddress: 2},
+		Client: Client{
+			Timeout:          30 * time.Second,
+			MaxAttempts:      3,
+			Backoff:          50 * time.Millisecond,
+			MaxBackoff:       time.Second,
+			RetryBudget:      0.2,
+			BreakerThreshold: 5,
+			BreakerCooldown:  10 * time.Second,
+		},
+		Probe: Probe{
+			Interval: 5 * time.Second,
+			Timeout:  2 * time.Second,
+			TTL:      15 * time.Second,
+		},
+		Metrics: Metrics{Enabled: true},
+		Tracing: defaultTracing(),
+		Log:     defaultLog(),
+	}
+}
+
+func (c *APIServer) reset() {
+	*c = DefaultAPIServer()
+}
+
+// Validate returns errors of invalid settings.
+func (c *APIServer) Validate() error {
+	var v validator
+
+	c.HTTP.validate(&v, "http")
+
+	v.check(c.ChunkManager.MaxChunkSizeBytes > 0,
+		"chunk_manager.max_chunk_size_bytes", "should be positive")
+	v.check(c.ChunkManager.ErasureCodingFraction > 0,
+		"chunk_manager.erasure_coding_fraction", "should be positive")
+	v.check(c.ChunkManager.ReplicationFactor > 0,
+		"chunk_manager.replication_factor", "should be positive")
+
+	v.check(c.Objects.HedgePercentile >= 0 && c.Objects.HedgePercentile < 100,
+		"objects.hedge_percentile", "should be at least 0 and less than 100")
+	v.check(c.Objects.HedgeMinDelay >= 0, "objects.hedge_min_delay", "should not be negative")
+	v.check(c.Objects.Compression == apiserver.CodecNone ||
+		c.Objects.Compression == apiserver.CodecGzip ||
+		c.Objects.Compression == apiserver.CodecZstd,
+		"objects.compression", "should be none, gzip or zstd")
+	v.check(c.Objects.UploadExpiry >= 0, "objects.upload_expiry", "should not be negative")
+
+	v.check(c.Cache.Size >= 0, "cache.size", "should not be negative")
+	v.check(c.Cache.DiskSize >= 0, "cache.disk_size", "should not be negative")
+
+	c.TLS.validate(&v, "tls")
+	v.check(len(c.TLS.RegisterIdentities) == 0 || c.TLS.CAFile != "",
+		"tls.register_identities", "requires tls.cert_file and tls.ca_file")
+
+	v.check(c.Transport == "http" || c.Transport == "grpc" || c.Transport == "tcp",
+		"transport", "should be http, grpc or tcp")
+	v.check(c.TCP.ConnsPerAddress > 0, "tcp.conns_per_address", "should be positive")
+
+	c.Client.validate(&v, "client")
+
+	v.check(c.Probe.Interval >= 0, "probe.interval", "should not be negative")
+	v.check(c.Probe.Timeout >= 0, "probe.timeout", "should not be negative")
+	v.check(c.Probe.TTL >= c.Probe.Interval, "probe.ttl", "should not be less than probe.interval")
+
+	c.Tracing.validate(&v, "tracing")
+	c.Log.validate(&v, "log")
+
+	return v.err()
+}
+
+// Reload takes the settings which may change while the api-server runs from
+// next: the log level and, if the cache is enabled, the cache sizes. It
+// returns paths of other changed settings, which take effect on restart.
+func (c *APIServer) Reload(next APIServer) []string {
+	running := *c
+	running.Log.Level = next.Log.Level
+
+	if running.Cache.Enabled() {
+		running.Cache.Size = next.Cache.Size
+		running.Cache.DiskSize = next.Cache.DiskSize
+	}
+
+	*c = running
+
+	return changed(running, next)
+}
+
+// APIServerFlags registers flags of api-server settings on fs.
+func APIServerFlags(fs *flag.FlagSet) {
+	registerFlags(fs, DefaultAPIServer(), []flagSpec{
+		{"address", "http.address", "TCP/IP address of the api-server"},
+		{"max-chunk-size-bytes", "chunk_manager.max_chunk_size_bytes", "chunk size"},
+		{"erasure-coding-fraction", "chunk_manager.erasure_coding_fraction",
+			"erasure coding fraction"},
+		{"replication-factor", "chunk_manager.replication_factor",
+			"how many storage servers keep each chunk"},
+		{"hedge-percentile", "objects.hedge_percentile",
+			"chunk download latency percentile after which another replica is requested, 0 disables hedging"},
+		{"hedge-min-delay", "objects.hedge_min_delay",
+			"minimal delay before another replica is requested"},
+		{"compression", "objects.compression",
+			"default chunk compression codec: none, gzip or zstd"},
+		{"master-key-file", "objects.master_key_file",
+			"file with a 32 bytes key encrypting chunks at rest, raw or hex encoded, it is read again on /admin/keys/rotate"},
+		{"upload-expiry", "objects.upload_expiry",
+			"how long a resumable upload is kept after it has been created or written, 0 keeps it until it is completed"},
+		{"cache-size", "cache.size",
+			"size of the in-memory chunk cache in bytes, 0 disables caching"},
+		{"cache-dir", "cache.dir",
+			"directory chunks evicted from the in-memory cache are spilled to, it should be empty or created by the cache; spilled chunks are removed on start"},
+		{"cache-disk-size", "cache.disk_size",
+			"size of chunks spilled to the cache directory in bytes"},
+		{"presign-secret-file", "objects.presign_secret_file",
+			"file with a 32 bytes secret signing presigned urls, raw or hex encoded"},
+		{"auth-file", "auth.file",
+			"JSON file with the cluster key and keys of clients with their grants, empty disables authentication"},
+		{"tls-cert-file", "tls.cert_file",
+			"PEM certificate presented to clients and storage-servers, empty disables TLS"},
+		{"tls-key-file", "tls.key_file", "PEM private key of the certificate"},
+		{"tls-ca-file", "tls.ca_file",
+			"PEM bundle of authorities verifying storage-servers and client certificates"},
+		{"tls-reload-interval", "tls.reload_interval",
+			"how often certificate files are checked for changes"},
+		{"register-identities", "tls.register_identities",
+			"comma separated certificate identities (common name, DNS name or URI) storage-servers may register with"},
+		{"transport", "transport", "transport to storage-servers: http, grpc or tcp"},
+		{"tcp-conns-per-address", "tcp.conns_per_address",
+			"connections per storage-server the tcp transport pipelines requests over"},
+		{"grpc-address", "grpc.address",
+			"TCP/IP address of the gRPC chunk-manager service storage-servers register at, empty disables it"},
+		{"client-timeout", "client.timeout",
+			"timeout of every attempt of a storage-server call, 0 disables it"},
+		{"client-max-attempts", "client.max_attempts",
+			"attempts of an idempotent storage-server call including the first one"},
+		{"client-backoff", "client.backoff",
+			"delay before the first retry of a storage-server call, it doubles with every retry"},
+		{"client-max-backoff", "client.max_backoff",
+			"longest delay between retries of a storage-server call"},
+		{"client-retry-budget", "client.retry_budget",
+			"retries per storage-server call allowed on average, 0 does not limit retries"},
+		{"breaker-threshold", "client.breaker_threshold",
+			"consecutive failures after which calls to a storage-server fail fast, 0 disables the breaker"},
+		{"breaker-cooldown", "client.breaker_cooldown",
+			"how long calls to a storage-server fail fast before it is probed again"},
+		{"probe-interval", "probe.interval",
+			"how often storage-servers are probed, 0 disables probes"},
+		{"probe-timeout", "probe.timeout", "timeout of a storage-server probe"},
+		{"probe-ttl", "probe.ttl",
+			"how long a storage-server is available after a successful probe"},
+		{"metrics", "metrics.enabled", "serve Prometheus metrics on /metrics"},
+		{"trace-exporter", "tracing.exporter",
+			"exporter of OpenTelemetry spans: none, file or otlp"},
+		{"trace-file", "tracing.file", "file spans are appended to as JSON by the file exporter"},
+		{"trace-otlp-endpoint", "tracing.otlp_endpoint",
+			"host:port of the OpenTelemetry collector receiving spans over gRPC"},
+		{"trace-otlp-insecure", "tracing.otlp_insecure", "send spans to the collector without TLS"},
+		{"trace-sample-ratio", "tracing.sample_ratio",
+			"part of traces started by this api-server which are exported"},
+		{"log-format", "log.format", "format of log lines: text or json"},
+		{"log-level", "log.level",
+			"lowest level of logged lines: debug, info, warn or error, it can be changed on /admin/log-level"},
+	})
+}
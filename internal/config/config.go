@@ -0,0 +1,358 @@
+// Package config loads settings of the binaries from a YAML file,
+// environment variables and command line flags. Later sources override
+// earlier ones: defaults, the file, the environment and flags set on the
+// command line.
+//
+// Settings are addressed by their path in the file, such as
+// http.read_timeout. The environment variable of a setting is its path in
+// upper case prefixed with EnvPrefix and dots replaced by underscores, such
+// as SIMPLE_STORAGE_HTTP_READ_TIMEOUT. Lists are comma separated in
+// environment variables and flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes environment variables of settings.
+const EnvPrefix = "SIMPLE_STORAGE_"
+
+// EnvConfigFile names the config file if the config flag is not set.
+const EnvConfigFile = EnvPrefix + "CONFIG"
+
+// Settings are settings of a binary.
+type Settings interface {
+	// Validate returns errors of invalid settings, each naming its setting.
+	Validate() error
+	// reset sets the defaults.
+	reset()
+}
+
+// Load sets defaults of c, then settings of the file at path if it is set,
+// of the environment and of flags of fs registered by this package which are
+// set on the command line, and validates the result.
+func Load(c Settings, path string, fs *flag.FlagSet) error {
+	c.reset()
+
+	v := reflect.ValueOf(c).Elem()
+
+	if path != "" {
+		if err := decodeFile(v, path); err != nil {
+			return err
+		}
+	}
+
+	if err := walk(v, "", func(path string, field reflect.Value) error {
+		name := envName(path)
+
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			return nil
+		}
+
+		if err := setString(field, s); err != nil {
+			return fmt.Errorf("%s (%s): %w", path, name, err)
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var err error
+
+	if fs != nil {
+		fs.Visit(func(f *flag.Flag) {
+			setting, ok := f.Value.(*settingFlag)
+			if !ok || err != nil {
+				return
+			}
+
+			field, ok := lookup(v, setting.path)
+			if !ok {
+				return
+			}
+
+			if errSet := setString(field, setting.value); errSet != nil {
+				err = fmt.Errorf("%s (-%s): %w", setting.path, f.Name, errSet)
+			}
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return c.Validate()
+}
+
+// decodeFile decodes the YAML file at path into v. Settings are decoded one
+// by one, so that errors name the setting they are about.
+func decodeFile(v reflect.Value, path string) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failure to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return fmt.Errorf("failure to parse config file: %w", err)
+	}
+
+	// An empty file has no content.
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	return decodeNode(doc.Content[0], v, "")
+}
+
+func decodeNode(node *yaml.Node, v reflect.Value, path string) error {
+	if v.Kind() != reflect.Struct {
+		if err := node.Decode(v.Addr().Interface()); err != nil {
+			var typeErr *yaml.TypeError
+			if errors.As(err, &typeErr) {
+				err = errors.New(strings.Join(typeErr.Errors, "; "))
+			}
+
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		return nil
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: line %d: should be a mapping", nameOf(path), node.Line)
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		name := join(path, key.Value)
+
+		field, ok := lookup(v, key.Value)
+		if !ok {
+			return fmt.Errorf("%s: line %d: unknown setting", name, key.Line)
+		}
+
+		if err := decodeNode(node.Content[i+1], field, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walk calls fn with every setting of v, which is a struct of sections.
+func walk(v reflect.Value, path string, fn func(path string, field reflect.Value) error) error {
+	if v.Kind() != reflect.Struct {
+		return fn(path, v)
+	}
+
+	for _, f := range fields(v) {
+		if err := walk(f.value, join(path, f.key), fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lookup returns the setting or the section at path of v.
+func lookup(v reflect.Value, path string) (reflect.Value, bool) {
+	for _, name := range strings.Split(path, ".") {
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+
+		found := false
+
+		for _, f := range fields(v) {
+			if f.key == name {
+				v, found = f.value, true
+				break
+			}
+		}
+
+		if !found {
+			return reflect.Value{}, false
+		}
+	}
+
+	return v, true
+}
+
+// changed returns paths of settings which differ between a and b.
+func changed(a, b any) []string {
+	var (
+		va    = reflect.ValueOf(a)
+		vb    = reflect.ValueOf(b)
+		paths []string
+	)
+
+	walk(va, "", func(path string, field reflect.Value) error {
+		other, _ := lookup(vb, path)
+		if !reflect.DeepEqual(field.Interface(), other.Interface()) {
+			paths = append(paths, path)
+		}
+
+		return nil
+	})
+
+	return paths
+}
+
+// setString sets the setting from its text form.
+func setString(field reflect.Value, s string) error {
+	switch {
+	case field.Kind() == reflect.String:
+		field.SetString(s)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var list []string
+
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+
+		field.Set(reflect.ValueOf(list))
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(int64(d))
+	default:
+		if err := yaml.Unmarshal([]byte(s), field.Addr().Interface()); err != nil {
+			return fmt.Errorf("invalid value %q for %s", s, field.Type())
+		}
+	}
+
+	return nil
+}
+
+// formatString returns the text form of the setting.
+func formatString(field reflect.Value) string {
+	if list, ok := field.Interface().([]string); ok {
+		return strings.Join(list, ",")
+	}
+
+	return fmt.Sprint(field.Interface())
+}
+
+type member struct {
+	key   string
+	value reflect.Value
+}
+
+// fields returns settings and sections of the section v by their keys,
+// fields of inlined structs included.
+func fields(v reflect.Value) []member {
+	var fs []member
+
+	for i := 0; i < v.NumField(); i++ {
+		name, opts, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+
+		if opts == "inline" {
+			fs = append(fs, fields(v.Field(i))...)
+			continue
+		}
+
+		fs = append(fs, member{key: name, value: v.Field(i)})
+	}
+
+	return fs
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+func nameOf(path string) string {
+	if path == "" {
+		return "config"
+	}
+
+	return path
+}
+
+func envName(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// flagSpec binds a command line flag to a setting.
+type flagSpec struct {
+	name, path, usage string
+}
+
+// settingFlag keeps the text of a flag, which is applied to its setting by
+// Load.
+type settingFlag struct {
+	path   string
+	value  string
+	isBool bool
+}
+
+func (f *settingFlag) String() string {
+	if f == nil {
+		return ""
+	}
+
+	return f.value
+}
+
+func (f *settingFlag) Set(s string) error {
+	f.value = s
+	return nil
+}
+
+func (f *settingFlag) IsBoolFlag() bool { return f.isBool }
+
+// registerFlags registers flags of specs on fs with defaults taken from
+// settings.
+func registerFlags(fs *flag.FlagSet, settings any, specs []flagSpec) {
+	v := reflect.ValueOf(settings)
+
+	for _, spec := range specs {
+		field, ok := lookup(v, spec.path)
+		if !ok {
+			panic("config: flag of unknown setting: " + spec.path)
+		}
+
+		fs.Var(&settingFlag{
+			path:   spec.path,
+			value:  formatString(field),
+			isBool: field.Kind() == reflect.Bool,
+		}, spec.name, spec.usage)
+	}
+}
+
+// validator collects errors of invalid settings.
+type validator struct {
+	errs []error
+}
+
+// check records the reason if the setting is not ok.
+func (v *validator) check(ok bool, path, reason string) {
+	if !ok {
+		v.errs = append(v.errs, fmt.Errorf("%s: %s", path, reason))
+	}
+}
+
+func (v *validator) err() error {
+	return errors.Join(v.errs...)
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func TestLoad_defaults(t *testing.T) {
+	var c APIServer
+
+	require.NoError(t, Load(&c, "", nil))
+	require.Equal(t, DefaultAPIServer(), c)
+}
+
+func TestLoad_precedence(t *testing.T) {
+	path := writeFile(t, `
+http:
+  address: 127.0.0.1:9300
+  read_timeout: 5s
+  max_header_bytes: 4096
+tls:
+  cert_file: server.pem
+  key_file: server.key
+  ca_file: ca.pem
+  register_identities: [storage-1, storage-2]
+client:
+  max_attempts: 5
+log:
+  level: warn
+`)
+
+	t.Setenv("SIMPLE_STORAGE_CLIENT_MAX_ATTEMPTS", "7")
+	t.Setenv("SIMPLE_STORAGE_CACHE_SIZE", "1024")
+	t.Setenv("SIMPLE_STORAGE_LOG_LEVEL", "error")
+
+	fs := flag.NewFlagSet("api-server", flag.ContinueOnError)
+	APIServerFlags(fs)
+	require.NoError(t, fs.Parse([]string{"-log-level", "debug", "-metrics=false"}))
+
+	var c APIServer
+
+	require.NoError(t, Load(&c, path, fs))
+
+	require.Equal(t, "127.0.0.1:9300", c.HTTP.Address)
+	require.Equal(t, 5*time.Second, c.HTTP.ReadTimeout)
+	require.Equal(t, 4096, c.HTTP.MaxHeaderBytes)
+	require.Equal(t, []string{"storage-1", "storage-2"}, c.TLS.RegisterIdentities)
+	require.Equal(t, "server.pem", c.TLS.CertFile)
+	require.Equal(t, 7, c.Client.MaxAttempts)
+	require.Equal(t, int64(1024), c.Cache.Size)
+	require.Equal(t, "debug", c.Log.Level)
+	require.False(t, c.Metrics.Enabled)
+	// Settings set nowhere keep their defaults.
+	require.Equal(t, 10*time.Second, c.TLS.ReloadInterval)
+}
+
+func TestLoad_errors(t *testing.T) {
+	tt := []struct {
+		name    string
+		content string
+		env     map[string]string
+		err     string
+	}{
+		{
+			name:    "unknown setting",
+			content: "http:\n  adress: 127.0.0.1:9300\n",
+			err:     "http.adress: line 2: unknown setting",
+		},
+		{
+			name:    "invalid type",
+			content: "chunk_manager:\n  replication_factor: two\n",
+			err:     "chunk_manager.replication_factor: line 2: cannot unmarshal",
+		},
+		{
+			name:    "invalid duration",
+			content: "client:\n  backoff: soon\n",
+			err:     "client.backoff:",
+		},
+		{
+			name:    "not a section",
+			content: "http: 127.0.0.1:9300\n",
+			err:     "http: line 1: should be a mapping",
+		},
+		{
+			name:    "invalid value",
+			content: "http:\n  read_timeout: -1s\ntransport: udp\n",
+			err:     "http.read_timeout: should not be negative\ntransport: should be http, grpc or tcp",
+		},
+		{
+			name: "invalid environment variable",
+			env:  map[string]string{"SIMPLE_STORAGE_HTTP_WRITE_TIMEOUT": "1 minute"},
+			err:  "http.write_timeout (SIMPLE_STORAGE_HTTP_WRITE_TIMEOUT):",
+		},
+		{
+			name: "dependent settings",
+			env:  map[string]string{"SIMPLE_STORAGE_TLS_REGISTER_IDENTITIES": "storage-1"},
+			err:  "tls.register_identities: requires tls.cert_file and tls.ca_file",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, value := range tc.env {
+				t.Setenv(name, value)
+			}
+
+			var path string
+			if tc.content != "" {
+				path = writeFile(t, tc.content)
+			}
+
+			var c APIServer
+
+			err := Load(&c, path, nil)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+func TestLoad_storageServer(t *testing.T) {
+	path := writeFile(t, `
+transport: tcp
+metrics:
+  enabled: false
+  address: 127.0.0.1:9400
+`)
+
+	var c StorageServer
+
+	err := Load(&c, path, nil)
+	require.EqualError(t, err, "tcp.address: should be set with the tcp transport")
+
+	t.Setenv("SIMPLE_STORAGE_TCP_ADDRESS", "127.0.0.1:9401")
+
+	require.NoError(t, Load(&c, path, nil))
+	require.Equal(t, "127.0.0.1:9401", c.TCP.Address)
+	require.Equal(t, "127.0.0.1:9400", c.Metrics.Address)
+	require.False(t, c.Metrics.Enabled)
+}
+
+func TestAPIServer_Reload(t *testing.T) {
+	running := DefaultAPIServer()
+	running.Cache.Size = 1024
+
+	next := running
+	next.Log.Level = "debug"
+	next.Cache.Size = 2048
+	next.HTTP.Address = "127.0.0.1:9300"
+
+	restart := running.Reload(next)
+
+	require.Equal(t, []string{"http.address"}, restart)
+	require.Equal(t, "debug", running.Log.Level)
+	require.Equal(t, int64(2048), running.Cache.Size)
+	require.Equal(t, DefaultAPIServer().HTTP.Address, running.HTTP.Address)
+
+	// The cache is not created on reload.
+	running = DefaultAPIServer()
+	next = running
+	next.Cache.Size = 1024
+
+	require.Equal(t, []string{"cache.size"}, running.Reload(next))
+	require.Zero(t, running.Cache.Size)
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"simple-storage/internal/logging"
+	"simple-storage/internal/tracing"
+	"time"
+)
+
+// HTTP configures a server, see entrypoint/http.Config.
+type HTTP struct {
+	Address string `yaml:"address"`
+	// Timeouts are disabled if they are zero.
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	// MaxHeaderBytes falls back to the net/http default if it is zero.
+	MaxHeaderBytes int `yaml:"max_header_bytes"`
+}
+
+func (c HTTP) validate(v *validator, path string) {
+	v.check(c.Address != "", path+".address", "should be set")
+	v.check(c.ReadTimeout >= 0, path+".read_timeout", "should not be negative")
+	v.check(c.ReadHeaderTimeout >= 0, path+".read_header_timeout", "should not be negative")
+	v.check(c.WriteTimeout >= 0, path+".write_timeout", "should not be negative")
+	v.check(c.IdleTimeout >= 0, path+".idle_timeout", "should not be negative")
+	v.check(c.MaxHeaderBytes >= 0, path+".max_header_bytes", "should not be negative")
+}
+
+// TLS configures certificates, see tlsconfig.Config. TLS is disabled if
+// the certificate is not set.
+type TLS struct {
+	CertFile       string        `yaml:"cert_file"`
+	KeyFile        string        `yaml:"key_file"`
+	CAFile         string        `yaml:"ca_file"`
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+func (c TLS) validate(v *validator, path string) {
+	if c.CertFile == "" {
+		v.check(c.KeyFile == "", path+".key_file", "requires "+path+".cert_file")
+		v.check(c.CAFile == "", path+".ca_file", "requires "+path+".cert_file")
+		return
+	}
+
+	v.check(c.KeyFile != "", path+".key_file", "should be set with "+path+".cert_file")
+	v.check(c.ReloadInterval > 0, path+".reload_interval", "should be positive")
+}
+
+// Client configures retries and circuit breaking of calls to other
+// servers, see resilience.Config.
+type Client struct {
+	// Timeout bounds every attempt, it is disabled if it is zero.
+	Timeout     time.Duration `yaml:"timeout"`
+	MaxAttempts int           `yaml:"max_attempts"`
+	Backoff     time.Duration `yaml:"backoff"`
+	MaxBackoff  time.Duration `yaml:"max_backoff"`
+	// RetryBudget does not limit retries if it is zero.
+	RetryBudget float64 `yaml:"retry_budget"`
+	// BreakerThreshold disables the breaker if it is zero.
+	BreakerThreshold int           `yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+}
+
+func (c Client) validate(v *validator, path string) {
+	v.check(c.Timeout >= 0, path+".timeout", "should not be negative")
+	v.check(c.MaxAttempts >= 1, path+".max_attempts", "should be at least 1")
+	v.check(c.Backoff >= 0, path+".backoff", "should not be negative")
+	v.check(c.MaxBackoff >= c.Backoff, path+".max_backoff", "should not be less than "+path+".backoff")
+	v.check(c.RetryBudget >= 0, path+".retry_budget", "should not be negative")
+	v.check(c.BreakerThreshold >= 0, path+".breaker_threshold", "should not be negative")
+	v.check(c.BreakerCooldown >= 0, path+".breaker_cooldown", "should not be negative")
+}
+
+// Tracing configures the export of spans, see tracing.Config.
+type Tracing struct {
+	Exporter     string  `yaml:"exporter"`
+	File         string  `yaml:"file"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint"`
+	OTLPInsecure bool    `yaml:"otlp_insecure"`
+	SampleRatio  float64 `yaml:"sample_ratio"`
+}
+
+func defaultTracing() Tracing {
+	return Tracing{
+		Exporter:     tracing.ExporterNone,
+		File:         "spans.json",
+		OTLPEndpoint: "localhost:4317",
+		SampleRatio:  1,
+	}
+}
+
+func (c Tracing) validate(v *validator, path string) {
+	v.check(c.Exporter == tracing.ExporterNone || c.Exporter == tracing.ExporterFile ||
+		c.Exporter == tracing.ExporterOTLP, path+".exporter", "should be none, file or otlp")
+	v.check(c.Exporter != tracing.ExporterFile || c.File != "", path+".file",
+		"should be set with the file exporter")
+	v.check(c.Exporter != tracing.ExporterOTLP || c.OTLPEndpoint != "", path+".otlp_endpoint",
+		"should be set with the otlp exporter")
+	v.check(c.SampleRatio >= 0 && c.SampleRatio <= 1, path+".sample_ratio", "should be between 0 and 1")
+}
+
+// Log configures log lines, see logging.Config.
+type Log struct {
+	Format string `yaml:"format"`
+	Level  string `yaml:"level"`
+}
+
+func defaultLog() Log {
+	return Log{Format: logging.FormatText, Level: "info"}
+}
+
+func (c Log) validate(v *validator, path string) {
+	v.check(c.Format == logging.FormatText || c.Format == logging.FormatJSON,
+		path+".format", "should be text or json")
+
+	_, err := logging.ParseLevel(c.Level)
+	v.check(err == nil, path+".level", "should be debug, info, warn or error")
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"flag"
+	"time"
+)
+
+// StorageServer are settings of the storage-server.
+type StorageServer struct {
+	// HTTP configures the server of chunks, which serves gRPC with the grpc
+	// transport.
+	HTTP         HTTP               `yaml:"http"`
+	ChunkManager ChunkManagerClient `yaml:"chunk_manager"`
+	Storage      Storage            `yaml:"storage"`
+	// Transport is the transport of the storage-server and of its
+	// chunk-manager client: http, grpc or tcp.
+	Transport string         `yaml:"transport"`
+	TCP       TCPServer      `yaml:"tcp"`
+	TLS       TLS            `yaml:"tls"`
+	Client    Client         `yaml:"client"`
+	Metrics   StorageMetrics `yaml:"metrics"`
+	Tracing   Tracing        `yaml:"tracing"`
+	Log       Log            `yaml:"log"`
+}
+
+// ChunkManagerClient configures the registration at the chunk-manager.
+type ChunkManagerClient struct {
+	Address string `yaml:"address"`
+	// ClusterKeyFile keeps the cluster key authenticating registration.
+	ClusterKeyFile string `yaml:"cluster_key_file"`
+}
+
+// Storage configures where chunks are kept, see storageserver.Config.
+type Storage struct {
+	DataDirectory string `yaml:"data_directory"`
+	// RegistrationRetryTimeout is in seconds.
+	RegistrationRetryTimeout int `yaml:"registration_retry_timeout"`
+}
+
+// TCPServer configures the binary chunk protocol, see entrypoint/tcp.Config.
+type TCPServer struct {
+	// Address disables the protocol if it is empty.
+	Address      string        `yaml:"address"`
+	MaxChunkSize uint64        `yaml:"max_chunk_size"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+}
+
+// StorageMetrics configures Prometheus metrics of the storage-server.
+type StorageMetrics struct {
+	Metrics `yaml:",inline"`
+	// Address serves metrics, probes and the log level over plain HTTP with
+	// the grpc transport, which has no HTTP address.
+	Address string `yaml:"address"`
+}
+
+// DefaultStorageServer returns the defaults of the storage-server.
+func DefaultStorageServer() StorageServer {
+	return StorageServer{
+		HTTP:         HTTP{Address: "0.0.0.0:9001"},
+		ChunkManager: ChunkManagerClient{Address: "0.0.0.0:9000"},
+		Storage: Storage{
+			DataDirectory:            "data",
+			RegistrationRetryTimeout: 4,
+		},
+		Transport: "http",
+		TCP: TCPServer{
+			MaxChunkSize: 64 << 20,
+			IdleTimeout:  5 * time.Minute,
+		},
+		TLS: TLS{ReloadInterval: 10 * time.Second},
+		Client: Client{
+			Timeout:     10 * time.Second,
+			MaxAttempts: 3,
+			Backoff:     100 * time.Millisecond,
+			MaxBackoff:  time.Second,
+		},
+		Metrics: StorageMetrics{Metrics: Metrics{Enabled: true}},
+		Tracing: defaultTracing(),
+		Log:     defaultLog(),
+	}
+}
+
+func (c *StorageServer) reset() {
+	*c = DefaultStorageServer()
+}
+
+// Validate returns errors of invalid settings.
+func (c *StorageServer) Validate() error {
+	var v validator
+
+	c.HTTP.validate(&v, "http")
+
+	v.check(c.ChunkManager.Address != "", "chunk_manager.address", "should be set")
+	v.check(c.Storage.DataDirectory != "", "storage.data_directory", "should be set")
+	v.check(c.Storage.RegistrationRetryTimeout > 0,
+		"storage.registration_retry_timeout", "should be positive")
+
+	v.check(c.Transport == "http" || c.Transport == "grpc" || c.Transport == "tcp",
+		"transport", "should be http, grpc or tcp")
+	v.check(c.Transport != "tcp" || c.TCP.Address != "",
+		"tcp.address", "should be set with the tcp transport")
+	v.check(c.TCP.MaxChunkSize > 0, "tcp.max_chunk_size", "should be positive")
+	v.check(c.TCP.IdleTimeout >= 0, "tcp.idle_timeout", "should not be negative")
+
+	c.TLS.validate(&v, "tls")
+	c.Client.validate(&v, "client")
+	c.Tracing.validate(&v, "tracing")
+	c.Log.validate(&v, "log")
+
+	return v.err()
+}
+
+// Reload takes the settings which may change while the storage-server runs
+// from next, which is the log level. It returns paths of other changed
+// settings, which take effect on restart.
+func (c *StorageServer) Reload(next StorageServer) []string {
+	running := *c
+	running.Log.Level = next.Log.Level
+
+	*c = running
+
+	return changed(running, next)
+}
+
+// StorageServerFlags registers flags of storage-server settings on fs.
+func StorageServerFlags(fs *flag.FlagSet) {
+	registerFlags(fs, DefaultStorageServer(), []flagSpec{
+		{"chunk-manager", "chunk_manager.address", "TCP/IP address of chunk-manager"},
+		{"address", "http.address", "TCP/IP address of storage-server"},
+		{"data-directory", "storage.data_directory", "directory with chunks"},
+		{"registration-retry-timeout", "storage.registration_retry_timeout",
+			"how long should wait between unsuccesfull registraton"},
+		{"cluster-key-file", "chunk_manager.cluster_key_file",
+			"file with the cluster key authenticating registration at chunk-manager"},
+		{"tls-cert-file", "tls.cert_file",
+			"PEM certificate presented to api-server and chunk-manager, empty disables TLS"},
+		{"tls-key-file", "tls.key_file", "PEM private key of the certificate"},
+		{"tls-ca-file", "tls.ca_file",
+			"PEM bundle of authorities verifying chunk-manager and clients, clients must present a certificate if it is set"},
+		{"tls-reload-interval", "tls.reload_interval",
+			"how often certificate files are checked for changes"},
+		{"transport", "transport",
+			"transport of the storage-server and of its chunk-manager client: http, grpc or tcp; " +
+				"tcp serves chunks on tcp-address and http otherwise"},
+		{"tcp-address", "tcp.address",
+			"TCP/IP address of the binary chunk protocol, empty disables it"},
+		{"tcp-max-chunk-size", "tcp.max_chunk_size",
+			"largest chunk accepted over the binary chunk protocol"},
+		{"tcp-idle-timeout", "tcp.idle_timeout",
+			"how long a binary chunk protocol connection may wait for a request"},
+		{"client-timeout", "client.timeout",
+			"timeout of every attempt of a chunk-manager call, 0 disables it"},
+		{"client-max-attempts", "client.max_attempts",
+			"attempts of a chunk-manager call including the first one"},
+		{"metrics", "metrics.enabled", "serve Prometheus metrics on /metrics of the HTTP address"},
+		{"metrics-address", "metrics.address",
+			"plain HTTP address serving /metrics, /healthz, /readyz and /admin/log-level with the grpc transport, which has no HTTP address"},
+		{"trace-exporter", "tracing.exporter",
+			"exporter of OpenTelemetry spans: none, file or otlp"},
+		{"trace-file", "tracing.file", "file spans are appended to as JSON by the file exporter"},
+		{"trace-otlp-endpoint", "tracing.otlp_endpoint",
+			"host:port of the OpenTelemetry collector receiving spans over gRPC"},
+		{"trace-otlp-insecure", "tracing.otlp_insecure", "send spans to the collector without TLS"},
+		{"trace-sample-ratio", "tracing.sample_ratio",
+			"part of traces started by this storage-server which are exported"},
+		{"log-format", "log.format", "format of log lines: text or json"},
+		{"log-level", "log.level",
+			"lowest level of logged lines: debug, info, warn or error, it can be changed on /admin/log-level"},
+	})
+}
@@ -0,0 +1,110 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// KeySize is the size of AES-256 keys.
+const KeySize = 32
+
+var (
+	ErrInvalidKey = errors.New("key should be 32 bytes long")
+	ErrDecryption = errors.New("failure to decrypt")
+)
+
+// NewKey returns a random key.
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// LoadKey reads a key from a file keeping either raw or hex encoded bytes.
+func LoadKey(path string) ([]byte, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failure to read key file: %w", err)
+	}
+
+	if len(buf) == KeySize {
+		return buf, nil
+	}
+
+	key, err := hex.DecodeString(string(bytes.TrimSpace(buf)))
+	if err != nil || len(key) != KeySize {
+		return nil, fmt.Errorf("key file: %s: %w", path, ErrInvalidKey)
+	}
+
+	return key, nil
+}
+
+// Seal encrypts and authenticates plaintext with AES-256-GCM. The random
+// nonce is prepended to the result. additionalData is authenticated but not
+// encrypted, it should be the same for Open.
+func Seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts data encrypted by Seal.
+func Open(key, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrDecryption
+	}
+
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// KeyID returns a short identifier of a key that does not reveal it.
+func KeyID(key []byte) string {
+	digest := sha256.Sum256(key)
+	return hex.EncodeToString(digest[:8])
+}
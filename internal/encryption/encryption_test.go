@@ -0,0 +1,77 @@
+package encryption
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealOpen(t *testing.T) {
+	key, err := NewKey()
+	require.NoError(t, err)
+
+	otherKey, err := NewKey()
+	require.NoError(t, err)
+
+	tt := []struct {
+		plaintext string
+		key       []byte
+		sealData  string
+		openData  string
+		tamper    bool
+		err       error
+	}{
+		{plaintext: "Hello World!", key: key, sealData: "id1", openData: "id1"},
+		{plaintext: "", key: key, sealData: "id1", openData: "id1"},
+		{plaintext: "Hello World!", key: otherKey, sealData: "id1", openData: "id1", err: ErrDecryption},
+		{plaintext: "Hello World!", key: key, sealData: "id1", openData: "id2", err: ErrDecryption},
+		{plaintext: "Hello World!", key: key, sealData: "id1", openData: "id1", tamper: true, err: ErrDecryption},
+	}
+
+	for _, tc := range tt {
+		ciphertext, err := Seal(key, []byte(tc.plaintext), []byte(tc.sealData))
+		require.NoError(t, err)
+
+		if tc.tamper {
+			ciphertext[len(ciphertext)-1] ^= 1
+		}
+
+		plaintext, err := Open(tc.key, ciphertext, []byte(tc.openData))
+		require.ErrorIs(t, err, tc.err)
+
+		if tc.err == nil {
+			require.Equal(t, tc.plaintext, string(plaintext))
+		}
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	key, err := NewKey()
+	require.NoError(t, err)
+
+	tt := []struct {
+		content []byte
+		err     error
+	}{
+		{content: key},
+		{content: []byte(hex.EncodeToString(key) + "\n")},
+		{content: []byte("short"), err: ErrInvalidKey},
+	}
+
+	for _, tc := range tt {
+		path := filepath.Join(t.TempDir(), "master.key")
+
+		err := os.WriteFile(path, tc.content, 0o600)
+		require.NoError(t, err)
+
+		loaded, err := LoadKey(path)
+		require.ErrorIs(t, err, tc.err)
+
+		if tc.err == nil {
+			require.Equal(t, key, loaded)
+		}
+	}
+}
@@ -1,53 +1,124 @@
 package chunkmanager
 
 import (
+	"bytes"
 	"context"
-	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
-	"simple-storage/internal/utils"
+	"simple-storage/internal/logging"
+	"simple-storage/internal/resilience"
+	"simple-storage/internal/tracing"
 	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
 )
 
+// maxErrorBody bounds the part of an error response included in the error.
+const maxErrorBody = 512
+
 type httpClient interface {
 	Do(req *http.Request) (resp *http.Response, err error)
 }
 
 type Client struct {
-	log     *log.Logger
+	log *slog.Logger
+	// scheme is http or https.
+	scheme  string
 	address string
-	client  httpClient
+	// clusterKey authenticates storage servers, it is not sent if empty.
+	clusterKey string
+	client     httpClient
 }
 
-func New(log *log.Logger, address string, httpClient httpClient) *Client {
-	log = utils.LoggerExtendWithPrefix(log, "chunk-manager-client ->")
+func New(
+	log *slog.Logger, scheme, address, clusterKey string, httpClient httpClient,
+) *Client {
+	log = logging.Component(log, "chunk-manager-client")
 
 	return &Client{
-		log:     log,
-		client:  httpClient,
-		address: address,
+		log:        log,
+		client:     httpClient,
+		scheme:     scheme,
+		address:    address,
+		clusterKey: clusterKey,
 	}
 }
 
-func (c *Client) RegisterStorageServer(address string) error {
-	url := fmt.Sprintf("http://%s/register", c.address)
+func (c *Client) RegisterStorageServer(ctx context.Context, address string) error {
+	url := fmt.Sprintf("%s://%s/register", c.scheme, c.address)
 	body := strings.NewReader(address)
 
-	req, err := http.NewRequestWithContext(context.Background(), "POST", url, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
 		return err
 	}
 
+	if c.clusterKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.clusterKey)
+	}
+
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return err
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
-		return errors.New(
-			fmt.Sprintf("status code: %d %s", resp.StatusCode, resp.Status))
+		return responseError(resp)
 	}
 
 	return nil
 }
+
+// responseError returns the error of an unsuccessful response. Client errors
+// are rejections of the request, they are marked permanent.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	err := fmt.Errorf("status code: %d %s: %s",
+		resp.StatusCode, resp.Status, bytes.TrimSpace(body))
+
+	switch {
+	case resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests:
+		return err
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return resilience.Permanent(err)
+	}
+
+	return err
+}
+
+type registerClient interface {
+	RegisterStorageServer(ctx context.Context, address string) error
+}
+
+// Resilient applies a resilience policy to the calls of a chunk manager
+// client of any transport.
+type Resilient struct {
+	client  registerClient
+	address string
+	policy  *resilience.Policy
+}
+
+// NewResilient returns a client calling the chunk manager at address through
+// client under policy.
+func NewResilient(client registerClient, address string, policy *resilience.Policy) *Resilient {
+	return &Resilient{
+		client:  client,
+		address: address,
+		policy:  policy,
+	}
+}
+
+// RegisterStorageServer is retried, registering an address twice is harmless.
+func (c *Resilient) RegisterStorageServer(ctx context.Context, address string) error {
+	return c.policy.Do(ctx, c.address, true, func(ctx context.Context) error {
+		return c.client.RegisterStorageServer(ctx, address)
+	})
+}
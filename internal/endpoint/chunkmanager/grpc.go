@@ -0,0 +1,57 @@
+package chunkmanager
+
+import (
+	"context"
+	"log/slog"
+	"simple-storage/internal/entrypoint/grpc/pb"
+	"simple-storage/internal/logging"
+	"simple-storage/internal/resilience"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCClient is a chunk manager client over gRPC.
+type GRPCClient struct {
+	log *slog.Logger
+	// clusterKey authenticates storage servers, it is not sent if empty.
+	clusterKey string
+	client     pb.ChunkManagerClient
+}
+
+// NewGRPC returns a client of the chunk manager at the other end of conn.
+func NewGRPC(
+	log *slog.Logger, conn grpc.ClientConnInterface, clusterKey string,
+) *GRPCClient {
+	log = logging.Component(log, "chunk-manager-client")
+
+	return &GRPCClient{
+		log:        log,
+		clusterKey: clusterKey,
+		client:     pb.NewChunkManagerClient(conn),
+	}
+}
+
+func (c *GRPCClient) RegisterStorageServer(ctx context.Context, address string) error {
+	if c.clusterKey != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.clusterKey)
+	}
+
+	_, err := c.client.RegisterStorageServer(
+		ctx, &pb.RegisterStorageServerRequest{Address: address})
+
+	return grpcError(err)
+}
+
+// grpcError marks errors rejecting the request as permanent.
+func grpcError(err error) error {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists,
+		codes.PermissionDenied, codes.Unauthenticated, codes.FailedPrecondition:
+		return resilience.Permanent(err)
+	}
+
+	return err
+}
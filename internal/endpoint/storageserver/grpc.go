@@ -0,0 +1,226 @@
+package storageserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"simple-storage/internal/entrypoint/grpc/pb"
+	"simple-storage/internal/logging"
+	"simple-storage/internal/resilience"
+	"simple-storage/internal/tracing"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCClient is a storage server client over gRPC.
+type GRPCClient struct {
+	log    *slog.Logger
+	client pb.StorageServerClient
+	health healthpb.HealthClient
+	// err is returned by every call if there is no connection.
+	err error
+}
+
+// NewGRPC returns a client of the storage server at the other end of conn.
+func NewGRPC(log *slog.Logger, conn grpc.ClientConnInterface) *GRPCClient {
+	log = logging.Component(log, "storage-server-client")
+
+	return &GRPCClient{
+		log:    log,
+		client: pb.NewStorageServerClient(conn),
+		health: healthpb.NewHealthClient(conn),
+	}
+}
+
+// UploadChunk streams the chunk in frames.
+func (c *GRPCClient) UploadChunk(
+	ctx context.Context, chunkID string, checksum uint32, _ int64, r io.Reader,
+) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.client.UploadChunk(ctx)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	var (
+		req = &pb.UploadChunkRequest{ChunkId: chunkID, Checksum: &checksum}
+		buf = make([]byte, pb.FrameSize)
+	)
+
+	for first := true; ; first = false {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failure to read chunk: %s: %w", chunkID, err)
+		}
+
+		if n == 0 && !first {
+			break
+		}
+
+		req.Data = buf[:n]
+
+		// The server has failed if the stream is closed, CloseAndRecv
+		// returns the reason.
+		if err := stream.Send(req); err == io.EOF {
+			break
+		} else if err != nil {
+			return grpcError(err)
+		}
+
+		if n < len(buf) {
+			break
+		}
+
+		req = &pb.UploadChunkRequest{}
+	}
+
+	_, err = stream.CloseAndRecv()
+
+	return grpcError(err)
+}
+
+// DownloadChunk writes the streamed frames to w.
+func (c *GRPCClient) DownloadChunk(
+	ctx context.Context, chunkID string, w io.Writer,
+) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := c.client.DownloadChunk(ctx, &pb.DownloadChunkRequest{ChunkId: chunkID})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failure to read chunk: %s: %w", chunkID, grpcError(err))
+		}
+
+		if _, err := w.Write(resp.Data); err != nil {
+			return fmt.Errorf("failure to read chunk: %s: %w", chunkID, err)
+		}
+	}
+}
+
+func (c *GRPCClient) DeleteChunk(ctx context.Context, chunkID string) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	_, err := c.client.DeleteChunk(ctx, &pb.DeleteChunkRequest{ChunkId: chunkID})
+
+	return grpcError(err)
+}
+
+// Probe returns an error unless the storage server reports that it is
+// serving in a gRPC health check.
+func (c *GRPCClient) Probe(ctx context.Context) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	resp, err := c.health.Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("storage-server is %s", resp.Status)
+	}
+
+	return nil
+}
+
+// GRPCPool keeps one connection per storage server address.
+type GRPCPool struct {
+	log   *slog.Logger
+	opts  []grpc.DialOption
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+// NewGRPCPool returns a pool dialing storage servers with opts. Calls carry
+// the trace context and the request id of their context.
+func NewGRPCPool(log *slog.Logger, opts ...grpc.DialOption) *GRPCPool {
+	opts = append(opts,
+		grpc.WithChainUnaryInterceptor(tracing.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(tracing.StreamClientInterceptor()),
+	)
+
+	return &GRPCPool{
+		log:   log,
+		opts:  opts,
+		conns: map[string]*grpc.ClientConn{},
+	}
+}
+
+// Client returns a client of the storage server. Connections are established
+// lazily and shared by clients of the same address.
+func (p *GRPCPool) Client(address string) *GRPCClient {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conn, ok := p.conns[address]
+	if !ok {
+		var err error
+
+		conn, err = grpc.NewClient(address, p.opts...)
+		if err != nil {
+			return &GRPCClient{
+				err: fmt.Errorf("failure to connect storage-server: %s: %w", address, err),
+			}
+		}
+
+		p.conns[address] = conn
+	}
+
+	return NewGRPC(p.log, conn)
+}
+
+// Close closes all connections.
+func (p *GRPCPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for address, conn := range p.conns {
+		if err := conn.Close(); err != nil {
+			p.log.Error("failure to close connection",
+				logging.StorageServer(address), logging.Err(err))
+		}
+
+		delete(p.conns, address)
+	}
+
+	return nil
+}
+
+// grpcError marks errors rejecting the request as permanent.
+func grpcError(err error) error {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists,
+		codes.PermissionDenied, codes.Unauthenticated, codes.FailedPrecondition:
+		return resilience.Permanent(err)
+	}
+
+	return err
+}
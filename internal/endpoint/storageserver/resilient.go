@@ -0,0 +1,99 @@
+package storageserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"simple-storage/internal/resilience"
+)
+
+type chunkClient interface {
+	UploadChunk(ctx context.Context, chunkID string, checksum uint32, size int64, r io.Reader) error
+	DownloadChunk(ctx context.Context, chunkID string, w io.Writer) error
+	DeleteChunk(ctx context.Context, chunkID string) error
+}
+
+// Resilient applies a resilience policy to the calls of a storage server
+// client of any transport.
+type Resilient struct {
+	client  chunkClient
+	address string
+	policy  *resilience.Policy
+}
+
+// NewResilient returns a client calling the storage server at address through
+// client under policy.
+func NewResilient(client chunkClient, address string, policy *resilience.Policy) *Resilient {
+	return &Resilient{
+		client:  client,
+		address: address,
+		policy:  policy,
+	}
+}
+
+// UploadChunk is retried only if r can be rewound, that is if it is an
+// io.Seeker.
+func (c *Resilient) UploadChunk(
+	ctx context.Context, chunkID string, checksum uint32, size int64, r io.Reader,
+) error {
+	seeker, idempotent := r.(io.Seeker)
+
+	var start int64
+
+	if idempotent {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("failure to upload chunk: %s: %w", chunkID, err)
+		}
+
+		start = offset
+	}
+
+	first := true
+
+	return c.policy.Do(ctx, c.address, idempotent, func(ctx context.Context) error {
+		if !first {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return resilience.Final(err)
+			}
+		}
+
+		first = false
+
+		return c.client.UploadChunk(ctx, chunkID, checksum, size, r)
+	})
+}
+
+// DownloadChunk is retried only until the first byte is written to w.
+func (c *Resilient) DownloadChunk(
+	ctx context.Context, chunkID string, w io.Writer,
+) error {
+	cw := &countingWriter{w: w}
+
+	return c.policy.Do(ctx, c.address, true, func(ctx context.Context) error {
+		err := c.client.DownloadChunk(ctx, chunkID, cw)
+		if err != nil && cw.n > 0 {
+			return resilience.Final(err)
+		}
+
+		return err
+	})
+}
+
+func (c *Resilient) DeleteChunk(ctx context.Context, chunkID string) error {
+	return c.policy.Do(ctx, c.address, true, func(ctx context.Context) error {
+		return c.client.DeleteChunk(ctx, chunkID)
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+
+	return n, err
+}
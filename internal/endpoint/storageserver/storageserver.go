@@ -3,96 +3,200 @@ package storageserver
 import (
 	"bytes"
 	"context"
-	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"mime/multipart"
 	"net/http"
-	"simple-storage/internal/utils"
+	"os"
+	"simple-storage/internal/logging"
+	"simple-storage/internal/resilience"
+	"simple-storage/internal/tracing"
+
+	"go.opentelemetry.io/otel/propagation"
 )
 
+// checksumHeader carries hex encoded CRC32C of an uploaded chunk.
+const checksumHeader = "X-Checksum-Crc32c"
+
+// maxErrorBody bounds the part of an error response included in the error.
+const maxErrorBody = 512
+
 type httpClient interface {
 	Do(req *http.Request) (resp *http.Response, err error)
 }
 
 type Client struct {
-	log     *log.Logger
+	log *slog.Logger
+	// scheme is http or https.
+	scheme  string
 	address string
 	client  httpClient
 }
 
-func New(log *log.Logger, address string, httpClient httpClient) *Client {
-	log = utils.LoggerExtendWithPrefix(log, "storage-server-client ->")
+func New(log *slog.Logger, scheme, address string, httpClient httpClient) *Client {
+	log = logging.Component(log, "storage-server-client")
 
 	return &Client{
 		log:     log,
 		client:  httpClient,
+		scheme:  scheme,
 		address: address,
 	}
 }
 
-func (c *Client) UploadChunk(chunkID string, buf []byte) error {
-	url := fmt.Sprintf("http://%s", c.address)
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+// UploadChunk streams the chunk in a multipart request.
+func (c *Client) UploadChunk(
+	ctx context.Context, chunkID string, checksum uint32, _ int64, r io.Reader,
+) error {
+	url := fmt.Sprintf("%s://%s", c.scheme, c.address)
+
+	body, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	done := make(chan struct{})
+
+	// The writer is stopped before returning, so r is not read after the
+	// call, for example while it is rewound for a retry.
+	defer func() {
+		body.Close()
+		<-done
+	}()
+
+	go func() {
+		defer close(done)
+
+		fw, err := writer.CreateFormFile("chunk", chunkID)
+		if err == nil {
+			_, err = io.Copy(fw, r)
+		}
 
-	fw, err := writer.CreateFormFile("chunk", chunkID)
+		if err == nil {
+			err = writer.Close()
+		}
+
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, body)
 	if err != nil {
 		return err
 	}
 
-	_, err = io.Copy(fw, bytes.NewReader(buf))
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set(checksumHeader, fmt.Sprintf("%08x", checksum))
+
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.client.Do(req)
 	if err != nil {
 		return err
 	}
 
-	writer.Close()
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
+	return nil
+}
 
-	req, err := http.NewRequestWithContext(context.Background(), "PUT", url, body)
+// DownloadChunk writes the response body to w.
+func (c *Client) DownloadChunk(
+	ctx context.Context, chunkID string, w io.Writer,
+) error {
+	url := fmt.Sprintf("%s://%s/?id=%s", c.scheme, c.address, chunkID)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return err
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
-		return errors.New(
-			fmt.Sprintf("status code: %d %s", resp.StatusCode, resp.Status))
+		return responseError(resp)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	if err != nil {
+		return fmt.Errorf("failure to read chunk: %s: %w", chunkID, err)
 	}
 
 	return nil
 }
 
-func (c *Client) DownloadChunk(chunkID string, buf []byte) error {
-	url := fmt.Sprintf("http://%s/?id=%s", c.address, chunkID)
+func (c *Client) DeleteChunk(ctx context.Context, chunkID string) error {
+	url := fmt.Sprintf("%s://%s/?id=%s", c.scheme, c.address, chunkID)
 
-	req, err := http.NewRequestWithContext(context.Background(), "GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
 		return err
 	}
 
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return err
 	}
 
+	defer resp.Body.Close()
+
 	if resp.StatusCode != http.StatusOK {
-		return errors.New(
-			fmt.Sprintf("status code: %d %s", resp.StatusCode, resp.Status))
+		return responseError(resp)
 	}
 
-	defer resp.Body.Close()
+	return nil
+}
 
-	_, err = resp.Body.Read(buf)
-	if err != nil && !errors.Is(err, io.EOF) {
+// Probe returns an error unless the storage server is ready on /readyz.
+func (c *Client) Probe(ctx context.Context) error {
+	url := fmt.Sprintf("%s://%s/readyz", c.scheme, c.address)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
 		return err
 	}
 
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+
 	return nil
 }
+
+// responseError returns the error of an unsuccessful response. Client errors
+// are rejections of the request, they are marked permanent.
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	err := fmt.Errorf("status code: %d %s: %s",
+		resp.StatusCode, resp.Status, bytes.TrimSpace(body))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return resilience.Permanent(fmt.Errorf("%w: %s", os.ErrNotExist, err))
+	case resp.StatusCode == http.StatusRequestTimeout,
+		resp.StatusCode == http.StatusTooManyRequests:
+		return err
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return resilience.Permanent(err)
+	}
+
+	return err
+}
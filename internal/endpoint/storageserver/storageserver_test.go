@@ -0,0 +1,410 @@
+package storageserver_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"simple-storage/internal/apiserver"
+	"simple-storage/internal/chunkproto"
+	client "simple-storage/internal/endpoint/storageserver"
+	"simple-storage/internal/entrypoint/grpc/pb"
+	grpcHandler "simple-storage/internal/entrypoint/grpc/storageserver"
+	httpHandler "simple-storage/internal/entrypoint/http/storageserver"
+	"simple-storage/internal/entrypoint/tcp"
+	tcpHandler "simple-storage/internal/entrypoint/tcp/storageserver"
+	"simple-storage/internal/resilience"
+	"simple-storage/internal/storageserver"
+	"simple-storage/internal/tracing"
+	"simple-storage/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type chunkManager struct{}
+
+func (chunkManager) RegisterStorageServer(context.Context, string) error { return nil }
+
+// transports returns clients of one storage server keeping chunks in a
+// temporary directory, one client per transport.
+func transports(tb testing.TB) map[string]apiserver.StorageServer {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ss := storageserver.New(logger, storageserver.Config{
+		DataDirectory: tb.TempDir(),
+	}, chunkManager{})
+
+	httpServer := httptest.NewServer(httpHandler.New(logger, httpHandler.Config{}, ss))
+	tb.Cleanup(httpServer.Close)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(tb, err)
+
+	grpcServer := grpc.NewServer()
+	pb.RegisterStorageServerServer(grpcServer, grpcHandler.New(logger, ss))
+	healthpb.RegisterHealthServer(grpcServer, grpcHandler.NewHealth(ss.Ready))
+
+	go grpcServer.Serve(listener)
+	tb.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(listener.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(tb, err)
+	tb.Cleanup(func() { conn.Close() })
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(tb, err)
+
+	tcpServer := tcp.New(logger, tcp.Config{}, tcpHandler.New(logger, 1<<30, ss))
+
+	go tcpServer.Serve(tcpListener)
+	tb.Cleanup(func() { tcpServer.Shutdown(context.Background()) })
+
+	pool := client.NewTCPPool(logger, client.TCPConfig{ConnsPerAddress: 2})
+	tb.Cleanup(func() { pool.Close() })
+
+	return map[string]apiserver.StorageServer{
+		"http": client.New(logger, "http",
+			strings.TrimPrefix(httpServer.URL, "http://"), &http.Client{}),
+		"grpc": client.NewGRPC(logger, conn),
+		"tcp":  pool.Client(tcpListener.Addr().String()),
+	}
+}
+
+func TestClient_transports(t *testing.T) {
+	ctx := context.Background()
+
+	for name, ss := range transports(t) {
+		for _, size := range []int{0, 1, 3*pb.FrameSize + 7} {
+			chunkID := fmt.Sprintf("%s-%d", name, size)
+
+			buf := make([]byte, size)
+			rand.Read(buf)
+
+			checksum := utils.NewChecksum()
+			checksum.Write(buf)
+
+			err := ss.UploadChunk(
+				ctx, chunkID, checksum.Sum32(), int64(size), bytes.NewReader(buf))
+			require.NoError(t, err, name)
+
+			downloaded := new(bytes.Buffer)
+			require.NoError(t, ss.DownloadChunk(ctx, chunkID, downloaded), name)
+			require.Equal(t, buf, append([]byte{}, downloaded.Bytes()...), name)
+
+			require.NoError(t, ss.DeleteChunk(ctx, chunkID), name)
+			require.Error(t, ss.DownloadChunk(ctx, chunkID, io.Discard), name)
+		}
+
+		err := ss.UploadChunk(ctx, name+"-corrupted", 0, 12, strings.NewReader("Hello World!"))
+		require.Error(t, err, name)
+	}
+}
+
+func TestClient_invalidChunkID(t *testing.T) {
+	ctx := context.Background()
+
+	for name, ss := range transports(t) {
+		for _, chunkID := range []string{"../escape", "a/b", "..", strings.Repeat("a", 65)} {
+			err := ss.UploadChunk(ctx, chunkID, 0, 0, strings.NewReader(""))
+			require.True(t, resilience.IsPermanent(err), "%s %q: %v", name, chunkID, err)
+
+			err = ss.DownloadChunk(ctx, chunkID, io.Discard)
+			require.True(t, resilience.IsPermanent(err), "%s %q: %v", name, chunkID, err)
+
+			err = ss.DeleteChunk(ctx, chunkID)
+			require.True(t, resilience.IsPermanent(err), "%s %q: %v", name, chunkID, err)
+		}
+	}
+}
+
+// TestClient_probe probes the storage server over the transports which
+// serve probes without the HTTP entrypoint.
+func TestClient_probe(t *testing.T) {
+	ctx := context.Background()
+	ss := transports(t)
+
+	// The storage server is ready once it has registered itself.
+	require.Eventually(t, func() bool {
+		return ss["grpc"].(*client.GRPCClient).Probe(ctx) == nil
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, ss["tcp"].(*client.TCPClient).Probe(ctx))
+}
+
+func TestHTTPHandler_checksumMismatch(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+
+	ss := storageserver.New(logger, storageserver.Config{DataDirectory: dir}, chunkManager{})
+
+	server := httptest.NewServer(httpHandler.New(logger, httpHandler.Config{}, ss))
+	defer server.Close()
+
+	// A chunk is rejected if its checksum does not match or is missing.
+	for _, checksum := range []string{
+		fmt.Sprintf("%08x", utils.Checksum([]byte("Hello World?"))),
+		"",
+	} {
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+
+		part, err := writer.CreateFormFile("chunk", "chunk1")
+		require.NoError(t, err)
+
+		part.Write([]byte("Hello World!"))
+		require.NoError(t, writer.Close())
+
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/", body)
+		require.NoError(t, err)
+
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("X-Checksum-Crc32c", checksum)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, checksum)
+
+		// Neither the chunk nor its temporary file is left.
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+
+		resp, err = http.Get(server.URL + "/?id=chunk1")
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+// cancelingReader cancels the transfer after the first read.
+type cancelingReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (r *cancelingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.cancel()
+
+	return n, err
+}
+
+// cancelingWriter cancels the transfer after the first write.
+type cancelingWriter struct {
+	cancel context.CancelFunc
+}
+
+func (w *cancelingWriter) Write(p []byte) (int, error) {
+	w.cancel()
+
+	return len(p), nil
+}
+
+func TestClient_cancel(t *testing.T) {
+	const size = 8 << 20
+
+	buf := make([]byte, size)
+	rand.Read(buf)
+
+	checksum := utils.NewChecksum()
+	checksum.Write(buf)
+
+	for name, ss := range transports(t) {
+		chunkID := name + "-canceled"
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		err := ss.UploadChunk(ctx, chunkID, checksum.Sum32(), size,
+			&cancelingReader{r: bytes.NewReader(buf), cancel: cancel})
+		require.Error(t, err, name)
+
+		// Nothing is kept of a canceled upload.
+		require.Error(t, ss.DownloadChunk(context.Background(), chunkID, io.Discard), name)
+
+		err = ss.UploadChunk(context.Background(), chunkID, checksum.Sum32(), size,
+			bytes.NewReader(buf))
+		require.NoError(t, err, name)
+
+		ctx, cancel = context.WithCancel(context.Background())
+
+		err = ss.DownloadChunk(ctx, chunkID, &cancelingWriter{cancel: cancel})
+		require.Error(t, err, name)
+
+		require.NoError(t, ss.DeleteChunk(context.Background(), chunkID), name)
+	}
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, io.ErrShortWrite }
+
+// TestTCPClient_pipelining runs requests of many goroutines over shared
+// connections.
+func TestTCPClient_pipelining(t *testing.T) {
+	ctx := context.Background()
+	ss := transports(t)["tcp"].(*client.TCPClient)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			buf := make([]byte, 1000+i)
+			rand.Read(buf)
+
+			checksum := utils.NewChecksum()
+			checksum.Write(buf)
+
+			chunkID := fmt.Sprintf("pipelined-%d", i)
+
+			assert.NoError(t, ss.UploadChunk(
+				ctx, chunkID, checksum.Sum32(), int64(len(buf)), bytes.NewReader(buf)))
+
+			size, err := ss.StatChunk(ctx, chunkID)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(buf)), size)
+
+			downloaded := new(bytes.Buffer)
+			assert.NoError(t, ss.DownloadChunk(ctx, chunkID, downloaded))
+			assert.Equal(t, buf, downloaded.Bytes())
+		}(i)
+	}
+
+	wg.Wait()
+
+	_, err := ss.StatChunk(ctx, "missing")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// A download into a failing writer fails, the connection is still
+	// usable.
+	require.ErrorIs(t, ss.DownloadChunk(ctx, "pipelined-0", failingWriter{}), io.ErrShortWrite)
+	require.NoError(t, ss.DeleteChunk(ctx, "pipelined-0"))
+
+	// Metadata too long for a frame fails only its request, it is not
+	// retried.
+	long := tracing.WithRequestID(ctx, strings.Repeat("a", 2000))
+
+	_, err = ss.StatChunk(long, "pipelined-1")
+	require.ErrorIs(t, err, chunkproto.ErrInvalidHeader)
+	require.True(t, resilience.IsPermanent(err))
+
+	_, err = ss.StatChunk(ctx, "pipelined-1")
+	require.NoError(t, err)
+}
+
+// BenchmarkClient compares transports by uploading and downloading chunks of
+// the same size.
+func BenchmarkClient(b *testing.B) {
+	ctx := context.Background()
+
+	clients := transports(b)
+
+	for _, size := range []int{10 << 10, 256 << 10, 4 << 20} {
+		buf := make([]byte, size)
+		rand.Read(buf)
+
+		checksum := utils.NewChecksum()
+		checksum.Write(buf)
+
+		for _, name := range []string{"http", "grpc", "tcp"} {
+			ss := clients[name]
+
+			b.Run(fmt.Sprintf("%s/%dKiB", name, size>>10), func(b *testing.B) {
+				downloaded := bytes.NewBuffer(make([]byte, 0, size))
+
+				b.SetBytes(int64(2 * size))
+
+				for i := 0; i < b.N; i++ {
+					chunkID := fmt.Sprintf("%s-%d-%d", name, size, i)
+
+					err := ss.UploadChunk(
+						ctx, chunkID, checksum.Sum32(), int64(size), bytes.NewReader(buf))
+					if err != nil {
+						b.Fatal(err)
+					}
+
+					downloaded.Reset()
+
+					if err := ss.DownloadChunk(ctx, chunkID, downloaded); err != nil {
+						b.Fatal(err)
+					}
+
+					if err := ss.DeleteChunk(ctx, chunkID); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// flakyClient fails the first calls after consuming a part of the upload.
+type flakyClient struct {
+	apiserver.StorageServer
+	failures int
+}
+
+func (c *flakyClient) UploadChunk(
+	ctx context.Context, chunkID string, checksum uint32, size int64, r io.Reader,
+) error {
+	if c.failures > 0 {
+		c.failures--
+
+		io.CopyN(io.Discard, r, size/2)
+
+		return io.ErrUnexpectedEOF
+	}
+
+	return c.StorageServer.UploadChunk(ctx, chunkID, checksum, size, r)
+}
+
+func TestResilient(t *testing.T) {
+	ctx := context.Background()
+
+	buf := make([]byte, 3*pb.FrameSize+7)
+	rand.Read(buf)
+
+	for name, ss := range transports(t) {
+		policy := resilience.New(slog.New(slog.NewTextHandler(io.Discard, nil)), resilience.Config{MaxAttempts: 3})
+		rc := client.NewResilient(&flakyClient{StorageServer: ss, failures: 2}, name, policy)
+
+		err := rc.UploadChunk(ctx, name, utils.Checksum(buf), int64(len(buf)), bytes.NewReader(buf))
+		require.NoError(t, err, name)
+
+		downloaded := new(bytes.Buffer)
+		require.NoError(t, rc.DownloadChunk(ctx, name, downloaded), name)
+		require.Equal(t, buf, downloaded.Bytes(), name)
+
+		// A missing chunk is a rejection, it is not retried.
+		require.NoError(t, rc.DeleteChunk(ctx, name), name)
+		require.Error(t, rc.DownloadChunk(ctx, name, io.Discard), name)
+
+		stats := policy.Stats()[name]
+		require.Equal(t, int64(2), stats.Retries, name)
+		require.Equal(t, int64(2), stats.Failures, name)
+	}
+}
@@ -0,0 +1,514 @@
+package storageserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"simple-storage/internal/chunkproto"
+	"simple-storage/internal/logging"
+	"simple-storage/internal/resilience"
+	"simple-storage/internal/tracing"
+	"simple-storage/internal/utils"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var errPoolClosed = errors.New("connection pool is closed")
+
+// TCPConfig declares how a TCPPool connects storage servers.
+type TCPConfig struct {
+	// TLS makes connections use TLS if it is set.
+	TLS *tls.Config
+	// ConnsPerAddress is the number of connections requests to a storage
+	// server are spread over, one if it is zero.
+	ConnsPerAddress int
+	DialTimeout     time.Duration
+}
+
+// TCPPool keeps connections to storage servers serving the binary chunk
+// protocol. Requests are pipelined, a connection carries requests of many
+// clients at once.
+type TCPPool struct {
+	log    *slog.Logger
+	config TCPConfig
+
+	mu        sync.Mutex
+	addresses map[string]*tcpAddress
+	closed    bool
+}
+
+// tcpAddress holds connections to one storage server.
+type tcpAddress struct {
+	mu    sync.Mutex
+	conns []*tcpConn
+	next  int
+}
+
+// NewTCPPool returns a pool dialing storage servers with config.
+func NewTCPPool(log *slog.Logger, config TCPConfig) *TCPPool {
+	if config.ConnsPerAddress <= 0 {
+		config.ConnsPerAddress = 1
+	}
+
+	return &TCPPool{
+		log:       logging.Component(log, "storage-server-client"),
+		config:    config,
+		addresses: map[string]*tcpAddress{},
+	}
+}
+
+// Client returns a client of the storage server. Connections are established
+// lazily and shared by clients of the same address.
+func (p *TCPPool) Client(address string) *TCPClient {
+	return &TCPClient{pool: p, address: address}
+}
+
+// Close closes all connections, calls in progress fail.
+func (p *TCPPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+
+	for address, a := range p.addresses {
+		a.mu.Lock()
+		for _, conn := range a.conns {
+			if conn != nil {
+				conn.fail(errPoolClosed)
+			}
+		}
+		a.mu.Unlock()
+
+		delete(p.addresses, address)
+	}
+
+	return nil
+}
+
+// conn returns the next connection to the address, broken connections are
+// replaced.
+func (p *TCPPool) conn(address string) (*tcpConn, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, errPoolClosed
+	}
+
+	a, ok := p.addresses[address]
+	if !ok {
+		a = &tcpAddress{conns: make([]*tcpConn, p.config.ConnsPerAddress)}
+		p.addresses[address] = a
+	}
+	p.mu.Unlock()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	i := a.next
+	a.next = (a.next + 1) % len(a.conns)
+
+	if conn := a.conns[i]; conn != nil && conn.broken() == nil {
+		return conn, nil
+	}
+
+	conn, err := p.dial(address)
+	if err != nil {
+		return nil, fmt.Errorf("failure to connect storage-server: %s: %w", address, err)
+	}
+
+	a.conns[i] = conn
+
+	return conn, nil
+}
+
+func (p *TCPPool) dial(address string) (*tcpConn, error) {
+	dialer := &net.Dialer{Timeout: p.config.DialTimeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	if p.config.TLS != nil {
+		config := p.config.TLS.Clone()
+
+		if config.ServerName == "" {
+			if host, _, err := net.SplitHostPort(address); err == nil {
+				config.ServerName = host
+			}
+		}
+
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, config)
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := &tcpConn{
+		log:     p.log,
+		conn:    conn,
+		reader:  chunkproto.NewReader(conn, math.MaxInt64),
+		writer:  chunkproto.NewWriter(conn),
+		pending: map[uint32]*tcpCall{},
+	}
+
+	go c.readLoop()
+
+	return c, nil
+}
+
+// TCPClient is a storage server client over the binary chunk protocol.
+type TCPClient struct {
+	pool    *TCPPool
+	address string
+}
+
+func (c *TCPClient) do(
+	ctx context.Context, req chunkproto.Header, payload io.Reader, w io.Writer,
+) (chunkproto.Header, []byte, error) {
+	conn, err := c.pool.conn(c.address)
+	if err != nil {
+		return chunkproto.Header{}, nil, err
+	}
+
+	// The trace context and the request id are sent as metadata.
+	req.Metadata = map[string]string{}
+	tracing.Inject(ctx, propagation.MapCarrier(req.Metadata))
+
+	resp, respPayload, err := conn.do(ctx, req, payload, w)
+	if err != nil {
+		return chunkproto.Header{}, nil, fmt.Errorf("failure to %s chunk: %s: %w", req.Op, req.Key, err)
+	}
+
+	if resp.Status != chunkproto.StatusOK {
+		err := fmt.Errorf("failure to %s chunk: %s: %s: %s",
+			req.Op, req.Key, resp.Status, respPayload)
+
+		if resp.Status == chunkproto.StatusNotFound {
+			err = fmt.Errorf("%w: %s", os.ErrNotExist, err)
+		}
+
+		// The storage server has rejected the request, unless it has failed
+		// to serve it.
+		if resp.Status != chunkproto.StatusError {
+			err = resilience.Permanent(err)
+		}
+
+		return resp, nil, err
+	}
+
+	return resp, respPayload, nil
+}
+
+// UploadChunk sends the chunk in one frame. The connection is dropped if
+// ctx is done while the chunk is sent.
+func (c *TCPClient) UploadChunk(
+	ctx context.Context, chunkID string, checksum uint32, size int64, r io.Reader,
+) error {
+	_, _, err := c.do(ctx, chunkproto.Header{
+		Op:       chunkproto.OpPutChunk,
+		Flags:    chunkproto.FlagChecksum,
+		Checksum: checksum,
+		Key:      chunkID,
+		Length:   uint64(size),
+	}, utils.NewContextReader(ctx, r), nil)
+
+	return err
+}
+
+// DownloadChunk writes the chunk to w. The connection is dropped if ctx is
+// done while the chunk is received.
+func (c *TCPClient) DownloadChunk(
+	ctx context.Context, chunkID string, w io.Writer,
+) error {
+	_, _, err := c.do(ctx, chunkproto.Header{
+		Op:  chunkproto.OpGetChunk,
+		Key: chunkID,
+	}, nil, w)
+
+	return err
+}
+
+func (c *TCPClient) DeleteChunk(ctx context.Context, chunkID string) error {
+	_, _, err := c.do(ctx, chunkproto.Header{
+		Op:  chunkproto.OpDeleteChunk,
+		Key: chunkID,
+	}, nil, nil)
+
+	return err
+}
+
+// StatChunk returns the size of the chunk.
+func (c *TCPClient) StatChunk(ctx context.Context, chunkID string) (int64, error) {
+	_, payload, err := c.do(ctx, chunkproto.Header{
+		Op:  chunkproto.OpStat,
+		Key: chunkID,
+	}, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(payload) != 8 {
+		return 0, fmt.Errorf("failure to STAT chunk: %s: %w", chunkID, chunkproto.ErrBadFrame)
+	}
+
+	return int64(binary.BigEndian.Uint64(payload)), nil
+}
+
+// probeChunkID is a chunk id no chunk has, since chunk ids are uuids.
+const probeChunkID = "probe"
+
+// Probe returns an error unless the storage server answers a STAT request,
+// a missing chunk is an answer.
+func (c *TCPClient) Probe(ctx context.Context) error {
+	_, err := c.StatChunk(ctx, probeChunkID)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// States of a call, the response payload is written to the writer of the
+// call only if it is still waiting. A call leaves callReading for callRead
+// under the lock of the connection once its payload has been read.
+const (
+	callWaiting int32 = iota
+	callReading
+	callRead
+	callAbandoned
+)
+
+type tcpCall struct {
+	// w receives the payload of a successful GET_CHUNK response.
+	w     io.Writer
+	state int32
+	done  chan struct{}
+	// interrupted is set under the lock of the connection once the read of
+	// the payload is interrupted by a read deadline.
+	interrupted bool
+
+	resp    chunkproto.Header
+	payload []byte
+	err     error
+}
+
+// tcpConn is a connection with pipelined requests, responses are read by
+// readLoop and passed to the calls waiting for them.
+type tcpConn struct {
+	log  *slog.Logger
+	conn net.Conn
+
+	writeMu sync.Mutex
+	writer  *chunkproto.Writer
+	reader  *chunkproto.Reader
+
+	mu      sync.Mutex
+	nextID  uint32
+	pending map[uint32]*tcpCall
+	err     error
+}
+
+func (c *tcpConn) broken() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+func (c *tcpConn) do(
+	ctx context.Context, req chunkproto.Header, payload io.Reader, w io.Writer,
+) (chunkproto.Header, []byte, error) {
+	call := &tcpCall{w: w, done: make(chan struct{})}
+
+	if payload == nil {
+		payload = bytes.NewReader(nil)
+	}
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return chunkproto.Header{}, nil, c.err
+	}
+
+	c.nextID++
+	req.RequestID = c.nextID
+	c.pending[req.RequestID] = call
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	err := c.writer.WriteFrameFrom(req, payload)
+	c.writeMu.Unlock()
+
+	// Nothing has been written for a header which can not be encoded, so
+	// the connection is kept and the request is not retried.
+	if errors.Is(err, chunkproto.ErrInvalidHeader) {
+		c.mu.Lock()
+		delete(c.pending, req.RequestID)
+		c.mu.Unlock()
+
+		return chunkproto.Header{}, nil, resilience.Permanent(err)
+	}
+
+	if err != nil {
+		c.fail(err)
+		<-call.done
+
+		return chunkproto.Header{}, nil, call.err
+	}
+
+	select {
+	case <-call.done:
+		return call.resp, call.payload, call.err
+	case <-ctx.Done():
+	}
+
+	// The response may have been received while ctx was done.
+	select {
+	case <-call.done:
+		return call.resp, call.payload, call.err
+	default:
+	}
+
+	// The response is skipped unless it is being written to w already.
+	if atomic.CompareAndSwapInt32(&call.state, callWaiting, callAbandoned) {
+		return chunkproto.Header{}, nil, ctx.Err()
+	}
+
+	// The read is interrupted only while the payload of this call is read,
+	// which drops the connection. A read deadline set later would fail the
+	// response of another call.
+	c.mu.Lock()
+	interrupted := atomic.LoadInt32(&call.state) == callReading
+	if interrupted {
+		call.interrupted = true
+		c.conn.SetReadDeadline(time.Now())
+	}
+	c.mu.Unlock()
+
+	<-call.done
+
+	if !interrupted {
+		return call.resp, call.payload, call.err
+	}
+
+	return chunkproto.Header{}, nil, ctx.Err()
+}
+
+func (c *tcpConn) readLoop() {
+	for {
+		resp, err := c.reader.Next()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+
+		c.mu.Lock()
+		call, ok := c.pending[resp.RequestID]
+		delete(c.pending, resp.RequestID)
+		c.mu.Unlock()
+
+		if !ok {
+			c.fail(fmt.Errorf("%w: unexpected request id: %d", chunkproto.ErrBadFrame, resp.RequestID))
+			return
+		}
+
+		call.resp = resp
+		reading := false
+
+		switch {
+		case resp.Status == chunkproto.StatusOK && resp.Op == chunkproto.OpGetChunk:
+			if !atomic.CompareAndSwapInt32(&call.state, callWaiting, callReading) {
+				break
+			}
+
+			reading = true
+
+			// The payload is skipped after w fails to keep the stream in
+			// sync.
+			w := &stickyWriter{w: call.w}
+			_, err = io.Copy(w, c.reader)
+			call.err = w.err
+		case resp.Length <= chunkproto.MaxKeyLength:
+			call.payload = make([]byte, resp.Length)
+			_, err = io.ReadFull(c.reader, call.payload)
+		}
+
+		if err == nil {
+			err = c.reader.Finish()
+		}
+
+		if reading {
+			c.mu.Lock()
+			atomic.StoreInt32(&call.state, callRead)
+
+			// The frame has been read before the deadline took effect, so
+			// the connection is kept.
+			if call.interrupted && err == nil {
+				c.conn.SetReadDeadline(time.Time{})
+			}
+			c.mu.Unlock()
+		}
+
+		// A corrupted frame fails only its call, any other error leaves the
+		// stream in an unknown state.
+		if errors.Is(err, chunkproto.ErrFrameChecksum) {
+			call.err = err
+		} else if err != nil {
+			call.err = err
+			close(call.done)
+			c.fail(err)
+
+			return
+		}
+
+		close(call.done)
+	}
+}
+
+// fail closes the connection and fails all pending calls with err.
+func (c *tcpConn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	c.err = err
+	c.conn.Close()
+
+	for id, call := range c.pending {
+		call.err = err
+		close(call.done)
+		delete(c.pending, id)
+	}
+}
+
+// stickyWriter keeps the first error of w and discards writes after it.
+type stickyWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *stickyWriter) Write(p []byte) (int, error) {
+	if w.err == nil {
+		_, w.err = w.w.Write(p)
+	}
+
+	return len(p), nil
+}
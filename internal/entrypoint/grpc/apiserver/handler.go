@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"simple-storage/internal/auth"
+	"simple-storage/internal/chunkmanager"
+	"simple-storage/internal/entrypoint/grpc/pb"
+	"simple-storage/internal/logging"
+	"simple-storage/internal/tlsconfig"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type ChunkManager interface {
+	RegisterStorageServer(address string) error
+	ListObjects(prefix, delimiter, startAfter string, limit int) chunkmanager.ListResult
+}
+
+// Config declares access control of the handler.
+type Config struct {
+	// Policy authorizes calls, there is no authorization if it is nil.
+	Policy *auth.Policy
+	// RegisterIdentities are certificate identities storage servers are
+	// allowed to register with, any client can register if it is empty.
+	RegisterIdentities []string
+}
+
+// Handler serves metadata operations of the chunk manager.
+type Handler struct {
+	pb.UnimplementedChunkManagerServer
+	log          *slog.Logger
+	config       Config
+	chunkManager ChunkManager
+}
+
+// New returns a gRPC handler.
+func New(
+	log *slog.Logger,
+	config Config,
+	chunkManager ChunkManager,
+) *Handler {
+	log = logging.Component(log, "grpc-handler")
+
+	return &Handler{
+		log:          log,
+		config:       config,
+		chunkManager: chunkManager,
+	}
+}
+
+func (han *Handler) RegisterStorageServer(
+	ctx context.Context, req *pb.RegisterStorageServerRequest,
+) (*pb.RegisterStorageServerResponse, error) {
+	if len(han.config.RegisterIdentities) > 0 {
+		var state *tls.ConnectionState
+
+		if p, ok := peer.FromContext(ctx); ok {
+			if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+				state = &info.State
+			}
+		}
+
+		if !tlsconfig.PeerAllowed(state, han.config.RegisterIdentities) {
+			han.log.ErrorContext(ctx, "registration is rejected: "+
+				"certificate identity is not allowed", logging.StorageServer(req.Address))
+			return nil, status.Error(codes.PermissionDenied,
+				"certificate identity is not allowed to register")
+		}
+	}
+
+	if han.config.Policy != nil {
+		principal, ok := auth.FromContext(ctx)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, auth.ErrUnauthenticated.Error())
+		}
+
+		if !principal.Cluster {
+			return nil, status.Error(codes.PermissionDenied,
+				fmt.Sprintf("%s: cluster credential required", auth.ErrForbidden))
+		}
+	}
+
+	if req.Address == "" {
+		return nil, status.Error(codes.InvalidArgument, "address should be set")
+	}
+
+	if err := han.chunkManager.RegisterStorageServer(req.Address); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.RegisterStorageServerResponse{}, nil
+}
+
+func (han *Handler) ListObjects(
+	ctx context.Context, req *pb.ListObjectsRequest,
+) (*pb.ListObjectsResponse, error) {
+	if han.config.Policy != nil {
+		principal, ok := auth.FromContext(ctx)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, auth.ErrUnauthenticated.Error())
+		}
+
+		if !principal.Allowed(auth.List, req.Prefix) {
+			return nil, status.Error(codes.PermissionDenied,
+				fmt.Sprintf("%s: %s on %q", auth.ErrForbidden, auth.List, req.Prefix))
+		}
+	}
+
+	if req.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit should not be negative")
+	}
+
+	res := han.chunkManager.ListObjects(
+		req.Prefix, req.Delimiter, req.StartAfter, int(req.Limit))
+
+	resp := &pb.ListObjectsResponse{
+		Objects:        make([]*pb.ObjectInfo, 0, len(res.Objects)),
+		CommonPrefixes: res.CommonPrefixes,
+		IsTruncated:    res.IsTruncated,
+		NextStartAfter: res.NextStartAfter,
+	}
+
+	for _, object := range res.Objects {
+		resp.Objects = append(resp.Objects, &pb.ObjectInfo{
+			Name:      object.Name,
+			VersionId: object.VersionID,
+			Size:      object.Size,
+			Created:   timestamppb.New(object.Created),
+			Chunks:    int32(object.Chunks),
+		})
+	}
+
+	return resp, nil
+}
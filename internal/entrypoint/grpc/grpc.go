@@ -0,0 +1,117 @@
+// Package grpc serves the internal gRPC transport.
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"simple-storage/internal/logging"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Authenticator identifies the client of a call by its secret key.
+type Authenticator interface {
+	// AuthenticateKey returns the call context carrying the identity of the
+	// client, or an error if the key is invalid.
+	AuthenticateKey(ctx context.Context, key string) (context.Context, error)
+}
+
+// Config declares configuration for the gRPC server.
+type Config struct {
+	Address string
+	// Authenticator authenticates every call if it is set.
+	Authenticator Authenticator
+	// TLS makes the server require TLS if it is set.
+	TLS *tls.Config
+}
+
+// ServerGRPC is a wraper on grpc.Server.
+type ServerGRPC struct {
+	log    *slog.Logger
+	config Config
+	server *grpc.Server
+}
+
+// New returns a gRPC server with services added by register.
+func New(
+	log *slog.Logger,
+	config Config,
+	register func(server *grpc.Server),
+) *ServerGRPC {
+	log = logging.Component(log, "grpc-server")
+
+	s := &ServerGRPC{
+		log:    log,
+		config: config,
+	}
+
+	// Log lines of calls carry their trace and request ids.
+	unary := []grpc.UnaryServerInterceptor{
+		s.interceptTracingUnary(),
+		s.interceptLoggingUnary(),
+	}
+	stream := []grpc.StreamServerInterceptor{
+		s.interceptTracingStream(),
+		s.interceptLoggingStream(),
+	}
+
+	if config.Authenticator != nil {
+		unary = append(unary, s.interceptAuthUnary(config.Authenticator))
+		stream = append(stream, s.interceptAuthStream(config.Authenticator))
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+
+	if config.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(config.TLS)))
+	}
+
+	s.server = grpc.NewServer(opts...)
+
+	register(s.server)
+
+	return s
+}
+
+// Start starts gRPC Server.
+func (s *ServerGRPC) Start() chan error {
+	serverErrors := make(chan error, 1)
+
+	go func() {
+		listener, err := net.Listen("tcp", s.config.Address)
+		if err != nil {
+			serverErrors <- err
+			return
+		}
+
+		s.log.Info("start gRPC API", slog.String("address", s.config.Address))
+		serverErrors <- s.server.Serve(listener)
+	}()
+
+	return serverErrors
+}
+
+// Shutdown stops gRPC Server, calls in progress are cancelled if they do not
+// finish before ctx is done.
+func (s *ServerGRPC) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,170 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"simple-storage/internal/auth"
+	"simple-storage/internal/logging"
+	"simple-storage/internal/tracing"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// interceptTracingUnary continues the trace of the caller in a span of the
+// unary call.
+func (s *ServerGRPC) interceptTracingUnary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, span := startSpan(ctx, info.FullMethod)
+
+		resp, err := handler(ctx, req)
+		endSpan(span, err)
+
+		return resp, err
+	}
+}
+
+// interceptTracingStream continues the trace of the caller in a span of the
+// streaming call.
+func (s *ServerGRPC) interceptTracingStream() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{}, ss grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		ctx, span := startSpan(ss.Context(), info.FullMethod)
+
+		err := handler(srv, &serverStream{ss, ctx})
+		endSpan(span, err)
+
+		return err
+	}
+}
+
+// startSpan starts a server span of the call with the trace context and the
+// request id of the incoming metadata.
+func startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	ctx = tracing.Extract(ctx, tracing.MetadataCarrier(md.Copy()))
+
+	return tracing.Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.RPCSystemGRPC, semconv.RPCMethod(method)))
+}
+
+func endSpan(span trace.Span, err error) {
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(status.Code(err))))
+	tracing.End(span, err)
+}
+
+// interceptLoggingUnary logs incoming unary calls.
+func (s *ServerGRPC) interceptLoggingUnary() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		s.logCall(ctx, info.FullMethod)
+
+		return handler(ctx, req)
+	}
+}
+
+// interceptLoggingStream logs incoming streaming calls.
+func (s *ServerGRPC) interceptLoggingStream() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{}, ss grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		s.logCall(ss.Context(), info.FullMethod)
+
+		return handler(srv, ss)
+	}
+}
+
+func (s *ServerGRPC) logCall(ctx context.Context, method string) {
+	var remoteAddr string
+
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+
+	s.log.InfoContext(ctx, "incoming grpc call",
+		slog.String("method", method), slog.String("remote_addr", remoteAddr))
+}
+
+// interceptAuthUnary rejects unary calls with invalid credentials.
+func (s *ServerGRPC) interceptAuthUnary(
+	authenticator Authenticator,
+) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx, err := s.authenticate(ctx, authenticator)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// interceptAuthStream rejects streaming calls with invalid credentials.
+func (s *ServerGRPC) interceptAuthStream(
+	authenticator Authenticator,
+) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{}, ss grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		ctx, err := s.authenticate(ss.Context(), authenticator)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &serverStream{ss, ctx})
+	}
+}
+
+// authenticate reads the key from the authorization or x-api-key metadata,
+// the same way HTTP requests carry it.
+func (s *ServerGRPC) authenticate(
+	ctx context.Context, authenticator Authenticator,
+) (context.Context, error) {
+	var key string
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if values := md.Get(auth.APIKeyHeader); len(values) > 0 {
+		key = values[0]
+	} else if values := md.Get("authorization"); len(values) > 0 {
+		key = auth.BearerToken(values[0])
+	}
+
+	ctx, err := authenticator.AuthenticateKey(ctx, key)
+	if err != nil {
+		s.log.ErrorContext(ctx, "failure to authenticate grpc call", logging.Err(err))
+
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return ctx, nil
+}
+
+// serverStream replaces the context of a stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
@@ -0,0 +1,146 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.24.4
+// source: chunkmanager.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	ChunkManager_RegisterStorageServer_FullMethodName = "/simplestorage.ChunkManager/RegisterStorageServer"
+	ChunkManager_ListObjects_FullMethodName           = "/simplestorage.ChunkManager/ListObjects"
+)
+
+// ChunkManagerClient is the client API for ChunkManager service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ChunkManagerClient interface {
+	RegisterStorageServer(ctx context.Context, in *RegisterStorageServerRequest, opts ...grpc.CallOption) (*RegisterStorageServerResponse, error)
+	ListObjects(ctx context.Context, in *ListObjectsRequest, opts ...grpc.CallOption) (*ListObjectsResponse, error)
+}
+
+type chunkManagerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewChunkManagerClient(cc grpc.ClientConnInterface) ChunkManagerClient {
+	return &chunkManagerClient{cc}
+}
+
+func (c *chunkManagerClient) RegisterStorageServer(ctx context.Context, in *RegisterStorageServerRequest, opts ...grpc.CallOption) (*RegisterStorageServerResponse, error) {
+	out := new(RegisterStorageServerResponse)
+	err := c.cc.Invoke(ctx, ChunkManager_RegisterStorageServer_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chunkManagerClient) ListObjects(ctx context.Context, in *ListObjectsRequest, opts ...grpc.CallOption) (*ListObjectsResponse, error) {
+	out := new(ListObjectsResponse)
+	err := c.cc.Invoke(ctx, ChunkManager_ListObjects_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ChunkManagerServer is the server API for ChunkManager service.
+// All implementations must embed UnimplementedChunkManagerServer
+// for forward compatibility
+type ChunkManagerServer interface {
+	RegisterStorageServer(context.Context, *RegisterStorageServerRequest) (*RegisterStorageServerResponse, error)
+	ListObjects(context.Context, *ListObjectsRequest) (*ListObjectsResponse, error)
+	mustEmbedUnimplementedChunkManagerServer()
+}
+
+// UnimplementedChunkManagerServer must be embedded to have forward compatible implementations.
+type UnimplementedChunkManagerServer struct {
+}
+
+func (UnimplementedChunkManagerServer) RegisterStorageServer(context.Context, *RegisterStorageServerRequest) (*RegisterStorageServerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterStorageServer not implemented")
+}
+func (UnimplementedChunkManagerServer) ListObjects(context.Context, *ListObjectsRequest) (*ListObjectsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListObjects not implemented")
+}
+func (UnimplementedChunkManagerServer) mustEmbedUnimplementedChunkManagerServer() {}
+
+// UnsafeChunkManagerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ChunkManagerServer will
+// result in compilation errors.
+type UnsafeChunkManagerServer interface {
+	mustEmbedUnimplementedChunkManagerServer()
+}
+
+func RegisterChunkManagerServer(s grpc.ServiceRegistrar, srv ChunkManagerServer) {
+	s.RegisterService(&ChunkManager_ServiceDesc, srv)
+}
+
+func _ChunkManager_RegisterStorageServer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterStorageServerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChunkManagerServer).RegisterStorageServer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChunkManager_RegisterStorageServer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChunkManagerServer).RegisterStorageServer(ctx, req.(*RegisterStorageServerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChunkManager_ListObjects_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListObjectsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChunkManagerServer).ListObjects(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChunkManager_ListObjects_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChunkManagerServer).ListObjects(ctx, req.(*ListObjectsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ChunkManager_ServiceDesc is the grpc.ServiceDesc for ChunkManager service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ChunkManager_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "simplestorage.ChunkManager",
+	HandlerType: (*ChunkManagerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RegisterStorageServer",
+			Handler:    _ChunkManager_RegisterStorageServer_Handler,
+		},
+		{
+			MethodName: "ListObjects",
+			Handler:    _ChunkManager_ListObjects_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "chunkmanager.proto",
+}
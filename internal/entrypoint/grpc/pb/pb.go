@@ -0,0 +1,7 @@
+// Package pb contains messages and services of the internal gRPC transport.
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative storageserver.proto chunkmanager.proto
+
+// FrameSize bounds the chunk content carried by one message.
+const FrameSize = 64 << 10
@@ -0,0 +1,251 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.24.4
+// source: storageserver.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	StorageServer_UploadChunk_FullMethodName   = "/simplestorage.StorageServer/UploadChunk"
+	StorageServer_DownloadChunk_FullMethodName = "/simplestorage.StorageServer/DownloadChunk"
+	StorageServer_DeleteChunk_FullMethodName   = "/simplestorage.StorageServer/DeleteChunk"
+)
+
+// StorageServerClient is the client API for StorageServer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type StorageServerClient interface {
+	// UploadChunk saves a chunk. The first message carries the chunk id and
+	// the checksum, every message may carry a part of the content.
+	UploadChunk(ctx context.Context, opts ...grpc.CallOption) (StorageServer_UploadChunkClient, error)
+	// DownloadChunk streams the content of a chunk.
+	DownloadChunk(ctx context.Context, in *DownloadChunkRequest, opts ...grpc.CallOption) (StorageServer_DownloadChunkClient, error)
+	DeleteChunk(ctx context.Context, in *DeleteChunkRequest, opts ...grpc.CallOption) (*DeleteChunkResponse, error)
+}
+
+type storageServerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewStorageServerClient(cc grpc.ClientConnInterface) StorageServerClient {
+	return &storageServerClient{cc}
+}
+
+func (c *storageServerClient) UploadChunk(ctx context.Context, opts ...grpc.CallOption) (StorageServer_UploadChunkClient, error) {
+	stream, err := c.cc.NewStream(ctx, &StorageServer_ServiceDesc.Streams[0], StorageServer_UploadChunk_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &storageServerUploadChunkClient{stream}
+	return x, nil
+}
+
+type StorageServer_UploadChunkClient interface {
+	Send(*UploadChunkRequest) error
+	CloseAndRecv() (*UploadChunkResponse, error)
+	grpc.ClientStream
+}
+
+type storageServerUploadChunkClient struct {
+	grpc.ClientStream
+}
+
+func (x *storageServerUploadChunkClient) Send(m *UploadChunkRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *storageServerUploadChunkClient) CloseAndRecv() (*UploadChunkResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(UploadChunkResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *storageServerClient) DownloadChunk(ctx context.Context, in *DownloadChunkRequest, opts ...grpc.CallOption) (StorageServer_DownloadChunkClient, error) {
+	stream, err := c.cc.NewStream(ctx, &StorageServer_ServiceDesc.Streams[1], StorageServer_DownloadChunk_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &storageServerDownloadChunkClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type StorageServer_DownloadChunkClient interface {
+	Recv() (*DownloadChunkResponse, error)
+	grpc.ClientStream
+}
+
+type storageServerDownloadChunkClient struct {
+	grpc.ClientStream
+}
+
+func (x *storageServerDownloadChunkClient) Recv() (*DownloadChunkResponse, error) {
+	m := new(DownloadChunkResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *storageServerClient) DeleteChunk(ctx context.Context, in *DeleteChunkRequest, opts ...grpc.CallOption) (*DeleteChunkResponse, error) {
+	out := new(DeleteChunkResponse)
+	err := c.cc.Invoke(ctx, StorageServer_DeleteChunk_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// StorageServerServer is the server API for StorageServer service.
+// All implementations must embed UnimplementedStorageServerServer
+// for forward compatibility
+type StorageServerServer interface {
+	// UploadChunk saves a chunk. The first message carries the chunk id and
+	// the checksum, every message may carry a part of the content.
+	UploadChunk(StorageServer_UploadChunkServer) error
+	// DownloadChunk streams the content of a chunk.
+	DownloadChunk(*DownloadChunkRequest, StorageServer_DownloadChunkServer) error
+	DeleteChunk(context.Context, *DeleteChunkRequest) (*DeleteChunkResponse, error)
+	mustEmbedUnimplementedStorageServerServer()
+}
+
+// UnimplementedStorageServerServer must be embedded to have forward compatible implementations.
+type UnimplementedStorageServerServer struct {
+}
+
+func (UnimplementedStorageServerServer) UploadChunk(StorageServer_UploadChunkServer) error {
+	return status.Errorf(codes.Unimplemented, "method UploadChunk not implemented")
+}
+func (UnimplementedStorageServerServer) DownloadChunk(*DownloadChunkRequest, StorageServer_DownloadChunkServer) error {
+	return status.Errorf(codes.Unimplemented, "method DownloadChunk not implemented")
+}
+func (UnimplementedStorageServerServer) DeleteChunk(context.Context, *DeleteChunkRequest) (*DeleteChunkResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteChunk not implemented")
+}
+func (UnimplementedStorageServerServer) mustEmbedUnimplementedStorageServerServer() {}
+
+// UnsafeStorageServerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to StorageServerServer will
+// result in compilation errors.
+type UnsafeStorageServerServer interface {
+	mustEmbedUnimplementedStorageServerServer()
+}
+
+func RegisterStorageServerServer(s grpc.ServiceRegistrar, srv StorageServerServer) {
+	s.RegisterService(&StorageServer_ServiceDesc, srv)
+}
+
+func _StorageServer_UploadChunk_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(StorageServerServer).UploadChunk(&storageServerUploadChunkServer{stream})
+}
+
+type StorageServer_UploadChunkServer interface {
+	SendAndClose(*UploadChunkResponse) error
+	Recv() (*UploadChunkRequest, error)
+	grpc.ServerStream
+}
+
+type storageServerUploadChunkServer struct {
+	grpc.ServerStream
+}
+
+func (x *storageServerUploadChunkServer) SendAndClose(m *UploadChunkResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *storageServerUploadChunkServer) Recv() (*UploadChunkRequest, error) {
+	m := new(UploadChunkRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _StorageServer_DownloadChunk_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DownloadChunkRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(StorageServerServer).DownloadChunk(m, &storageServerDownloadChunkServer{stream})
+}
+
+type StorageServer_DownloadChunkServer interface {
+	Send(*DownloadChunkResponse) error
+	grpc.ServerStream
+}
+
+type storageServerDownloadChunkServer struct {
+	grpc.ServerStream
+}
+
+func (x *storageServerDownloadChunkServer) Send(m *DownloadChunkResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _StorageServer_DeleteChunk_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteChunkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StorageServerServer).DeleteChunk(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: StorageServer_DeleteChunk_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StorageServerServer).DeleteChunk(ctx, req.(*DeleteChunkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// StorageServer_ServiceDesc is the grpc.ServiceDesc for StorageServer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var StorageServer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "simplestorage.StorageServer",
+	HandlerType: (*StorageServerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "DeleteChunk",
+			Handler:    _StorageServer_DeleteChunk_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "UploadChunk",
+			Handler:       _StorageServer_UploadChunk_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DownloadChunk",
+			Handler:       _StorageServer_DownloadChunk_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "storageserver.proto",
+}
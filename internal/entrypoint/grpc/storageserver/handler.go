@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"simple-storage/internal/entrypoint/grpc/pb"
+	"simple-storage/internal/logging"
+	"simple-storage/internal/storageserver"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type StorageServer interface {
+	UploadChunk(ctx context.Context, chunkID string, file io.Reader, checksum uint32) error
+	DownloadChunk(ctx context.Context, chunkID string) (io.ReadCloser, int64, error)
+	DeleteChunk(ctx context.Context, chunkID string) error
+}
+
+// Handler serves chunk operations of a storage server.
+type Handler struct {
+	pb.UnimplementedStorageServerServer
+	log           *slog.Logger
+	storageServer StorageServer
+}
+
+// New returns a gRPC handler.
+func New(
+	log *slog.Logger,
+	storageServer StorageServer,
+) *Handler {
+	log = logging.Component(log, "grpc-handler")
+
+	return &Handler{
+		log:           log,
+		storageServer: storageServer,
+	}
+}
+
+func (han *Handler) UploadChunk(stream pb.StorageServer_UploadChunkServer) error {
+	req, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "chunk id should be set")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if req.ChunkId == "" {
+		return status.Error(codes.InvalidArgument, "chunk id should be set")
+	}
+
+	if req.Checksum == nil {
+		return status.Error(codes.InvalidArgument, "checksum should be set")
+	}
+
+	body := &uploadReader{stream: stream, buf: req.Data}
+
+	err = han.storageServer.UploadChunk(stream.Context(), req.ChunkId, body, *req.Checksum)
+	if err != nil {
+		if errors.Is(err, storageserver.ErrChecksumMismatch) ||
+			errors.Is(err, storageserver.ErrInvalidChunkID) {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	return stream.SendAndClose(&pb.UploadChunkResponse{})
+}
+
+func (han *Handler) DownloadChunk(
+	req *pb.DownloadChunkRequest, stream pb.StorageServer_DownloadChunkServer,
+) error {
+	if req.ChunkId == "" {
+		return status.Error(codes.InvalidArgument, "chunk id should be set")
+	}
+
+	chunk, _, err := han.storageServer.DownloadChunk(stream.Context(), req.ChunkId)
+	if err != nil {
+		if errors.Is(err, storageserver.ErrInvalidChunkID) {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		if errors.Is(err, os.ErrNotExist) {
+			return status.Error(codes.NotFound, err.Error())
+		}
+
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	defer chunk.Close()
+
+	buf := make([]byte, pb.FrameSize)
+
+	for {
+		n, err := io.ReadFull(chunk, buf)
+		if n > 0 {
+			if err := stream.Send(&pb.DownloadChunkResponse{Data: buf[:n]}); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+
+		if err != nil {
+			return status.FromContextError(err).Err()
+		}
+	}
+}
+
+func (han *Handler) DeleteChunk(
+	ctx context.Context, req *pb.DeleteChunkRequest,
+) (*pb.DeleteChunkResponse, error) {
+	if req.ChunkId == "" {
+		return nil, status.Error(codes.InvalidArgument, "chunk id should be set")
+	}
+
+	if err := han.storageServer.DeleteChunk(ctx, req.ChunkId); err != nil {
+		if errors.Is(err, storageserver.ErrInvalidChunkID) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &pb.DeleteChunkResponse{}, nil
+}
+
+// uploadReader reads the chunk content from messages of an upload stream.
+type uploadReader struct {
+	stream pb.StorageServer_UploadChunkServer
+	buf    []byte
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+
+		r.buf = req.Data
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"context"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Health answers gRPC health checks with the readiness of the storage server.
+type Health struct {
+	healthpb.UnimplementedHealthServer
+	ready func() error
+}
+
+// NewHealth returns a health service reporting serving while ready succeeds.
+func NewHealth(ready func() error) *Health {
+	return &Health{ready: ready}
+}
+
+func (h *Health) Check(
+	context.Context, *healthpb.HealthCheckRequest,
+) (*healthpb.HealthCheckResponse, error) {
+	status := healthpb.HealthCheckResponse_SERVING
+	if err := h.ready(); err != nil {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	return &healthpb.HealthCheckResponse{Status: status}, nil
+}
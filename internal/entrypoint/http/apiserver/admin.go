@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"simple-storage/internal/apiserver"
+	"simple-storage/internal/chunkmanager"
+	"simple-storage/internal/encryption"
+	"simple-storage/internal/resilience"
+	"sort"
+)
+
+const adminPath = "/admin"
+
+// handleRotateMasterKey rotates to the key of the configured master key file.
+// The request names no file, so that clients cannot make the server read
+// arbitrary files.
+func (han *Handler) handleRotateMasterKey() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jobID, err := han.apiServer.RotateMasterKey()
+		if err != nil {
+			switch {
+			case errors.Is(err, apiserver.ErrRotationInProgress),
+				errors.Is(err, apiserver.ErrSameMasterKey),
+				errors.Is(err, apiserver.ErrNoMasterKeyFile):
+				han.ResponseWithError(w, r, err, http.StatusConflict)
+			case errors.Is(err, encryption.ErrInvalidKey):
+				// The configured file is invalid, not the request.
+				han.ResponseWithError(w, r, err, http.StatusInternalServerError)
+			default:
+				han.ResponseWithError(w, r, err, http.StatusInternalServerError)
+			}
+
+			return
+		}
+
+		han.responseWithJob(w, r, jobID, http.StatusAccepted)
+	})
+}
+
+func (han *Handler) handleShredObject() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filename, ok := r.URL.Query()["id"]
+		if !ok {
+			han.ResponseWithError(
+				w, r, errors.New("id should be set"), http.StatusBadRequest)
+			return
+		}
+
+		jobID, err := han.apiServer.ShredObject(filename[0])
+		if err != nil {
+			if errors.Is(err, chunkmanager.ErrNotFound) {
+				han.ResponseWithError(w, r, err, http.StatusNotFound)
+			} else {
+				han.ResponseWithError(w, r, err, http.StatusInternalServerError)
+			}
+
+			return
+		}
+
+		han.responseWithJob(w, r, jobID, http.StatusAccepted)
+	})
+}
+
+func (han *Handler) handleJobs() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jobID, ok := r.URL.Query()["id"]
+		if !ok {
+			han.ResponseWithJSON(w, r, http.StatusOK, han.apiServer.Jobs())
+			return
+		}
+
+		han.responseWithJob(w, r, jobID[0], http.StatusOK)
+	})
+}
+
+func (han *Handler) handleCacheStats() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		han.ResponseWithJSON(w, r, http.StatusOK, han.apiServer.CacheStats())
+	})
+}
+
+// handleClientStats serves retry and circuit breaker stats per storage
+// server.
+func (han *Handler) handleClientStats() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		han.ResponseWithJSON(w, r, http.StatusOK, han.config.Resilience.Stats())
+	})
+}
+
+// clusterStorageServer describes a registered storage server with the
+// circuit breaker state of its client.
+type clusterStorageServer struct {
+	chunkmanager.StorageServerStats
+	State resilience.State `json:"state,omitempty"`
+}
+
+// handleCluster serves registered storage servers and whether chunks can
+// be placed with all their replicas.
+func (han *Handler) handleCluster() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var stats map[string]resilience.Stats
+		if han.config.Resilience != nil {
+			stats = han.config.Resilience.Stats()
+		}
+
+		res := struct {
+			Ready          bool                   `json:"ready"`
+			Error          string                 `json:"error,omitempty"`
+			StorageServers []clusterStorageServer `json:"storage_servers"`
+		}{
+			Ready:          true,
+			StorageServers: []clusterStorageServer{},
+		}
+
+		if err := han.chunkManager.Ready(); err != nil {
+			res.Ready = false
+			res.Error = err.Error()
+		}
+
+		for _, ss := range han.chunkManager.StorageServers() {
+			server := clusterStorageServer{StorageServerStats: ss}
+
+			// Storage servers are not tracked until they are called.
+			if han.config.Resilience != nil {
+				server.State = resilience.StateClosed
+				if s, ok := stats[ss.Address]; ok {
+					server.State = s.State
+				}
+			}
+
+			res.StorageServers = append(res.StorageServers, server)
+		}
+
+		sort.Slice(res.StorageServers, func(i, j int) bool {
+			return res.StorageServers[i].Address < res.StorageServers[j].Address
+		})
+
+		han.ResponseWithJSON(w, r, http.StatusOK, res)
+	})
+}
+
+func (han *Handler) responseWithJob(
+	w http.ResponseWriter, r *http.Request, jobID string, statusCode int,
+) {
+	job, err := han.apiServer.Job(jobID)
+	if err != nil {
+		han.ResponseWithError(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	han.ResponseWithJSON(w, r, statusCode, job)
+}
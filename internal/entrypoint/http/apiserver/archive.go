@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"simple-storage/internal/apiserver"
+	"simple-storage/internal/auth"
+	"simple-storage/internal/chunkmanager"
+	"simple-storage/internal/logging"
+)
+
+// maxArchiveObjects bounds the number of objects in one archive.
+const maxArchiveObjects = 10000
+
+var archiveContentTypes = map[string]string{
+	apiserver.ArchiveTar: "application/x-tar",
+	apiserver.ArchiveZip: "application/zip",
+}
+
+func (han *Handler) handleArchive() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		format := query.Get("format")
+		if format == "" {
+			format = apiserver.ArchiveTar
+		}
+
+		contentType, ok := archiveContentTypes[format]
+		if !ok {
+			han.ResponseWithError(w, r,
+				fmt.Errorf("format: %s: %w", format, apiserver.ErrUnknownArchiveFormat),
+				http.StatusBadRequest)
+			return
+		}
+
+		filenames := query["id"]
+
+		for _, filename := range filenames {
+			if !han.authorized(w, r, auth.Read, filename) {
+				return
+			}
+		}
+
+		if prefix, ok := query["prefix"]; ok {
+			if !han.authorized(w, r, auth.List, prefix[0]) {
+				return
+			}
+
+			// Listed objects the client cannot read are left out.
+			allow := han.allow(r, auth.Read)
+
+			for _, filename := range han.listFilenames(prefix[0]) {
+				if allow == nil || allow(filename) == nil {
+					filenames = append(filenames, filename)
+				}
+			}
+		} else if len(filenames) == 0 {
+			han.ResponseWithError(w, r,
+				errors.New("id or prefix should be set"), http.StatusBadRequest)
+			return
+		}
+
+		if len(filenames) > maxArchiveObjects {
+			han.ResponseWithError(w, r,
+				fmt.Errorf("archive cannot contain more than %d objects", maxArchiveObjects),
+				http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="archive.%s"`, format))
+		w.WriteHeader(http.StatusOK)
+
+		// The status has been sent already, so a failure can only abort
+		// the response.
+		err := han.apiServer.ArchiveObjects(r.Context(), w, format, filenames)
+		if err != nil {
+			han.log.ErrorContext(r.Context(), "failure to stream archive", logging.Err(err))
+
+			// The client does not take a cut archive for a complete one.
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
+
+// listFilenames returns names of all objects with the prefix, at most one
+// more than maxArchiveObjects.
+func (han *Handler) listFilenames(prefix string) []string {
+	var (
+		filenames  []string
+		startAfter string
+	)
+
+	for len(filenames) <= maxArchiveObjects {
+		res := han.chunkManager.ListObjects(
+			prefix, "", startAfter, chunkmanager.MaxListLimit)
+
+		for _, object := range res.Objects {
+			filenames = append(filenames, object.Name)
+		}
+
+		if !res.IsTruncated {
+			break
+		}
+
+		startAfter = res.NextStartAfter
+	}
+
+	return filenames
+}
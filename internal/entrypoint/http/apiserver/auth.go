@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"simple-storage/internal/auth"
+	lhttp "simple-storage/internal/entrypoint/http"
+	"simple-storage/internal/tlsconfig"
+)
+
+// noKey returns the key of requests which are not for objects, such as admin
+// requests. Only grants without a bucket and a prefix match it.
+func noKey(_ *http.Request) string {
+	return ""
+}
+
+// bucketKey returns the key of requests for a bucket.
+func bucketKey(r *http.Request) string {
+	return r.URL.Query().Get("bucket") + "/"
+}
+
+// prefixKey returns the key of listing requests.
+func prefixKey(r *http.Request) string {
+	return r.URL.Query().Get("prefix")
+}
+
+// authorize passes the request to next if its client is granted the action on
+// the key returned by key.
+func (han *Handler) authorize(
+	action auth.Action, key func(r *http.Request) string, next http.Handler,
+) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !han.authorized(w, r, action, key(r)) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorized reports whether the client of the request is granted the action
+// on the key, otherwise it responds with an error. A presigned url grants its
+// method on its object. Every request is authorized if there is no policy.
+func (han *Handler) authorized(
+	w http.ResponseWriter, r *http.Request, action auth.Action, key string,
+) bool {
+	if han.config.Policy == nil {
+		return true
+	}
+
+	if presigned, ok := lhttp.PresignedKey(r.Context()); ok && presigned == key {
+		return true
+	}
+
+	principal, ok := han.principal(w, r)
+	if !ok {
+		return false
+	}
+
+	if !principal.Allowed(action, key) {
+		han.ResponseWithError(w, r,
+			fmt.Errorf("%w: %s on %q", auth.ErrForbidden, action, key),
+			http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// principal returns the authenticated client of the request, otherwise it
+// responds with an error.
+func (han *Handler) principal(
+	w http.ResponseWriter, r *http.Request,
+) (*auth.Principal, bool) {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		han.ResponseWithError(w, r, auth.ErrUnauthenticated, http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return principal, true
+}
+
+// authenticate passes the request to next if its client is authenticated, it
+// is used where next authorizes the request itself.
+func (han *Handler) authenticate(next http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if han.config.Policy != nil {
+			if _, ok := han.principal(w, r); !ok {
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorizeRegister passes the request to next if it carries the cluster
+// credential and comes with a client certificate of an allowed identity.
+func (han *Handler) authorizeRegister(next http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(han.config.RegisterIdentities) > 0 &&
+			!tlsconfig.PeerAllowed(r.TLS, han.config.RegisterIdentities) {
+			han.log.ErrorContext(r.Context(), "registration is rejected: "+
+				"certificate identity is not allowed", slog.String("remote_addr", r.RemoteAddr))
+			han.ResponseWithError(w, r,
+				fmt.Errorf("%w: certificate identity is not allowed to register",
+					auth.ErrForbidden),
+				http.StatusForbidden)
+			return
+		}
+
+		if han.config.Policy != nil {
+			principal, ok := han.principal(w, r)
+			if !ok {
+				return
+			}
+
+			if !principal.Cluster {
+				han.ResponseWithError(w, r,
+					fmt.Errorf("%w: cluster credential required", auth.ErrForbidden),
+					http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow returns a check of the action on keys for the client of the request,
+// nil if there is no policy.
+func (han *Handler) allow(r *http.Request, action auth.Action) func(key string) error {
+	if han.config.Policy == nil {
+		return nil
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+
+	return func(key string) error {
+		if principal == nil || !principal.Allowed(action, key) {
+			return fmt.Errorf("%w: %s on %q", auth.ErrForbidden, action, key)
+		}
+
+		return nil
+	}
+}
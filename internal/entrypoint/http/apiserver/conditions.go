@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http"
+	"simple-storage/internal/chunkmanager"
+	"strings"
+)
+
+// requestConditions collects conditions of a request from If-Match,
+// If-None-Match and If-Modified-Since headers. An invalid If-Modified-Since
+// date is ignored.
+func requestConditions(r *http.Request) chunkmanager.Conditions {
+	cond := chunkmanager.Conditions{
+		IfMatch:     parseETags(r.Header.Get("If-Match")),
+		IfNoneMatch: parseETags(r.Header.Get("If-None-Match")),
+	}
+
+	if value := r.Header.Get("If-Modified-Since"); value != "" {
+		if t, err := http.ParseTime(value); err == nil {
+			cond.IfModifiedSince = t
+		}
+	}
+
+	return cond
+}
+
+// parseETags parses a comma separated list of entity tags and returns them
+// without quotes. Weak tags are compared as strong ones.
+func parseETags(value string) []string {
+	var etags []string
+
+	for _, etag := range strings.Split(value, ",") {
+		etag = strings.TrimSpace(etag)
+		etag = strings.TrimPrefix(etag, "W/")
+		etag = strings.Trim(etag, `"`)
+
+		if etag != "" {
+			etags = append(etags, etag)
+		}
+	}
+
+	return etags
+}
+
+// responseNotModified tells a client that its copy of an object is current.
+func (han *Handler) responseNotModified(
+	w http.ResponseWriter, file chunkmanager.File,
+) {
+	w.Header().Set("ETag", etag(file))
+	w.Header().Set(versionIDHeader, file.VersionID)
+
+	if !file.Created.IsZero() {
+		w.Header().Set("Last-Modified", file.Created.UTC().Format(http.TimeFormat))
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+}
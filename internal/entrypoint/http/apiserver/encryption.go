@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"simple-storage/internal/apiserver"
+)
+
+// SSE-C headers carrying a customer provided encryption key.
+const (
+	customerKeyHeader    = "X-Server-Side-Encryption-Customer-Key"
+	customerKeyMD5Header = "X-Server-Side-Encryption-Customer-Key-Md5"
+)
+
+var errCustomerKeyMD5Mismatch = errors.New("customer key md5 mismatch")
+
+// customerKey returns the customer key of a request, nil if it is not set.
+func customerKey(r *http.Request) ([]byte, error) {
+	value := r.Header.Get(customerKeyHeader)
+	if value == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if md5 := r.Header.Get(customerKeyMD5Header); md5 != "" &&
+		md5 != apiserver.CustomerKeyMD5(key) {
+		return nil, errCustomerKeyMD5Mismatch
+	}
+
+	return key, nil
+}
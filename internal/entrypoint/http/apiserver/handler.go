@@ -2,29 +2,82 @@ package handler
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
-	"path/filepath"
+	"net/url"
+	"path"
 	"simple-storage/internal/apiserver"
+	"simple-storage/internal/auth"
+	"simple-storage/internal/chunkcache"
+	"simple-storage/internal/chunkmanager"
+	"simple-storage/internal/encryption"
 	lhttp "simple-storage/internal/entrypoint/http"
-	"simple-storage/internal/utils"
+	"simple-storage/internal/logging"
+	"simple-storage/internal/resilience"
+	"strconv"
+	"time"
 )
 
 type APIServer interface {
-	PutObject(ctx context.Context, filename string, r io.Reader, size int64) error
-	GetObject(ctx context.Context, filename string, w io.Writer) error
+	PutObject(ctx context.Context, filename string, r io.Reader, size int64,
+		opts apiserver.PutOptions) (chunkmanager.File, error)
+	GetObject(ctx context.Context, filename string, w io.Writer,
+		opts apiserver.GetOptions) error
+	StatObject(filename string, opts apiserver.GetOptions) (chunkmanager.File, error)
+	DeleteObject(filename string, cond chunkmanager.Conditions) (chunkmanager.File, error)
+	ObjectVersions(filename string) ([]chunkmanager.File, error)
+	RestoreObjectVersion(filename, versionID string) (chunkmanager.File, error)
+	CreateUpload(filename string, size int64, metadata chunkmanager.Metadata,
+		owner string) (string, error)
+	UploadStatus(id string) (int64, int64, error)
+	UploadOwner(id string) (string, string, error)
+	UploadExpires(id string) (time.Time, error)
+	WriteUpload(ctx context.Context, id string, offset, length int64, r io.Reader) (int64, error)
+	TerminateUpload(id string) error
+	RotateMasterKey() (string, error)
+	ShredObject(filename string) (string, error)
+	Job(id string) (apiserver.Job, error)
+	Jobs() []apiserver.Job
+	CacheStats() chunkcache.Stats
+	ArchiveObjects(ctx context.Context, w io.Writer, format string, filenames []string) error
+	ImportArchive(ctx context.Context, r io.Reader, opts apiserver.PutOptions,
+		allow func(name string) error) ([]apiserver.ImportResult, error)
+	PresignURL(method, filename string, ttl time.Duration, maxLength int64) (url.Values, error)
+	Presigned(query url.Values) bool
+	VerifyURL(method, filename string, query url.Values) (int64, error)
 }
 
 type ChunkManager interface {
 	RegisterStorageServer(address string) error
+	ListObjects(prefix, delimiter, startAfter string, limit int) chunkmanager.ListResult
+	SetVersioning(bucket string, enabled bool)
+	Versioning(bucket string) bool
+	StorageServers() []chunkmanager.StorageServerStats
+	Ready() error
+}
+
+// Config declares access control of the handler.
+type Config struct {
+	// Policy authorizes requests, there is no authorization if it is nil.
+	Policy *auth.Policy
+	// RegisterIdentities are certificate identities storage servers are
+	// allowed to register with, any client can register if it is empty.
+	RegisterIdentities []string
+	// Resilience is the policy of storage server clients, its stats are
+	// served to admins.
+	Resilience *resilience.Policy
+	// LogLevel is served to admins, who may change it, if it is set.
+	LogLevel *slog.LevelVar
 }
 
 // Handler is a wraper on http.Server.
 type Handler struct {
-	log          *log.Logger
+	log          *slog.Logger
+	config       Config
 	apiServer    APIServer
 	chunkManager ChunkManager
 	*lhttp.Handler
@@ -32,32 +85,93 @@ type Handler struct {
 
 // New returns a HTTP server.
 func New(
-	log *log.Logger,
+	log *slog.Logger,
+	config Config,
 	apiServer APIServer,
 	chunkManager ChunkManager,
 ) *Handler {
-	log = utils.LoggerExtendWithPrefix(log, "http-handler ->")
+	log = logging.Component(log, "http-handler")
 
 	return &Handler{
 		log,
+		config,
 		apiServer,
 		chunkManager,
 		lhttp.NewHandler(log),
 	}
 }
 
+// Routes are the paths served by the handler, they bound the route label of
+// request metrics. Objects are uploaded to any path and reported under "/".
+var Routes = []string{
+	"/", tusPath, tusPath + "/", "/versions", "/versions/restore", "/versioning",
+	"/import", "/list", "/archive", "/register", "/cluster",
+	adminPath + "/keys/rotate", adminPath + "/objects", adminPath + "/jobs",
+	adminPath + "/presign", adminPath + "/cache", adminPath + "/clients",
+	lhttp.LogLevelPath,
+}
+
 // ServeHTTP configures and returns a new router.
 func (han *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	router := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch {
+		case r.URL.Path == tusPath && r.Method == http.MethodOptions:
+			han.handleTusOptions().ServeHTTP(w, r)
+		case r.URL.Path == tusPath && r.Method == http.MethodPost:
+			han.handleTusCreate().ServeHTTP(w, r)
+		case path.Dir(r.URL.Path) == tusPath && r.Method == http.MethodHead:
+			han.authenticate(han.authorizeUpload(han.handleTusHead())).ServeHTTP(w, r)
+		case path.Dir(r.URL.Path) == tusPath && r.Method == http.MethodPatch:
+			han.authenticate(han.authorizeUpload(han.handleTusPatch())).ServeHTTP(w, r)
+		case path.Dir(r.URL.Path) == tusPath && r.Method == http.MethodDelete:
+			han.authenticate(han.authorizeUpload(han.handleTusDelete())).ServeHTTP(w, r)
 		case r.Method == http.MethodOptions:
 			han.HandleOK().ServeHTTP(w, r)
 		case r.URL.Path == "/" && r.Method == http.MethodGet:
-			han.handleDownload().ServeHTTP(w, r)
-		case filepath.Dir(r.URL.Path) == "/" && r.Method == http.MethodPut:
-			han.handleUpload().ServeHTTP(w, r)
+			han.HandlePresigned(han.apiServer, queryObjectKey,
+				han.authorize(auth.Read, queryObjectKey, han.handleDownload())).
+				ServeHTTP(w, r)
+		case r.URL.Path == "/" && r.Method == http.MethodHead:
+			han.authorize(auth.Read, queryObjectKey, han.handleHead()).ServeHTTP(w, r)
+		case r.URL.Path == "/" && r.Method == http.MethodDelete:
+			han.authorize(auth.Delete, queryObjectKey, han.handleDelete()).ServeHTTP(w, r)
+		case r.URL.Path == "/versions" && r.Method == http.MethodGet:
+			han.authorize(auth.Read, queryObjectKey, han.handleVersions()).ServeHTTP(w, r)
+		case r.URL.Path == "/versions/restore" && r.Method == http.MethodPost:
+			han.authorize(auth.Write, queryObjectKey, han.handleRestoreVersion()).
+				ServeHTTP(w, r)
+		case r.URL.Path == "/versioning" && r.Method == http.MethodGet:
+			han.authorize(auth.List, bucketKey, han.handleGetVersioning()).ServeHTTP(w, r)
+		case r.URL.Path == "/versioning" && r.Method == http.MethodPut:
+			han.authorize(auth.Admin, bucketKey, han.handlePutVersioning()).ServeHTTP(w, r)
+		case r.URL.Path == "/import" && r.Method == http.MethodPut:
+			han.authenticate(han.handleImport()).ServeHTTP(w, r)
+		case r.URL.Path != "/" && r.Method == http.MethodPut:
+			han.HandlePresigned(han.apiServer, pathObjectKey, han.handleUpload()).
+				ServeHTTP(w, r)
+		case r.URL.Path == "/list" && r.Method == http.MethodGet:
+			han.authorize(auth.List, prefixKey, han.handleList()).ServeHTTP(w, r)
+		case r.URL.Path == "/archive" && r.Method == http.MethodGet:
+			han.authenticate(han.handleArchive()).ServeHTTP(w, r)
 		case r.URL.Path == "/register" && r.Method == http.MethodPost:
-			han.handleRegister().ServeHTTP(w, r)
+			han.authorizeRegister(han.handleRegister()).ServeHTTP(w, r)
+		case r.URL.Path == "/cluster" && r.Method == http.MethodGet:
+			han.authorize(auth.Admin, noKey, han.handleCluster()).ServeHTTP(w, r)
+		case r.URL.Path == adminPath+"/keys/rotate" && r.Method == http.MethodPost:
+			han.authorize(auth.Admin, noKey, han.handleRotateMasterKey()).ServeHTTP(w, r)
+		case r.URL.Path == adminPath+"/objects" && r.Method == http.MethodDelete:
+			han.authorize(auth.Admin, noKey, han.handleShredObject()).ServeHTTP(w, r)
+		case r.URL.Path == adminPath+"/jobs" && r.Method == http.MethodGet:
+			han.authorize(auth.Admin, noKey, han.handleJobs()).ServeHTTP(w, r)
+		case r.URL.Path == adminPath+"/presign" && r.Method == http.MethodPost:
+			han.authenticate(han.handlePresign()).ServeHTTP(w, r)
+		case r.URL.Path == adminPath+"/cache" && r.Method == http.MethodGet:
+			han.authorize(auth.Admin, noKey, han.handleCacheStats()).ServeHTTP(w, r)
+		case r.URL.Path == adminPath+"/clients" && r.Method == http.MethodGet:
+			han.authorize(auth.Admin, noKey, han.handleClientStats()).ServeHTTP(w, r)
+		case r.URL.Path == lhttp.LogLevelPath && han.config.LogLevel != nil:
+			han.authorize(auth.Admin, noKey, han.HandleLogLevel(han.config.LogLevel)).
+				ServeHTTP(w, r)
 		default:
 			han.HandleEmpty().ServeHTTP(w, r)
 		}
@@ -72,20 +186,36 @@ const (
 
 func (han *Handler) handleDownload() http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		chunkID, ok := r.URL.Query()["id"]
+		file, filename, ok := han.statObject(w, r)
 		if !ok {
-			han.ResponseWithError(
-				w, r, errors.New("id should be set"), http.StatusBadRequest)
 			return
 		}
 
+		key, err := customerKey(r)
+		if err != nil {
+			han.ResponseWithError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		setObjectHeaders(w, file)
+
 		ctx := r.Context()
 
-		err := han.apiServer.GetObject(ctx, chunkID[0], w)
+		err = han.apiServer.GetObject(ctx, filename, w, apiserver.GetOptions{
+			CustomerKey: key,
+			VersionID:   file.VersionID,
+		})
 		if err != nil {
-			if errors.Is(err, apiserver.ErrDownloadCanceled) {
+			w.Header().Del("Content-Length")
+
+			switch {
+			case errors.Is(err, apiserver.ErrDownloadCanceled):
 				han.ResponseWithError(w, r, err, StatusClientClosedRequest)
-			} else {
+			case errors.Is(err, apiserver.ErrCustomerKeyRequired):
+				han.ResponseWithError(w, r, err, http.StatusBadRequest)
+			case errors.Is(err, apiserver.ErrCustomerKeyMismatch):
+				han.ResponseWithError(w, r, err, http.StatusForbidden)
+			default:
 				han.ResponseWithError(w, r, err, http.StatusInternalServerError)
 			}
 
@@ -94,8 +224,72 @@ func (han *Handler) handleDownload() http.HandlerFunc {
 	})
 }
 
+func (han *Handler) handleHead() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, _, ok := han.statObject(w, r)
+		if !ok {
+			return
+		}
+
+		setObjectHeaders(w, file)
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// statObject returns the object requested by the id query parameter, in the
+// version requested by the versionId query parameter if it is set. It
+// responds with an error and reports false if there is no such object or
+// conditions of the request do not hold.
+func (han *Handler) statObject(
+	w http.ResponseWriter, r *http.Request,
+) (chunkmanager.File, string, bool) {
+	filename, ok := r.URL.Query()["id"]
+	if !ok {
+		han.ResponseWithError(
+			w, r, errors.New("id should be set"), http.StatusBadRequest)
+		return chunkmanager.File{}, "", false
+	}
+
+	file, err := han.apiServer.StatObject(filename[0], apiserver.GetOptions{
+		VersionID:  r.URL.Query().Get(versionIDParam),
+		Conditions: requestConditions(r),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, chunkmanager.ErrNotModified):
+			han.responseNotModified(w, file)
+		case errors.Is(err, chunkmanager.ErrPreconditionFailed):
+			han.ResponseWithError(w, r, err, http.StatusPreconditionFailed)
+		case errors.Is(err, chunkmanager.ErrNotFound):
+			han.ResponseWithError(w, r, err, http.StatusNotFound)
+		case errors.Is(err, chunkmanager.ErrDeleteMarker):
+			w.Header().Set(deleteMarkerHeader, "true")
+			han.ResponseWithError(w, r, err, http.StatusMethodNotAllowed)
+		default:
+			han.ResponseWithError(w, r, err, http.StatusInternalServerError)
+		}
+
+		return chunkmanager.File{}, "", false
+	}
+
+	return file, filename[0], true
+}
+
 func (han *Handler) handleUpload() http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The object is named by the url path, which may have directories.
+		filename := pathObjectKey(r)
+
+		if filename == "" || path.Clean("/"+filename) != r.URL.Path {
+			han.ResponseWithError(w, r,
+				errors.New("object key should be a clean path"), http.StatusBadRequest)
+			return
+		}
+
+		if !han.authorized(w, r, auth.Write, filename) {
+			return
+		}
+
 		r.ParseMultipartForm(10 << 20)
 
 		file, header, err := r.FormFile("file")
@@ -105,23 +299,84 @@ func (han *Handler) handleUpload() http.HandlerFunc {
 		}
 		defer file.Close()
 
+		opts := apiserver.PutOptions{
+			Compression: r.Header.Get("X-Compression"),
+			Metadata: requestMetadata(
+				r, filename, header.Header.Get("Content-Type")),
+			Conditions: requestConditions(r),
+		}
+
+		opts.CustomerKey, err = customerKey(r)
+		if err != nil {
+			han.ResponseWithError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		if contentMD5 := r.Header.Get("Content-MD5"); contentMD5 != "" {
+			opts.ContentMD5, err = base64.StdEncoding.DecodeString(contentMD5)
+			if err != nil {
+				han.ResponseWithError(w, r, err, http.StatusBadRequest)
+				return
+			}
+		}
+
 		ctx := r.Context()
 
-		err = han.apiServer.PutObject(ctx, header.Filename, file, header.Size)
+		object, err := han.apiServer.PutObject(
+			ctx, filename, file, header.Size, opts)
 		if err != nil {
-			if errors.Is(err, apiserver.ErrUploadCanceled) {
+			switch {
+			case errors.Is(err, apiserver.ErrUploadCanceled):
 				han.ResponseWithError(w, r, err, StatusClientClosedRequest)
-			} else {
+			case errors.Is(err, apiserver.ErrContentMD5Mismatch),
+				errors.Is(err, apiserver.ErrUnknownCodec),
+				errors.Is(err, apiserver.ErrMetadataTooLarge),
+				errors.Is(err, encryption.ErrInvalidKey):
+				han.ResponseWithError(w, r, err, http.StatusBadRequest)
+			case errors.Is(err, chunkmanager.ErrAlreadyExist):
+				han.ResponseWithError(w, r, err, http.StatusConflict)
+			case errors.Is(err, chunkmanager.ErrPreconditionFailed):
+				han.ResponseWithError(w, r, err, http.StatusPreconditionFailed)
+			default:
 				han.ResponseWithError(w, r, err, http.StatusInternalServerError)
 			}
 
 			return
 		}
 
+		w.Header().Set("ETag", etag(object))
+		w.Header().Set("Last-Modified", object.Created.UTC().Format(http.TimeFormat))
+		w.Header().Set(versionIDHeader, object.VersionID)
+
 		han.HandleOK().ServeHTTP(w, r)
 	})
 }
 
+func (han *Handler) handleList() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			query = r.URL.Query()
+			limit int
+			err   error
+		)
+
+		if value := query.Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit <= 0 {
+				han.ResponseWithError(w, r,
+					errors.New("limit should be a positive number"),
+					http.StatusBadRequest)
+				return
+			}
+		}
+
+		res := han.chunkManager.ListObjects(
+			query.Get("prefix"), query.Get("delimiter"), query.Get("start-after"), limit)
+
+		han.ResponseWithJSON(w, r, http.StatusOK, res)
+	})
+}
+
 func (han *Handler) handleRegister() http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
@@ -151,3 +406,8 @@ func (han *Handler) handleRegister() http.HandlerFunc {
 		han.HandleOK().ServeHTTP(w, r)
 	})
 }
+
+// etag formats the ETag header value of an object.
+func etag(file chunkmanager.File) string {
+	return `"` + file.ETag + `"`
+}
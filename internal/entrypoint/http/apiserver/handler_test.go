@@ -0,0 +1,265 @@
+package handler_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"simple-storage/internal/apiserver"
+	"simple-storage/internal/auth"
+	"simple-storage/internal/chunkmanager"
+	handler "simple-storage/internal/entrypoint/http/apiserver"
+
+	"github.com/stretchr/testify/require"
+)
+
+// storageServer keeps chunks in memory.
+type storageServer struct {
+	chunks map[string][]byte
+	sync.Mutex
+}
+
+func (ss *storageServer) UploadChunk(
+	_ context.Context, chunkID string, _ uint32, _ int64, r io.Reader,
+) error {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	ss.Lock()
+	defer ss.Unlock()
+
+	ss.chunks[chunkID] = buf
+
+	return nil
+}
+
+func (ss *storageServer) DownloadChunk(_ context.Context, chunkID string, w io.Writer) error {
+	ss.Lock()
+	buf, ok := ss.chunks[chunkID]
+	ss.Unlock()
+
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	_, err := w.Write(buf)
+
+	return err
+}
+
+func (ss *storageServer) DeleteChunk(_ context.Context, chunkID string) error {
+	ss.Lock()
+	defer ss.Unlock()
+
+	delete(ss.chunks, chunkID)
+
+	return nil
+}
+
+// server returns an api-server with one storage server keeping chunks in
+// memory. Requests are authenticated by policy if it is set.
+func server(t *testing.T, policy *auth.Policy) *httptest.Server {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	cm := chunkmanager.New(logger, chunkmanager.Config{
+		MaxChunkSizeBytes:     10240,
+		ErasureCodingFraction: 5,
+	})
+	require.NoError(t, cm.RegisterStorageServer("0.0.0.0:9001"))
+
+	ss := &storageServer{chunks: map[string][]byte{}}
+
+	apiServer := apiserver.New(logger, apiserver.Config{}, cm,
+		func(string) apiserver.StorageServer { return ss })
+
+	var han http.Handler = handler.New(logger, handler.Config{Policy: policy}, apiServer, cm)
+
+	if policy != nil {
+		next := han
+		han = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, err := policy.Authenticate(r)
+			if err != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+
+	srv := httptest.NewServer(han)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func upload(t *testing.T, url, filename string, content []byte) *http.Response {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+
+	part, err := writer.CreateFormFile("file", filename)
+	require.NoError(t, err)
+
+	part.Write(content)
+	require.NoError(t, writer.Close())
+
+	req, err := http.NewRequest(http.MethodPut, url, body)
+	require.NoError(t, err)
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	return resp
+}
+
+func TestHandler_uploadNestedPath(t *testing.T) {
+	srv := server(t, nil)
+	content := []byte("Hello World!")
+
+	// The object is named by the path, not by the multipart filename.
+	resp := upload(t, srv.URL+"/bucket/dir/key", "other.txt", content)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err := http.Get(srv.URL + "/?id=bucket/dir/key")
+	require.NoError(t, err)
+
+	downloaded, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, content, downloaded)
+
+	resp, err = http.Get(srv.URL + "/list?prefix=bucket/")
+	require.NoError(t, err)
+
+	var list chunkmanager.ListResult
+
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	require.NoError(t, err)
+
+	require.Len(t, list.Objects, 1)
+	require.Equal(t, "bucket/dir/key", list.Objects[0].Name)
+
+	for _, path := range []string{"/bucket/../key", "/bucket//key", "/bucket/dir/"} {
+		resp = upload(t, srv.URL+path, "key", content)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+	}
+}
+
+func TestHandler_corsExposeHeaders(t *testing.T) {
+	srv := server(t, nil)
+
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+
+	part, err := writer.CreateFormFile("file", "key")
+	require.NoError(t, err)
+
+	part.Write([]byte("Hello World!"))
+	require.NoError(t, writer.Close())
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL+"/key", body)
+	require.NoError(t, err)
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-Meta-Owner", "alice")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Head(srv.URL + "/?id=key")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.Contains(t, resp.Header.Get("Access-Control-Allow-Methods"), "HEAD")
+
+	exposed := strings.Join(resp.Header.Values("Access-Control-Expose-Headers"), ",")
+	for _, name := range []string{
+		"ETag", "X-Version-Id", "X-Delete-Marker", "Upload-Offset", "X-Meta-Owner",
+	} {
+		require.Contains(t, exposed, name)
+	}
+}
+
+func tusRequest(
+	t *testing.T, method, url, key string, header map[string]string, body string,
+) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set(auth.APIKeyHeader, key)
+
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	return resp
+}
+
+func TestHandler_tusOwner(t *testing.T) {
+	policy, err := auth.Parse([]byte(`{"principals": [
+		{"id": "alice", "key": "alice-key", "grants": [{"prefix": "", "actions": ["write"]}]},
+		{"id": "bob", "key": "bob-key", "grants": [{"prefix": "", "actions": ["write"]}]},
+		{"id": "carol", "key": "carol-key", "grants": [{"prefix": "other/", "actions": ["write"]}]}
+	]}`))
+	require.NoError(t, err)
+
+	srv := server(t, policy)
+
+	resp := tusRequest(t, http.MethodPost, srv.URL+"/files", "alice-key", map[string]string{
+		"Upload-Length":   "12",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("a.txt")),
+	}, "")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	upload := srv.URL + resp.Header.Get("Location")
+	patch := map[string]string{
+		"Upload-Offset": "0",
+		"Content-Type":  "application/offset+octet-stream",
+	}
+
+	// Only the client which has created the upload may use it.
+	for _, key := range []string{"bob-key", "carol-key"} {
+		for _, method := range []string{http.MethodHead, http.MethodPatch, http.MethodDelete} {
+			resp = tusRequest(t, method, upload, key, patch, "Hello ")
+			require.Equal(t, http.StatusForbidden, resp.StatusCode, "%s %s", key, method)
+		}
+	}
+
+	// Data past the upload length is rejected and nothing is written.
+	resp = tusRequest(t, http.MethodPatch, upload, "alice-key", patch, "Hello World!!")
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	resp = tusRequest(t, http.MethodHead, upload, "alice-key", nil, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "0", resp.Header.Get("Upload-Offset"))
+
+	resp = tusRequest(t, http.MethodPatch, upload, "alice-key", patch, "Hello World!")
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, "12", resp.Header.Get("Upload-Offset"))
+}
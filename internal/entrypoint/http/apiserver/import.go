@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"simple-storage/internal/apiserver"
+	"simple-storage/internal/auth"
+)
+
+type importReport struct {
+	Imported int                      `json:"imported"`
+	Failed   int                      `json:"failed"`
+	Results  []apiserver.ImportResult `json:"results"`
+	// Error tells why the import stopped before the end of the archive.
+	Error string `json:"error,omitempty"`
+}
+
+func (han *Handler) handleImport() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		opts := apiserver.PutOptions{
+			Compression: r.Header.Get("X-Compression"),
+			Metadata:    requestMetadata(r, "", ""),
+			Conditions:  requestConditions(r),
+		}
+
+		var err error
+
+		opts.CustomerKey, err = customerKey(r)
+		if err != nil {
+			han.ResponseWithError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		results, err := han.apiServer.ImportArchive(r.Context(), r.Body, opts,
+			han.allow(r, auth.Write))
+
+		report := importReport{Results: results}
+		if report.Results == nil {
+			report.Results = []apiserver.ImportResult{}
+		}
+
+		for _, res := range results {
+			if res.Error == "" {
+				report.Imported++
+			} else {
+				report.Failed++
+			}
+		}
+
+		statusCode := http.StatusOK
+
+		if err != nil {
+			report.Error = err.Error()
+
+			if errors.Is(err, apiserver.ErrUploadCanceled) {
+				statusCode = StatusClientClosedRequest
+			} else {
+				statusCode = http.StatusBadRequest
+			}
+		}
+
+		han.ResponseWithJSON(w, r, statusCode, report)
+	})
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"simple-storage/internal/chunkmanager"
+	"strconv"
+	"strings"
+)
+
+// userMetadataPrefix starts names of headers carrying custom object metadata.
+const userMetadataPrefix = "X-Meta-"
+
+const defaultContentType = "application/octet-stream"
+
+// requestMetadata collects metadata of an uploaded object from request
+// headers. contentType is the type of the uploaded file, if it is empty the
+// type is guessed by the filename extension.
+func requestMetadata(
+	r *http.Request, filename, contentType string,
+) chunkmanager.Metadata {
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+
+	metadata := chunkmanager.Metadata{
+		ContentType:        contentType,
+		ContentDisposition: r.Header.Get("Content-Disposition"),
+		CacheControl:       r.Header.Get("Cache-Control"),
+	}
+
+	for name, values := range r.Header {
+		if !strings.HasPrefix(name, userMetadataPrefix) || len(values) == 0 {
+			continue
+		}
+
+		if metadata.User == nil {
+			metadata.User = map[string]string{}
+		}
+
+		metadata.User[strings.TrimPrefix(name, userMetadataPrefix)] = values[0]
+	}
+
+	return metadata
+}
+
+// setObjectHeaders describes a stored object in response headers.
+func setObjectHeaders(w http.ResponseWriter, file chunkmanager.File) {
+	header := w.Header()
+
+	contentType := file.Metadata.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	header.Set("ETag", etag(file))
+	header.Set(versionIDHeader, file.VersionID)
+
+	if !file.Created.IsZero() {
+		header.Set("Last-Modified", file.Created.UTC().Format(http.TimeFormat))
+	}
+
+	if file.Metadata.ContentDisposition != "" {
+		header.Set("Content-Disposition", file.Metadata.ContentDisposition)
+	}
+
+	if file.Metadata.CacheControl != "" {
+		header.Set("Cache-Control", file.Metadata.CacheControl)
+	}
+
+	for key, value := range file.Metadata.User {
+		header.Set(userMetadataPrefix+key, value)
+		header.Add("Access-Control-Expose-Headers", userMetadataPrefix+key)
+	}
+
+	if file.CustomerKeyMD5 != "" {
+		header.Set(customerKeyMD5Header, file.CustomerKeyMD5)
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"simple-storage/internal/apiserver"
+	"simple-storage/internal/auth"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryObjectKey returns the object key of a download request.
+func queryObjectKey(r *http.Request) string {
+	return r.URL.Query().Get("id")
+}
+
+// pathObjectKey returns the object key of an upload request.
+func pathObjectKey(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, "/")
+}
+
+func (han *Handler) handlePresign() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		req := struct {
+			Method string `json:"method"`
+			ID     string `json:"id"`
+			// ExpiresIn is the url lifetime in seconds.
+			ExpiresIn int64 `json:"expires_in"`
+			MaxLength int64 `json:"max_length"`
+		}{}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			han.ResponseWithError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		if req.ID == "" {
+			han.ResponseWithError(w, r,
+				errors.New("id should be set"), http.StatusBadRequest)
+			return
+		}
+
+		// A client can only hand out access it has itself.
+		action := auth.Write
+		if req.Method == http.MethodGet {
+			action = auth.Read
+		}
+
+		if !han.authorized(w, r, action, req.ID) {
+			return
+		}
+
+		query, err := han.apiServer.PresignURL(
+			req.Method, req.ID, time.Duration(req.ExpiresIn)*time.Second, req.MaxLength)
+		if err != nil {
+			switch {
+			case errors.Is(err, apiserver.ErrPresignDisabled):
+				han.ResponseWithError(w, r, err, http.StatusNotImplemented)
+			case errors.Is(err, apiserver.ErrUnsignedMethod),
+				errors.Is(err, apiserver.ErrInvalidPresignTTL):
+				han.ResponseWithError(w, r, err, http.StatusBadRequest)
+			default:
+				han.ResponseWithError(w, r, err, http.StatusInternalServerError)
+			}
+
+			return
+		}
+
+		expires, _ := strconv.ParseInt(query.Get(apiserver.PresignExpiresParam), 10, 64)
+
+		presigned := url.URL{Path: "/"}
+
+		if req.Method == http.MethodGet {
+			query.Set("id", req.ID)
+		} else {
+			presigned.Path += req.ID
+		}
+
+		presigned.RawQuery = query.Encode()
+
+		han.ResponseWithJSON(w, r, http.StatusOK, struct {
+			URL     string    `json:"url"`
+			Expires time.Time `json:"expires"`
+		}{
+			URL:     presigned.String(),
+			Expires: time.Unix(expires, 0).UTC(),
+		})
+	})
+}
@@ -0,0 +1,249 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"simple-storage/internal/apiserver"
+	"simple-storage/internal/auth"
+	"simple-storage/internal/chunkmanager"
+	"strconv"
+	"strings"
+)
+
+// tus 1.0 core protocol with the creation, expiration and termination
+// extensions.
+// https://tus.io/protocols/resumable-upload
+const (
+	tusPath        = "/files"
+	tusVersion     = "1.0.0"
+	tusExtensions  = "creation,expiration,termination"
+	tusContentType = "application/offset+octet-stream"
+)
+
+// tus checks the protocol version of a request and marks the response.
+func (han *Handler) tus(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+
+		if r.Header.Get("Tus-Resumable") != tusVersion {
+			w.Header().Set("Tus-Version", tusVersion)
+			han.ResponseWithError(w, r,
+				errors.New("unsupported tus version"), http.StatusPreconditionFailed)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (han *Handler) handleTusOptions() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Tus-Resumable", tusVersion)
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (han *Handler) handleTusCreate() http.HandlerFunc {
+	return han.tus(func(w http.ResponseWriter, r *http.Request) {
+		size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		if err != nil {
+			han.ResponseWithError(w, r,
+				errors.New("Upload-Length should be set"), http.StatusBadRequest)
+			return
+		}
+
+		metadata := tusMetadata(r.Header.Get("Upload-Metadata"))
+
+		filename, ok := metadata["filename"]
+		if !ok || len(filename) == 0 {
+			han.ResponseWithError(w, r,
+				errors.New("filename should be set in Upload-Metadata"),
+				http.StatusBadRequest)
+			return
+		}
+
+		if !han.authorized(w, r, auth.Write, filename) {
+			return
+		}
+
+		id, err := han.apiServer.CreateUpload(filename, size,
+			requestMetadata(r, filename, metadata["filetype"]), uploadOwner(r))
+		if err != nil {
+			han.responseWithTusError(w, r, err)
+			return
+		}
+
+		han.setUploadExpires(w, id)
+		w.Header().Set("Location", path.Join(tusPath, id))
+		w.WriteHeader(http.StatusCreated)
+	})
+}
+
+func (han *Handler) handleTusHead() http.HandlerFunc {
+	return han.tus(func(w http.ResponseWriter, r *http.Request) {
+		offset, size, err := han.apiServer.UploadStatus(path.Base(r.URL.Path))
+		if err != nil {
+			han.responseWithTusError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(size, 10))
+		han.setUploadExpires(w, path.Base(r.URL.Path))
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func (han *Handler) handleTusPatch() http.HandlerFunc {
+	return han.tus(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		if r.Header.Get("Content-Type") != tusContentType {
+			han.ResponseWithError(w, r,
+				errors.New("Content-Type should be "+tusContentType),
+				http.StatusUnsupportedMediaType)
+			return
+		}
+
+		offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+		if err != nil {
+			han.ResponseWithError(w, r,
+				errors.New("Upload-Offset should be set"), http.StatusBadRequest)
+			return
+		}
+
+		// Data running past the upload length is rejected before it is read.
+		if r.ContentLength < 0 {
+			han.ResponseWithError(w, r,
+				errors.New("Content-Length should be set"), http.StatusLengthRequired)
+			return
+		}
+
+		ctx := r.Context()
+
+		id := path.Base(r.URL.Path)
+
+		offset, err = han.apiServer.WriteUpload(ctx, id, offset, r.ContentLength, r.Body)
+
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		han.setUploadExpires(w, id)
+
+		if err != nil {
+			han.responseWithTusError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (han *Handler) handleTusDelete() http.HandlerFunc {
+	return han.tus(func(w http.ResponseWriter, r *http.Request) {
+		err := han.apiServer.TerminateUpload(path.Base(r.URL.Path))
+		if err != nil {
+			han.responseWithTusError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// authorizeUpload passes requests of an upload to next if they come from the
+// client which has created the upload and which may still write its object.
+func (han *Handler) authorizeUpload(next http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filename, owner, err := han.apiServer.UploadOwner(path.Base(r.URL.Path))
+		if err != nil {
+			han.responseWithTusError(w, r, err)
+			return
+		}
+
+		if !han.authorized(w, r, auth.Write, filename) {
+			return
+		}
+
+		if uploadOwner(r) != owner {
+			han.ResponseWithError(w, r,
+				fmt.Errorf("%w: upload has been created by another client", auth.ErrForbidden),
+				http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// uploadOwner identifies the client of the request as the owner of uploads,
+// it is empty if authentication is disabled.
+func uploadOwner(r *http.Request) string {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		return ""
+	}
+
+	return principal.ID
+}
+
+// setUploadExpires sets the Upload-Expires header if the upload expires,
+// completed uploads have no expiry.
+func (han *Handler) setUploadExpires(w http.ResponseWriter, id string) {
+	expires, err := han.apiServer.UploadExpires(id)
+	if err != nil || expires.IsZero() {
+		return
+	}
+
+	w.Header().Set("Upload-Expires", expires.UTC().Format(http.TimeFormat))
+}
+
+func (han *Handler) responseWithTusError(
+	w http.ResponseWriter, r *http.Request, err error,
+) {
+	switch {
+	case errors.Is(err, apiserver.ErrUploadNotFound):
+		han.ResponseWithError(w, r, err, http.StatusNotFound)
+	case errors.Is(err, apiserver.ErrUploadOffsetMismatch),
+		errors.Is(err, chunkmanager.ErrAlreadyExist):
+		han.ResponseWithError(w, r, err, http.StatusConflict)
+	case errors.Is(err, apiserver.ErrEmptyUpload),
+		errors.Is(err, apiserver.ErrMetadataTooLarge):
+		han.ResponseWithError(w, r, err, http.StatusBadRequest)
+	case errors.Is(err, apiserver.ErrUploadTooLarge):
+		han.ResponseWithError(w, r, err, http.StatusRequestEntityTooLarge)
+	case errors.Is(err, apiserver.ErrUploadCanceled):
+		han.ResponseWithError(w, r, err, StatusClientClosedRequest)
+	default:
+		han.ResponseWithError(w, r, err, http.StatusInternalServerError)
+	}
+}
+
+// tusMetadata decodes the Upload-Metadata header: comma separated pairs of
+// a key and an optional base64 encoded value.
+func tusMetadata(header string) map[string]string {
+	metadata := map[string]string{}
+
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+
+		switch len(fields) {
+		case 1:
+			metadata[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				continue
+			}
+
+			metadata[fields[0]] = string(value)
+		}
+	}
+
+	return metadata
+}
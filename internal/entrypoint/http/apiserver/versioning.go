@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"simple-storage/internal/chunkmanager"
+	"time"
+)
+
+const (
+	versionIDParam     = "versionId"
+	versionIDHeader    = "X-Version-Id"
+	deleteMarkerHeader = "X-Delete-Marker"
+)
+
+type objectVersion struct {
+	VersionID    string    `json:"version_id"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	Created      time.Time `json:"created"`
+	DeleteMarker bool      `json:"delete_marker"`
+	IsLatest     bool      `json:"is_latest"`
+}
+
+type versioning struct {
+	Bucket  string `json:"bucket"`
+	Enabled bool   `json:"enabled"`
+}
+
+func (han *Handler) handleDelete() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filename, ok := r.URL.Query()["id"]
+		if !ok {
+			han.ResponseWithError(
+				w, r, errors.New("id should be set"), http.StatusBadRequest)
+			return
+		}
+
+		marker, err := han.apiServer.DeleteObject(filename[0], requestConditions(r))
+		if err != nil {
+			switch {
+			case errors.Is(err, chunkmanager.ErrNotFound):
+				han.ResponseWithError(w, r, err, http.StatusNotFound)
+			case errors.Is(err, chunkmanager.ErrPreconditionFailed):
+				han.ResponseWithError(w, r, err, http.StatusPreconditionFailed)
+			default:
+				han.ResponseWithError(w, r, err, http.StatusInternalServerError)
+			}
+
+			return
+		}
+
+		if marker.DeleteMarker {
+			w.Header().Set(versionIDHeader, marker.VersionID)
+			w.Header().Set(deleteMarkerHeader, "true")
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (han *Handler) handleVersions() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filename, ok := r.URL.Query()["id"]
+		if !ok {
+			han.ResponseWithError(
+				w, r, errors.New("id should be set"), http.StatusBadRequest)
+			return
+		}
+
+		versions, err := han.apiServer.ObjectVersions(filename[0])
+		if err != nil {
+			if errors.Is(err, chunkmanager.ErrNotFound) {
+				han.ResponseWithError(w, r, err, http.StatusNotFound)
+			} else {
+				han.ResponseWithError(w, r, err, http.StatusInternalServerError)
+			}
+
+			return
+		}
+
+		res := make([]objectVersion, 0, len(versions))
+		for i, file := range versions {
+			res = append(res, objectVersion{
+				VersionID:    file.VersionID,
+				Size:         file.Size,
+				ETag:         file.ETag,
+				Created:      file.Created,
+				DeleteMarker: file.DeleteMarker,
+				IsLatest:     i == 0,
+			})
+		}
+
+		han.ResponseWithJSON(w, r, http.StatusOK, res)
+	})
+}
+
+func (han *Handler) handleRestoreVersion() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		filename, versionID := query.Get("id"), query.Get(versionIDParam)
+		if filename == "" || versionID == "" {
+			han.ResponseWithError(w, r,
+				errors.New("id and versionId should be set"), http.StatusBadRequest)
+			return
+		}
+
+		file, err := han.apiServer.RestoreObjectVersion(filename, versionID)
+		if err != nil {
+			switch {
+			case errors.Is(err, chunkmanager.ErrNotFound):
+				han.ResponseWithError(w, r, err, http.StatusNotFound)
+			case errors.Is(err, chunkmanager.ErrDeleteMarker):
+				han.ResponseWithError(w, r, err, http.StatusBadRequest)
+			default:
+				han.ResponseWithError(w, r, err, http.StatusInternalServerError)
+			}
+
+			return
+		}
+
+		han.ResponseWithJSON(w, r, http.StatusOK, objectVersion{
+			VersionID: file.VersionID,
+			Size:      file.Size,
+			ETag:      file.ETag,
+			Created:   file.Created,
+			IsLatest:  true,
+		})
+	})
+}
+
+func (han *Handler) handleGetVersioning() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket := r.URL.Query().Get("bucket")
+
+		han.ResponseWithJSON(w, r, http.StatusOK, versioning{
+			Bucket:  bucket,
+			Enabled: han.chunkManager.Versioning(bucket),
+		})
+	})
+}
+
+func (han *Handler) handlePutVersioning() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+
+		req := versioning{}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			han.ResponseWithError(w, r, err, http.StatusBadRequest)
+			return
+		}
+
+		req.Bucket = r.URL.Query().Get("bucket")
+
+		han.chunkManager.SetVersioning(req.Bucket, req.Enabled)
+
+		han.ResponseWithJSON(w, r, http.StatusOK, req)
+	})
+}
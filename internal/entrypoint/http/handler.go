@@ -2,17 +2,18 @@ package http
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	"simple-storage/internal/logging"
 )
 
 // Handler is a wraper on http.Server.
 type Handler struct {
-	log *log.Logger
+	log *slog.Logger
 }
 
 // NewHandler returns a common handler.
-func NewHandler(log *log.Logger) *Handler {
+func NewHandler(log *slog.Logger) *Handler {
 	return &Handler{
 		log: log,
 	}
@@ -32,6 +33,13 @@ func (han *Handler) HandleOK() http.HandlerFunc {
 	})
 }
 
+// ExposeHeaders are response headers browsers let scripts read. Custom
+// metadata headers, X-Meta-*, have no fixed names and are exposed by the
+// handlers setting them.
+const ExposeHeaders = `ETag, Last-Modified, Content-Disposition, Location,
+	Tus-Resumable, Tus-Version, Tus-Extension, Upload-Length, Upload-Offset,
+	Upload-Expires, X-Version-Id, X-Delete-Marker, X-Request-Id`
+
 // HandleCORS defines cors.
 func (han *Handler) HandleCORS(next http.Handler) http.HandlerFunc {
 	origins := map[string]struct{}{}
@@ -49,11 +57,16 @@ func (han *Handler) HandleCORS(next http.Handler) http.HandlerFunc {
 			Accept-Encoding, X-CSRF-Token, Authorization,
 			Access-Control-Request-Headers, Access-Control-Request-Method,
 			Connection, Host, Origin, User-Agent, Referer, Cache-Control,
-			X-header, Wb-AppType, Wb-AppVersion`,
+			X-header, Wb-AppType, Wb-AppVersion, Tus-Resumable,
+			Upload-Length, Upload-Metadata, Upload-Offset, Content-MD5,
+			X-Compression, X-Server-Side-Encryption-Customer-Key,
+			X-Server-Side-Encryption-Customer-Key-Md5, If-Match, If-None-Match,
+			If-Modified-Since, X-Api-Key, X-Request-Id, Traceparent, Tracestate`,
 		)
+		w.Header().Set("Access-Control-Expose-Headers", ExposeHeaders)
 		w.Header().Set(
 			"Access-Control-Allow-Methods",
-			"GET, POST, PUT, PATCH, DELETE, OPTIONS",
+			"GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS",
 		)
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
@@ -63,19 +76,26 @@ func (han *Handler) HandleCORS(next http.Handler) http.HandlerFunc {
 }
 
 // ResponseWithError helps to form the right response in case of error.
+// Server errors are logged with the trace of the request.
 func (han *Handler) ResponseWithError(
 	w http.ResponseWriter, r *http.Request, err error, statusCode int,
 ) {
+	if statusCode >= http.StatusInternalServerError {
+		han.log.ErrorContext(r.Context(), "failure to serve request",
+			slog.String("method", r.Method), slog.String("path", r.URL.Path),
+			logging.Err(err))
+	}
+
 	res := struct {
 		Error string `json:"error"`
 	}{}
 
 	res.Error = err.Error()
 
-	w.WriteHeader(statusCode)
-
 	w.Header().Set("Content-Type", "application/json")
 
+	w.WriteHeader(statusCode)
+
 	err = json.NewEncoder(w).Encode(&res)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -91,3 +111,16 @@ func (han *Handler) ResponseWithData(
 
 	w.Write(buf)
 }
+
+// ResponseWithJSON encodes v as the response body.
+func (han *Handler) ResponseWithJSON(
+	w http.ResponseWriter, r *http.Request, statusCode int, v interface{},
+) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		han.log.ErrorContext(r.Context(), "failure to encode response", logging.Err(err))
+	}
+}
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const (
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+)
+
+type probeStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// middlewareHealth answers liveness probes on healthzPath and readiness
+// probes on readyzPath. Probes are neither logged, counted nor authenticated.
+func (s *ServerHTTP) middlewareHealth() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			switch r.URL.Path {
+			case healthzPath:
+				writeProbe(w, http.StatusOK, probeStatus{Status: "ok"})
+			case readyzPath:
+				if s.config.Ready != nil {
+					if err := s.config.Ready(); err != nil {
+						writeProbe(w, http.StatusServiceUnavailable,
+							probeStatus{Status: "not ready", Error: err.Error()})
+						return
+					}
+				}
+
+				writeProbe(w, http.StatusOK, probeStatus{Status: "ready"})
+			default:
+				next.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+func writeProbe(w http.ResponseWriter, statusCode int, status probeStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(status)
+}
@@ -2,10 +2,13 @@ package http
 
 import (
 	"context"
-	"log"
+	"crypto/tls"
+	"log/slog"
 	"net/http"
-	"simple-storage/internal/utils"
+	"simple-storage/internal/logging"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type middlewareFunc func(http.Handler) http.Handler
@@ -26,15 +29,37 @@ func (mw Middleware) Serve(next http.Handler) http.Handler {
 
 // MiddlewareSwitch declareas witch middleware will be available.
 type MiddlewareSwitch struct {
+	// CorrelationID propagates request ids and trace context of requests.
 	CorrelationID bool
 	Logging       bool
 	Prometheus    bool
 }
 
+// Authenticator identifies the client of a request.
+type Authenticator interface {
+	// Authenticate returns the request context carrying the identity of the
+	// client, or an error if the request credentials are invalid.
+	Authenticate(r *http.Request) (context.Context, error)
+}
+
 // Config declares configuration for the HTTP server.
 type Config struct {
 	Address          string
 	MiddlewareSwitch MiddlewareSwitch
+	// Metrics keeps metrics of requests and is served on /metrics if
+	// MiddlewareSwitch.Prometheus is set.
+	Metrics *prometheus.Registry
+	// Routes bound the route label of request metrics, a request is
+	// reported under its path if it is a route and otherwise under the
+	// longest route ending with a slash its path starts with.
+	Routes []string
+	// Ready reports whether the server may receive traffic, it is served on
+	// /readyz, which fails with its error. The server is ready if it is nil.
+	Ready func() error
+	// Authenticator authenticates every request if it is set.
+	Authenticator Authenticator
+	// TLS makes the server serve HTTPS if it is set.
+	TLS *tls.Config
 
 	// https://golang.org/pkg/net/http/#Server
 	// https://medium.com/@simonfrey/go-as-in-golang-standard-net-http-config-will-break-your-production-environment-1360871cb72b
@@ -47,18 +72,18 @@ type Config struct {
 
 // ServerHTTP is a wraper on http.Server.
 type ServerHTTP struct {
-	log    *log.Logger
+	log    *slog.Logger
 	config Config
 	server *http.Server
 }
 
 // New returns a HTTP server.
 func New(
-	log *log.Logger,
+	log *slog.Logger,
 	config Config,
 	router http.Handler,
 ) *ServerHTTP {
-	log = utils.LoggerExtendWithPrefix(log, "http-server ->")
+	log = logging.Component(log, "http-server")
 
 	s := &ServerHTTP{
 		log:    log,
@@ -70,12 +95,25 @@ func New(
 			WriteTimeout:      config.WriteTimeout,
 			IdleTimeout:       config.IdleTimeout,
 			MaxHeaderBytes:    config.MaxHeaderBytes,
+			TLSConfig:         config.TLS,
 		},
 	}
 
-	middleware := Middleware{
-		s.middlewareCORS(),
-		s.middlewareLogging(),
+	middleware := Middleware{s.middlewareCORS(), s.middlewareHealth()}
+
+	// Log lines of requests carry their trace and request ids.
+	if config.MiddlewareSwitch.CorrelationID {
+		middleware = append(middleware, s.middlewareCorrelationID())
+	}
+
+	middleware = append(middleware, s.middlewareLogging())
+
+	if config.MiddlewareSwitch.Prometheus {
+		middleware = append(middleware, s.middlewarePrometheus())
+	}
+
+	if config.Authenticator != nil {
+		middleware = append(middleware, s.middlewareAuth(config.Authenticator))
 	}
 
 	s.server.Handler = middleware.Serve(router)
@@ -88,7 +126,15 @@ func (s *ServerHTTP) Start() chan error {
 	serverErrors := make(chan error, 1)
 
 	go func() {
-		s.log.Printf("start HTTP API Listening %s", s.config.Address)
+		if s.config.TLS != nil {
+			s.log.Info("start HTTPS API", slog.String("address", s.config.Address))
+			// Certificates are provided by the TLS config.
+			serverErrors <- s.server.ListenAndServeTLS("", "")
+
+			return
+		}
+
+		s.log.Info("start HTTP API", slog.String("address", s.config.Address))
 		serverErrors <- s.server.ListenAndServe()
 	}()
 
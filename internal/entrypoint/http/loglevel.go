@@ -0,0 +1,52 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"simple-storage/internal/logging"
+)
+
+// LogLevelPath serves the log level, GET returns it and PUT changes it.
+const LogLevelPath = "/admin/log-level"
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+// HandleLogLevel returns the level as {"level": "INFO"} and changes it to the
+// level of a PUT request body of the same form.
+func (han *Handler) HandleLogLevel(level *slog.LevelVar) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			defer r.Body.Close()
+
+			var req logLevel
+
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				han.ResponseWithError(w, r, err, http.StatusBadRequest)
+				return
+			}
+
+			l, err := logging.ParseLevel(req.Level)
+			if err != nil {
+				han.ResponseWithError(w, r, err, http.StatusBadRequest)
+				return
+			}
+
+			han.log.InfoContext(r.Context(), "change log level",
+				slog.String("from", level.Level().String()), slog.String("to", l.String()))
+
+			level.Set(l)
+		default:
+			han.ResponseWithError(w, r,
+				errors.New("method is not allowed"), http.StatusMethodNotAllowed)
+			return
+		}
+
+		han.ResponseWithJSON(w, r, http.StatusOK, logLevel{Level: level.Level().String()})
+	})
+}
@@ -0,0 +1,173 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsPath = "/metrics"
+
+// middlewarePrometheus serves metrics on metricsPath and counts requests,
+// their latency and bytes of other paths per route.
+func (s *ServerHTTP) middlewarePrometheus() func(next http.Handler) http.Handler {
+	registry := s.config.Metrics
+	if registry == nil {
+		registry = prometheus.NewRegistry()
+	}
+
+	var (
+		labels   = []string{"route", "method"}
+		requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simple_storage_http_requests_total",
+			Help: "HTTP requests by route, method and status code.",
+		}, append(labels, "code"))
+		duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "simple_storage_http_request_duration_seconds",
+			Help:    "Latency of HTTP requests until the response is sent.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, labels)
+		bytesIn = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simple_storage_http_request_bytes_total",
+			Help: "Bytes of HTTP request bodies read by handlers.",
+		}, labels)
+		bytesOut = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "simple_storage_http_response_bytes_total",
+			Help: "Bytes of HTTP response bodies.",
+		}, labels)
+	)
+
+	registry.MustRegister(requests, duration, bytesIn, bytesOut)
+
+	metrics := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == metricsPath && r.Method == http.MethodGet {
+				metrics.ServeHTTP(w, r)
+				return
+			}
+
+			var (
+				start = time.Now()
+				body  = &countingBody{ReadCloser: r.Body}
+				rw    = &metricsWriter{ResponseWriter: w, code: http.StatusOK}
+				route = route(s.config.Routes, r.URL.Path)
+				meth  = method(r.Method)
+			)
+
+			if r.Body != nil {
+				r.Body = body
+			}
+
+			next.ServeHTTP(rw, r)
+
+			requests.WithLabelValues(route, meth, strconv.Itoa(rw.code)).Inc()
+			duration.WithLabelValues(route, meth).Observe(time.Since(start).Seconds())
+			bytesIn.WithLabelValues(route, meth).Add(float64(body.n))
+			bytesOut.WithLabelValues(route, meth).Add(float64(rw.n))
+		})
+	}
+}
+
+// route returns the route of path, other if it has none.
+func route(routes []string, path string) string {
+	match := ""
+
+	for _, route := range routes {
+		if route == path {
+			return route
+		}
+
+		if strings.HasSuffix(route, "/") && strings.HasPrefix(path, route) &&
+			len(route) > len(match) {
+			match = route
+		}
+	}
+
+	if match == "" {
+		return "other"
+	}
+
+	return match
+}
+
+// method returns the method of a request, other if it is not a standard one,
+// so that clients cannot add label values.
+func method(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodConnect,
+		http.MethodOptions, http.MethodTrace:
+		return m
+	}
+
+	return "other"
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+
+	return n, err
+}
+
+// metricsWriter records the status code and the size of a response.
+type metricsWriter struct {
+	http.ResponseWriter
+	code        int
+	n           int64
+	wroteHeader bool
+}
+
+func (w *metricsWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code, w.wroteHeader = code, true
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *metricsWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the writer.
+func (w *metricsWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the original writer.
+func (w *metricsWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// NewMetricsRegistry returns a registry with metrics of the Go runtime and of
+// the process.
+func NewMetricsRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return registry
+}
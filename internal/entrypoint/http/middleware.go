@@ -1,16 +1,19 @@
 package http
 
 import (
+	"encoding/json"
+	"log/slog"
 	"net/http"
+	"simple-storage/internal/logging"
 )
 
 // middlewareLogging log start and end of a http session.
 func (s *ServerHTTP) middlewareLogging() func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			s.log.Printf("Incomming http request:"+
-				"r.URL.Path: %s r.Method: %s r.RemoteAddr: %s ",
-				r.URL.Path, r.Method, r.RemoteAddr)
+			s.log.InfoContext(r.Context(), "incoming http request",
+				slog.String("path", r.URL.Path), slog.String("method", r.Method),
+				slog.String("remote_addr", r.RemoteAddr))
 
 			next.ServeHTTP(w, r)
 		})
@@ -27,10 +30,12 @@ func (s *ServerHTTP) middlewareCORS() func(next http.Handler) http.Handler {
 				`Accept, Content-Type, Content-Length, Accept-Encoding,
 				X-CSRF-Token, Authorization, Access-Control-Request-Headers,
 				Access-Control-Request-Method, Connection, Host, Origin,
-				User-Agent, Referer, Cache-Control`)
+				User-Agent, Referer, Cache-Control, X-Request-Id, Traceparent,
+				Tracestate`)
+			w.Header().Set("Access-Control-Expose-Headers", ExposeHeaders)
 			w.Header().Set(
 				"Access-Control-Allow-Methods",
-				"GET, POST, PUT, PATCH, DELETE, OPTIONS",
+				"GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS",
 			)
 			w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
 
@@ -38,3 +43,30 @@ func (s *ServerHTTP) middlewareCORS() func(next http.Handler) http.Handler {
 		})
 	}
 }
+
+// middlewareAuth rejects requests with invalid credentials. Requests are
+// authorized by handlers, which know what they are for.
+func (s *ServerHTTP) middlewareAuth(
+	authenticator Authenticator,
+) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, err := authenticator.Authenticate(r)
+			if err != nil {
+				s.log.ErrorContext(r.Context(), "failure to authenticate",
+					slog.String("remote_addr", r.RemoteAddr), logging.Err(err))
+
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(struct {
+					Error string `json:"error"`
+				}{err.Error()})
+
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+var ErrRequestTooLarge = errors.New("request body exceeds the presigned limit")
+
+// URLVerifier checks signatures of presigned urls.
+type URLVerifier interface {
+	// Presigned reports whether url query parameters carry a signature.
+	Presigned(query url.Values) bool
+	// VerifyURL returns the request body size limit of a valid url, zero if
+	// there is none.
+	VerifyURL(method, key string, query url.Values) (int64, error)
+}
+
+type presignedKeyCtx struct{}
+
+// PresignedKey returns the object key a request has been authorized for by a
+// presigned url.
+func PresignedKey(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(presignedKeyCtx{}).(string)
+	return key, ok
+}
+
+// HandlePresigned validates the signature of a presigned url before the
+// request reaches next. key returns the object key the request is for.
+// Requests without a signature are passed through unchanged.
+func (han *Handler) HandlePresigned(
+	verifier URLVerifier, key func(r *http.Request) string, next http.Handler,
+) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		if !verifier.Presigned(query) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		objectKey := key(r)
+
+		maxLength, err := verifier.VerifyURL(r.Method, objectKey, query)
+		if err != nil {
+			han.ResponseWithError(w, r, err, http.StatusForbidden)
+			return
+		}
+
+		if maxLength > 0 {
+			if r.ContentLength > maxLength {
+				han.ResponseWithError(w, r, ErrRequestTooLarge,
+					http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxLength)
+		}
+
+		ctx := context.WithValue(r.Context(), presignedKeyCtx{}, objectKey)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -1,40 +1,63 @@
 package handler
 
 import (
+	"context"
 	"errors"
 	"io"
-	"log"
+	"log/slog"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"os"
 	lhttp "simple-storage/internal/entrypoint/http"
-	"simple-storage/internal/utils"
+	"simple-storage/internal/logging"
+	"simple-storage/internal/storageserver"
+	"strconv"
 )
 
+// checksumHeader carries hex encoded CRC32C of an uploaded chunk.
+const checksumHeader = "X-Checksum-Crc32c"
+
 type StorageServer interface {
-	UploadChunk(chunkID string, file io.Reader) error
-	DownloadChunk(chunkID string) ([]byte, error)
+	UploadChunk(ctx context.Context, chunkID string, file io.Reader, checksum uint32) error
+	DownloadChunk(ctx context.Context, chunkID string) (io.ReadCloser, int64, error)
+	DeleteChunk(ctx context.Context, chunkID string) error
+}
+
+// Config declares configuration for the handler.
+type Config struct {
+	// LogLevel is served and may be changed if it is set.
+	LogLevel *slog.LevelVar
 }
 
 // Handler is a wraper on http.Server.
 type Handler struct {
-	log           *log.Logger
+	log           *slog.Logger
+	config        Config
 	storageServer StorageServer
 	*lhttp.Handler
 }
 
 // New returns a HTTP server.
 func New(
-	log *log.Logger,
+	log *slog.Logger,
+	config Config,
 	storageServer StorageServer,
 ) *Handler {
-	log = utils.LoggerExtendWithPrefix(log, "http-handler ->")
+	log = logging.Component(log, "http-handler")
 
 	return &Handler{
 		log,
+		config,
 		storageServer,
 		lhttp.NewHandler(log),
 	}
 }
 
+// Routes are the paths served by the handler, they bound the route label of
+// request metrics.
+var Routes = []string{"/", lhttp.LogLevelPath}
+
 // ServeHTTP configures and returns a new router.
 func (han *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	router := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -45,6 +68,10 @@ func (han *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			han.handleDownload().ServeHTTP(w, r)
 		case r.URL.Path == "/" && r.Method == http.MethodPut:
 			han.handleUpload().ServeHTTP(w, r)
+		case r.URL.Path == "/" && r.Method == http.MethodDelete:
+			han.handleDelete().ServeHTTP(w, r)
+		case r.URL.Path == lhttp.LogLevelPath && han.config.LogLevel != nil:
+			han.HandleLogLevel(han.config.LogLevel).ServeHTTP(w, r)
 		default:
 			han.HandleEmpty().ServeHTTP(w, r)
 		}
@@ -62,22 +89,41 @@ func (han *Handler) handleDownload() http.HandlerFunc {
 			return
 		}
 
-		buf, err := han.storageServer.DownloadChunk(chunkID[0])
+		chunk, size, err := han.storageServer.DownloadChunk(r.Context(), chunkID[0])
+		if errors.Is(err, storageserver.ErrInvalidChunkID) {
+			han.ResponseWithError(w, r, err, http.StatusBadRequest)
+
+			return
+		}
+
+		if errors.Is(err, os.ErrNotExist) {
+			han.ResponseWithError(w, r, err, http.StatusNotFound)
+
+			return
+		}
+
 		if err != nil {
 			han.ResponseWithError(w, r, err, http.StatusInternalServerError)
 
 			return
 		}
 
-		han.ResponseWithData(w, r, buf)
+		defer chunk.Close()
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.WriteHeader(http.StatusOK)
+
+		if _, err := io.Copy(w, chunk); err != nil {
+			han.log.ErrorContext(r.Context(), "failure to send chunk",
+				logging.ChunkID(chunkID[0]), logging.Err(err))
+		}
 	})
 }
 
 func (han *Handler) handleUpload() http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		r.ParseMultipartForm(10 << 20)
-
-		file, header, err := r.FormFile("chunk")
+		file, chunkID, err := chunkPart(r)
 		if err != nil {
 			han.ResponseWithError(w, r, err, http.StatusBadRequest)
 			return
@@ -85,7 +131,45 @@ func (han *Handler) handleUpload() http.HandlerFunc {
 
 		defer file.Close()
 
-		err = han.storageServer.UploadChunk(header.Filename, file)
+		checksum, err := strconv.ParseUint(r.Header.Get(checksumHeader), 16, 32)
+		if err != nil {
+			han.ResponseWithError(w, r,
+				errors.New(checksumHeader+" should be set"), http.StatusBadRequest)
+			return
+		}
+
+		err = han.storageServer.UploadChunk(r.Context(), chunkID, file, uint32(checksum))
+		if err != nil {
+			if errors.Is(err, storageserver.ErrChecksumMismatch) ||
+				errors.Is(err, storageserver.ErrInvalidChunkID) {
+				han.ResponseWithError(w, r, err, http.StatusBadRequest)
+			} else {
+				han.ResponseWithError(w, r, err, http.StatusInternalServerError)
+			}
+
+			return
+		}
+
+		han.HandleOK().ServeHTTP(w, r)
+	})
+}
+
+func (han *Handler) handleDelete() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunkID, ok := r.URL.Query()["id"]
+		if !ok {
+			han.ResponseWithError(
+				w, r, errors.New("id should be set"), http.StatusBadRequest)
+			return
+		}
+
+		err := han.storageServer.DeleteChunk(r.Context(), chunkID[0])
+		if errors.Is(err, storageserver.ErrInvalidChunkID) {
+			han.ResponseWithError(w, r, err, http.StatusBadRequest)
+
+			return
+		}
+
 		if err != nil {
 			han.ResponseWithError(w, r, err, http.StatusInternalServerError)
 
@@ -95,3 +179,33 @@ func (han *Handler) handleUpload() http.HandlerFunc {
 		han.HandleOK().ServeHTTP(w, r)
 	})
 }
+
+// chunkPart returns the multipart part carrying the chunk and the chunk id.
+// The chunk is read from the request body without buffering.
+func chunkPart(r *http.Request) (*multipart.Part, string, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, "", http.ErrMissingFile
+		}
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		// The chunk id is the file name as sent, FileName strips directories
+		// from it, which would store the chunk under another id.
+		_, params, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+
+		if part.FormName() == "chunk" && params["filename"] != "" {
+			return part, params["filename"], nil
+		}
+
+		part.Close()
+	}
+}
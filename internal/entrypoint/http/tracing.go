@@ -0,0 +1,50 @@
+package http
+
+import (
+	"net/http"
+	"simple-storage/internal/tracing"
+
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// middlewareCorrelationID continues the trace of the caller in a span of the
+// request. The request id of the caller is kept, or a new one is given, and
+// it is returned in the response. Scrapes of metrics are not traced.
+func (s *ServerHTTP) middlewareCorrelationID() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == metricsPath {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := tracing.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+			id := tracing.RequestID(ctx)
+			if id == "" {
+				id = tracing.NewRequestID()
+				ctx = tracing.WithRequestID(ctx, id)
+			}
+
+			w.Header().Set(tracing.RequestIDHeader, id)
+
+			route := route(s.config.Routes, r.URL.Path)
+
+			ctx, span := tracing.Start(ctx, r.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.HTTPRoute(route),
+				))
+			defer span.End()
+
+			rw := &metricsWriter{ResponseWriter: w, code: http.StatusOK}
+
+			next.ServeHTTP(rw, r.WithContext(ctx))
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(rw.code))
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"simple-storage/internal/chunkproto"
+	"simple-storage/internal/logging"
+	"simple-storage/internal/storageserver"
+	"simple-storage/internal/tracing"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type StorageServer interface {
+	UploadChunk(ctx context.Context, chunkID string, file io.Reader, checksum uint32) error
+	DownloadChunk(ctx context.Context, chunkID string) (io.ReadCloser, int64, error)
+	DeleteChunk(ctx context.Context, chunkID string) error
+	StatChunk(ctx context.Context, chunkID string) (int64, error)
+}
+
+// Handler serves chunk operations of a storage server over the binary chunk
+// protocol. Requests of a connection are served in order.
+type Handler struct {
+	log           *slog.Logger
+	maxChunkSize  uint64
+	storageServer StorageServer
+}
+
+// New returns a TCP handler accepting chunks up to maxChunkSize bytes.
+func New(
+	log *slog.Logger,
+	maxChunkSize uint64,
+	storageServer StorageServer,
+) *Handler {
+	log = logging.Component(log, "tcp-handler")
+
+	return &Handler{
+		log:           log,
+		maxChunkSize:  maxChunkSize,
+		storageServer: storageServer,
+	}
+}
+
+func (han *Handler) ServeConn(ctx context.Context, conn net.Conn) {
+	reader := chunkproto.NewReader(conn, han.maxChunkSize)
+	writer := chunkproto.NewWriter(conn)
+
+	for ctx.Err() == nil {
+		req, err := reader.Next()
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				han.log.Error("failure to read frame",
+					slog.String("remote_addr", conn.RemoteAddr().String()), logging.Err(err))
+			}
+
+			return
+		}
+
+		// The request continues the trace of the caller, its span ends when
+		// the response is sent.
+		reqCtx := tracing.Extract(ctx, propagation.MapCarrier(req.Metadata))
+		reqCtx, span := tracing.Start(reqCtx, "chunkproto "+req.Op.String(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("chunk_id", req.Key),
+				attribute.Int64("bytes", int64(req.Length)),
+			))
+
+		resp, payload, err := han.serve(reqCtx, req, reader)
+
+		// A request is not followed by a valid frame if its payload can not
+		// be read, the connection can not be used anymore.
+		if errors.Is(err, chunkproto.ErrBadFrame) || errors.Is(err, net.ErrClosed) ||
+			errors.Is(err, os.ErrDeadlineExceeded) {
+			han.log.ErrorContext(reqCtx, "failure to read frame",
+				slog.String("remote_addr", conn.RemoteAddr().String()), logging.Err(err))
+			tracing.End(span, err)
+
+			return
+		}
+
+		errServe := err
+
+		if err != nil {
+			han.log.ErrorContext(reqCtx, "failure to serve request",
+				slog.String("op", req.Op.String()), logging.ChunkID(req.Key), logging.Err(err))
+
+			resp.Status = status(err)
+			resp.Length = uint64(len(err.Error()))
+			payload = io.NopCloser(strings.NewReader(err.Error()))
+		}
+
+		resp.Op = req.Op
+		resp.RequestID = req.RequestID
+
+		// A frame is incomplete if the payload fails, so the connection is
+		// dropped on any error.
+		err = writer.WriteFrameFrom(resp, payload)
+		payload.Close()
+
+		if err != nil {
+			han.log.ErrorContext(reqCtx, "failure to write frame",
+				slog.String("remote_addr", conn.RemoteAddr().String()), logging.Err(err))
+			tracing.End(span, err)
+
+			return
+		}
+
+		tracing.End(span, errServe)
+	}
+}
+
+// serve runs the request and returns the response payload of Length bytes,
+// the payload of the request is read completely unless it fails with
+// chunkproto.ErrBadFrame.
+func (han *Handler) serve(
+	ctx context.Context, req chunkproto.Header, reader *chunkproto.Reader,
+) (chunkproto.Header, io.ReadCloser, error) {
+	if req.Op != chunkproto.OpPutChunk {
+		if err := reader.Finish(); err != nil {
+			return chunkproto.Header{}, nil, err
+		}
+	}
+
+	if req.Key == "" {
+		return chunkproto.Header{}, nil, errBadRequest("chunk id should be set")
+	}
+
+	empty := io.NopCloser(strings.NewReader(""))
+
+	switch req.Op {
+	case chunkproto.OpPutChunk:
+		body := &payloadReader{reader: reader}
+
+		var err error
+		if req.Flags&chunkproto.FlagChecksum == 0 {
+			err = errBadRequest("checksum should be set")
+		} else {
+			err = han.storageServer.UploadChunk(ctx, req.Key, body, req.Checksum)
+		}
+
+		if !body.finished {
+			if errFinish := reader.Finish(); errFinish != nil {
+				err = errFinish
+			}
+		}
+
+		return chunkproto.Header{}, empty, err
+	case chunkproto.OpGetChunk:
+		chunk, size, err := han.storageServer.DownloadChunk(ctx, req.Key)
+		if err != nil {
+			return chunkproto.Header{}, nil, err
+		}
+
+		return chunkproto.Header{Length: uint64(size)}, chunk, nil
+	case chunkproto.OpDeleteChunk:
+		return chunkproto.Header{}, empty, han.storageServer.DeleteChunk(ctx, req.Key)
+	case chunkproto.OpStat:
+		size, err := han.storageServer.StatChunk(ctx, req.Key)
+		if err != nil {
+			return chunkproto.Header{}, nil, err
+		}
+
+		payload := make([]byte, 8)
+		binary.BigEndian.PutUint64(payload, uint64(size))
+
+		return chunkproto.Header{Length: 8},
+			io.NopCloser(bytes.NewReader(payload)), nil
+	default:
+		return chunkproto.Header{}, nil, errBadRequest("unsupported operation: " + req.Op.String())
+	}
+}
+
+type errBadRequest string
+
+func (err errBadRequest) Error() string { return string(err) }
+
+func status(err error) chunkproto.Status {
+	var badRequest errBadRequest
+
+	switch {
+	case errors.As(err, &badRequest), errors.Is(err, storageserver.ErrInvalidChunkID):
+		return chunkproto.StatusBadRequest
+	case errors.Is(err, os.ErrNotExist):
+		return chunkproto.StatusNotFound
+	case errors.Is(err, storageserver.ErrChecksumMismatch),
+		errors.Is(err, chunkproto.ErrFrameChecksum):
+		return chunkproto.StatusChecksumMismatch
+	default:
+		return chunkproto.StatusError
+	}
+}
+
+// payloadReader reads the chunk content of a put request. The trailer is
+// verified before the end of the content is reported, so a corrupted chunk
+// is never saved.
+type payloadReader struct {
+	reader   *chunkproto.Reader
+	finished bool
+}
+
+func (r *payloadReader) Read(p []byte) (int, error) {
+	if r.finished {
+		return 0, io.EOF
+	}
+
+	n, err := r.reader.Read(p)
+	if err == io.EOF {
+		r.finished = true
+
+		if err := r.reader.Finish(); err != nil {
+			return n, err
+		}
+	}
+
+	return n, err
+}
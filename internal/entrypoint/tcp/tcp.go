@@ -0,0 +1,230 @@
+// Package tcp serves the binary chunk protocol on a dedicated port.
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"simple-storage/internal/logging"
+	"sync"
+	"time"
+)
+
+// Handler serves frames of a connection until it is closed or ctx is done.
+type Handler interface {
+	ServeConn(ctx context.Context, conn net.Conn)
+}
+
+// Config declares configuration for the TCP server.
+type Config struct {
+	Address string
+	// TLS makes the server require TLS if it is set.
+	TLS *tls.Config
+	// IdleTimeout closes connections without requests for longer, there is
+	// no timeout if it is zero.
+	IdleTimeout time.Duration
+}
+
+// ServerTCP accepts connections and passes them to the handler.
+type ServerTCP struct {
+	log     *slog.Logger
+	config  Config
+	handler Handler
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closing  bool
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// New returns a TCP server.
+func New(
+	log *slog.Logger,
+	config Config,
+	handler Handler,
+) *ServerTCP {
+	log = logging.Component(log, "tcp-server")
+
+	return &ServerTCP{
+		log:     log,
+		config:  config,
+		handler: handler,
+		conns:   map[net.Conn]struct{}{},
+	}
+}
+
+// Start starts TCP Server.
+func (s *ServerTCP) Start() chan error {
+	serverErrors := make(chan error, 1)
+
+	go func() {
+		listener, err := net.Listen("tcp", s.config.Address)
+		if err != nil {
+			serverErrors <- err
+			return
+		}
+
+		if s.config.TLS != nil {
+			listener = tls.NewListener(listener, s.config.TLS)
+		}
+
+		s.log.Info("start TCP API", slog.String("address", s.config.Address))
+		serverErrors <- s.Serve(listener)
+	}()
+
+	return serverErrors
+}
+
+// Serve accepts connections of the listener until Shutdown is called.
+func (s *ServerTCP) Serve(listener net.Listener) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		listener.Close()
+		return net.ErrClosed
+	}
+
+	s.listener = listener
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closing := s.closing
+			s.mu.Unlock()
+
+			if closing {
+				return nil
+			}
+
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+
+			return err
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return nil
+		}
+
+		go func() {
+			defer s.untrack(conn)
+			defer conn.Close()
+
+			done := make(chan struct{})
+			defer close(done)
+
+			// Reads blocked on the next frame are interrupted on shutdown.
+			go func() {
+				select {
+				case <-ctx.Done():
+					conn.SetReadDeadline(time.Now())
+				case <-done:
+				}
+			}()
+
+			s.handler.ServeConn(ctx, &serverConn{
+				Conn:    conn,
+				ctx:     ctx,
+				timeout: s.config.IdleTimeout,
+			})
+		}()
+	}
+}
+
+func (s *ServerTCP) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing {
+		return false
+	}
+
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+
+	return true
+}
+
+func (s *ServerTCP) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+
+	s.wg.Done()
+}
+
+// Shutdown stops accepting connections and waits for handlers to return,
+// connections are closed if they do not finish before ctx is done.
+func (s *ServerTCP) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+
+	if s.listener != nil {
+		s.listener.Close()
+	}
+
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+
+	stopped := make(chan struct{})
+
+	go func() {
+		s.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+
+		return ctx.Err()
+	}
+}
+
+// serverConn extends the read deadline on every read and fails reads after
+// the server is shut down.
+type serverConn struct {
+	net.Conn
+	ctx     context.Context
+	timeout time.Duration
+}
+
+func (c *serverConn) Read(p []byte) (int, error) {
+	var deadline time.Time
+	if c.timeout > 0 {
+		deadline = time.Now().Add(c.timeout)
+	}
+
+	if err := c.Conn.SetReadDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	// The deadline set on shutdown may have been overwritten above.
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return c.Conn.Read(p)
+}
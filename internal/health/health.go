@@ -0,0 +1,143 @@
+// Package health probes storage servers periodically. A storage server is
+// healthy while its latest successful probe is recent enough, so that one
+// which stops answering is noticed before calls to it fail.
+package health
+
+import (
+	"context"
+	"log/slog"
+	"simple-storage/internal/logging"
+	"sync"
+	"time"
+)
+
+// Config declares how often storage servers are probed.
+type Config struct {
+	// Interval between probes of an address, probing is disabled and every
+	// address is healthy if it is zero.
+	Interval time.Duration
+	// Timeout of a probe, it is the interval if it is zero.
+	Timeout time.Duration
+	// TTL is how long an address stays healthy after a successful probe.
+	TTL time.Duration
+}
+
+// Probe returns an error unless the storage server at address is healthy.
+type Probe func(ctx context.Context, address string) error
+
+// Checker keeps results of probes per address. A nil Checker reports every
+// address healthy.
+type Checker struct {
+	log    *slog.Logger
+	config Config
+	probe  Probe
+	now    func() time.Time
+
+	mu       sync.Mutex
+	statuses map[string]*status
+}
+
+type status struct {
+	// ok is the time of the latest successful probe.
+	ok  time.Time
+	err error
+}
+
+func New(log *slog.Logger, config Config, probe Probe) *Checker {
+	log = logging.Component(log, "health")
+
+	if config.Timeout <= 0 {
+		config.Timeout = config.Interval
+	}
+
+	return &Checker{
+		log:      log,
+		config:   config,
+		probe:    probe,
+		now:      time.Now,
+		statuses: map[string]*status{},
+	}
+}
+
+// Healthy reports whether the latest successful probe of address is not
+// older than the TTL. An address which has not been probed yet is not
+// healthy.
+func (c *Checker) Healthy(address string) bool {
+	if c == nil || c.config.Interval <= 0 {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.statuses[address]
+
+	return ok && !s.ok.IsZero() && c.now().Sub(s.ok) <= c.config.TTL
+}
+
+// Run probes the addresses right away and then every interval until ctx is
+// done.
+func (c *Checker) Run(ctx context.Context, addresses func() []string) {
+	if c == nil || c.config.Interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		c.probeAll(ctx, addresses())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probeAll probes the addresses concurrently and records the results.
+func (c *Checker) probeAll(ctx context.Context, addresses []string) {
+	var wg sync.WaitGroup
+
+	for _, address := range addresses {
+		wg.Add(1)
+
+		go func(address string) {
+			defer wg.Done()
+
+			probeCtx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+			defer cancel()
+
+			c.record(address, c.probe(probeCtx, address))
+		}(address)
+	}
+
+	wg.Wait()
+}
+
+// record keeps the result of a probe and logs changes of the health.
+func (c *Checker) record(address string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.statuses[address]
+	if !ok {
+		s = &status{}
+		c.statuses[address] = s
+	}
+
+	switch {
+	case err == nil && (s.err != nil || !ok):
+		c.log.Info("storage server is healthy", logging.StorageServer(address))
+	case err != nil && (s.err == nil || !ok):
+		c.log.Warn("failure to probe storage server",
+			logging.StorageServer(address), logging.Err(err))
+	}
+
+	s.err = err
+
+	if err == nil {
+		s.ok = c.now()
+	}
+}
@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker_Healthy(t *testing.T) {
+	var (
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+		now    = time.Unix(0, 0)
+		down   = map[string]bool{}
+	)
+
+	c := New(logger, Config{Interval: time.Second, TTL: 3 * time.Second},
+		func(_ context.Context, address string) error {
+			if down[address] {
+				return errors.New("connection refused")
+			}
+
+			return nil
+		})
+	c.now = func() time.Time { return now }
+
+	// Addresses are not healthy until they are probed.
+	require.False(t, c.Healthy("a"))
+
+	c.probeAll(context.Background(), []string{"a", "b"})
+	require.True(t, c.Healthy("a"))
+	require.True(t, c.Healthy("b"))
+
+	// A failed probe keeps the address healthy until the TTL passes.
+	down["b"] = true
+	now = now.Add(2 * time.Second)
+
+	c.probeAll(context.Background(), []string{"a", "b"})
+	require.True(t, c.Healthy("a"))
+	require.True(t, c.Healthy("b"))
+
+	now = now.Add(2 * time.Second)
+	require.True(t, c.Healthy("a"))
+	require.False(t, c.Healthy("b"))
+
+	down["b"] = false
+
+	c.probeAll(context.Background(), []string{"a", "b"})
+	require.True(t, c.Healthy("b"))
+
+	// Without probing every address is healthy.
+	require.True(t, (*Checker)(nil).Healthy("c"))
+	require.True(t, New(logger, Config{}, nil).Healthy("c"))
+}
@@ -0,0 +1,132 @@
+// Package logging builds structured, leveled loggers. Every component logs
+// with its name, and log records of a request carry its trace and request
+// ids.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"simple-storage/internal/tracing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Keys of common attributes.
+const (
+	KeyService       = "service"
+	KeyComponent     = "component"
+	KeyObject        = "object"
+	KeyChunkID       = "chunk_id"
+	KeyStorageServer = "storage_server"
+	KeyError         = "error"
+	KeyTraceID       = "trace_id"
+	KeyRequestID     = "request_id"
+)
+
+// Config declares how records are written.
+type Config struct {
+	// Format is text or json, text if it is empty.
+	Format string
+	// Level is the minimal level of written records, it may be changed
+	// while the logger is used. Info if it is nil.
+	Level  *slog.LevelVar
+	Output io.Writer
+}
+
+// New returns a logger writing records to the output of config.
+func New(config Config) (*slog.Logger, error) {
+	level := config.Level
+	if level == nil {
+		level = &slog.LevelVar{}
+	}
+
+	opts := &slog.HandlerOptions{AddSource: true, Level: level}
+
+	var handler slog.Handler
+
+	switch config.Format {
+	case "", FormatText:
+		handler = slog.NewTextHandler(config.Output, opts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(config.Output, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", config.Format)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+// ParseLevel returns the level of a name such as debug, info, warn or error.
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, err
+	}
+
+	return level, nil
+}
+
+// Service returns log with records of the named binary.
+func Service(log *slog.Logger, name string) *slog.Logger {
+	return log.With(slog.String(KeyService, name))
+}
+
+// Component returns log with records of the named component.
+func Component(log *slog.Logger, name string) *slog.Logger {
+	return log.With(slog.String(KeyComponent, name))
+}
+
+// Object returns the attribute of an object name.
+func Object(filename string) slog.Attr {
+	return slog.String(KeyObject, filename)
+}
+
+// ChunkID returns the attribute of a chunk id.
+func ChunkID(id string) slog.Attr {
+	return slog.String(KeyChunkID, id)
+}
+
+// StorageServer returns the attribute of a storage server address.
+func StorageServer(address string) slog.Attr {
+	return slog.String(KeyStorageServer, address)
+}
+
+// Err returns the attribute of an error.
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+// contextHandler adds the trace id and the request id of the context to
+// records.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		record.AddAttrs(slog.String(KeyTraceID, sc.TraceID().String()))
+	}
+
+	if id := tracing.RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String(KeyRequestID, id))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
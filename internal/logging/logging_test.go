@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"simple-storage/internal/tracing"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNew_json(t *testing.T) {
+	var (
+		buf   = &bytes.Buffer{}
+		level = &slog.LevelVar{}
+	)
+
+	log, err := New(Config{Format: FormatJSON, Level: level, Output: buf})
+	require.NoError(t, err)
+
+	log = Component(log, "api-server")
+
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+
+	ctx := trace.ContextWithSpanContext(context.Background(),
+		trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID}))
+	ctx = tracing.WithRequestID(ctx, "req-1")
+
+	log.DebugContext(ctx, "not written")
+	log.ErrorContext(ctx, "failure to download chunk",
+		ChunkID("chunk-1"), StorageServer("0.0.0.0:9001"), Err(errors.New("refused")))
+
+	var record map[string]interface{}
+
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	require.Equal(t, "ERROR", record[slog.LevelKey])
+	require.Equal(t, "failure to download chunk", record[slog.MessageKey])
+	require.Equal(t, "api-server", record[KeyComponent])
+	require.Equal(t, "chunk-1", record[KeyChunkID])
+	require.Equal(t, "0.0.0.0:9001", record[KeyStorageServer])
+	require.Equal(t, "refused", record[KeyError])
+	require.Equal(t, traceID.String(), record[KeyTraceID])
+	require.Equal(t, "req-1", record[KeyRequestID])
+
+	// The level is changed while the logger is used.
+	buf.Reset()
+	level.Set(slog.LevelDebug)
+	log.Debug("written")
+	require.Contains(t, buf.String(), `"msg":"written"`)
+}
+
+func TestNew_unknownFormat(t *testing.T) {
+	_, err := New(Config{Format: "xml", Output: &bytes.Buffer{}})
+	require.Error(t, err)
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("debug")
+	require.NoError(t, err)
+	require.Equal(t, slog.LevelDebug, level)
+
+	level, err = ParseLevel("WARN")
+	require.NoError(t, err)
+	require.Equal(t, slog.LevelWarn, level)
+
+	_, err = ParseLevel("verbose")
+	require.Error(t, err)
+}
@@ -0,0 +1,388 @@
+// Package resilience retries calls to remote components and keeps a circuit
+// breaker per remote address.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"simple-storage/internal/logging"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// maxRetryTokens bounds the retry budget of an address, so a long healthy
+// period does not allow a burst of retries.
+const maxRetryTokens = 10
+
+// State is the state of a circuit breaker.
+type State string
+
+const (
+	// StateClosed lets calls through.
+	StateClosed State = "closed"
+	// StateOpen rejects calls until the cooldown passes.
+	StateOpen State = "open"
+	// StateHalfOpen lets a single probing call through, it closes the
+	// breaker if it succeeds.
+	StateHalfOpen State = "half-open"
+)
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as a rejection of the call by a healthy remote, such as
+// a missing chunk. It is neither retried nor counted as a failure.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err is marked by Permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+
+	return errors.As(err, &permanent)
+}
+
+type finalError struct{ err error }
+
+func (e *finalError) Error() string { return e.err.Error() }
+func (e *finalError) Unwrap() error { return e.err }
+
+// Final marks err as a failure which can not be retried, for example because
+// a part of the response has been consumed already.
+func Final(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &finalError{err: err}
+}
+
+// Config declares how calls are retried and when breakers open.
+type Config struct {
+	// MaxAttempts of an idempotent call including the first one, calls are
+	// not retried if it is less than two.
+	MaxAttempts int
+	// BaseBackoff is the delay before the first retry, it doubles with every
+	// retry up to MaxBackoff. Delays are jittered between half and all of it.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Timeout bounds every attempt, there is no timeout if it is zero.
+	Timeout time.Duration
+	// RetryBudget is the number of retry tokens every call earns, a retry
+	// spends one token. Retries are not limited if it is zero.
+	RetryBudget float64
+	// BreakerThreshold is the number of consecutive failures opening the
+	// breaker of an address, breakers never open if it is zero.
+	BreakerThreshold int
+	// BreakerCooldown is how long an open breaker rejects calls before a
+	// probing call is let through.
+	BreakerCooldown time.Duration
+}
+
+// Stats describes calls to an address.
+type Stats struct {
+	State               State      `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	Calls               int64      `json:"calls"`
+	Failures            int64      `json:"failures"`
+	Retries             int64      `json:"retries"`
+	// RetriesDenied counts retries skipped because the budget was spent.
+	RetriesDenied int64 `json:"retries_denied"`
+	// Rejected counts calls failed fast by the open breaker.
+	Rejected    int64    `json:"rejected"`
+	RetryTokens *float64 `json:"retry_tokens,omitempty"`
+}
+
+type target struct {
+	stats    Stats
+	openedAt time.Time
+	probing  bool
+	tokens   float64
+}
+
+// Policy applies the configuration to calls. A nil Policy makes a single
+// attempt of every call.
+type Policy struct {
+	log    *slog.Logger
+	config Config
+	now    func() time.Time
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	targets map[string]*target
+}
+
+// New returns a policy.
+func New(log *slog.Logger, config Config) *Policy {
+	log = logging.Component(log, "resilience")
+
+	return &Policy{
+		log:     log,
+		config:  config,
+		now:     time.Now,
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		targets: map[string]*target{},
+	}
+}
+
+// Do runs call against the address. Idempotent calls are retried with
+// backoff while attempts and the retry budget of the address last. Calls
+// fail fast with ErrCircuitOpen while the breaker of the address is open.
+func (p *Policy) Do(
+	ctx context.Context, address string, idempotent bool,
+	call func(ctx context.Context) error,
+) error {
+	if p == nil {
+		return call(ctx)
+	}
+
+	attempts := 1
+	if idempotent && p.config.MaxAttempts > 1 {
+		attempts = p.config.MaxAttempts
+	}
+
+	var err error
+
+	for attempt := 0; ; attempt++ {
+		if !p.acquire(address, attempt == 0) {
+			// The breaker has been opened by the failures of this call.
+			if err != nil {
+				return err
+			}
+
+			return fmt.Errorf("%s: %w", address, ErrCircuitOpen)
+		}
+
+		err = p.attempt(ctx, call)
+
+		if !p.release(ctx, address, err) {
+			return err
+		}
+
+		var final *finalError
+		if attempt+1 >= attempts || errors.As(err, &final) || !p.retry(address) {
+			return err
+		}
+
+		timer := time.NewTimer(p.backoff(attempt))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (p *Policy) attempt(ctx context.Context, call func(ctx context.Context) error) error {
+	if p.config.Timeout <= 0 {
+		return call(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	return call(ctx)
+}
+
+// Available reports whether the breaker of the address lets calls through.
+func (p *Policy) Available(address string) bool {
+	if p == nil {
+		return true
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t, ok := p.targets[address]
+	if !ok {
+		return true
+	}
+
+	switch t.stats.State {
+	case StateOpen:
+		return p.now().Sub(t.openedAt) >= p.config.BreakerCooldown
+	case StateHalfOpen:
+		return !t.probing
+	default:
+		return true
+	}
+}
+
+// Stats returns stats of every address called.
+func (p *Policy) Stats() map[string]Stats {
+	stats := map[string]Stats{}
+
+	if p == nil {
+		return stats
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for address, t := range p.targets {
+		s := t.stats
+
+		if s.State != StateClosed {
+			openedAt := t.openedAt
+			s.OpenedAt = &openedAt
+		}
+
+		if p.config.RetryBudget > 0 {
+			tokens := t.tokens
+			s.RetryTokens = &tokens
+		}
+
+		stats[address] = s
+	}
+
+	return stats
+}
+
+func (p *Policy) target(address string) *target {
+	t, ok := p.targets[address]
+	if !ok {
+		t = &target{
+			stats:  Stats{State: StateClosed},
+			tokens: maxRetryTokens,
+		}
+		p.targets[address] = t
+	}
+
+	return t
+}
+
+// acquire reports whether an attempt of a call to the address is let
+// through. Only first attempts earn retry tokens.
+func (p *Policy) acquire(address string, first bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t := p.target(address)
+
+	if t.stats.State == StateOpen && p.now().Sub(t.openedAt) >= p.config.BreakerCooldown {
+		t.stats.State = StateHalfOpen
+		t.probing = false
+	}
+
+	switch {
+	case t.stats.State == StateOpen,
+		t.stats.State == StateHalfOpen && t.probing:
+		t.stats.Rejected++
+		return false
+	case t.stats.State == StateHalfOpen:
+		t.probing = true
+	}
+
+	if !first {
+		return true
+	}
+
+	t.stats.Calls++
+
+	if p.config.RetryBudget > 0 {
+		t.tokens += p.config.RetryBudget
+		if t.tokens > maxRetryTokens {
+			t.tokens = maxRetryTokens
+		}
+	}
+
+	return true
+}
+
+// release records the outcome of a call and reports whether it has failed.
+// Rejections and calls canceled by the caller are not failures.
+func (p *Policy) release(ctx context.Context, address string, err error) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t := p.target(address)
+
+	if err != nil && ctx.Err() != nil {
+		t.probing = false
+		return false
+	}
+
+	if err == nil || IsPermanent(err) {
+		t.stats.ConsecutiveFailures = 0
+
+		if t.stats.State != StateClosed {
+			p.log.Info("circuit breaker is closed", slog.String("address", address))
+		}
+
+		t.stats.State = StateClosed
+		t.probing = false
+
+		return false
+	}
+
+	t.stats.Failures++
+	t.stats.ConsecutiveFailures++
+
+	open := t.stats.State == StateHalfOpen ||
+		p.config.BreakerThreshold > 0 && t.stats.State == StateClosed &&
+			t.stats.ConsecutiveFailures >= p.config.BreakerThreshold
+
+	if open {
+		p.log.Error("circuit breaker is open", slog.String("address", address),
+			slog.Int("consecutive_failures", t.stats.ConsecutiveFailures), logging.Err(err))
+
+		t.stats.State = StateOpen
+		t.openedAt = p.now()
+		t.probing = false
+	}
+
+	return true
+}
+
+// retry reports whether the budget of the address allows a retry and spends
+// it.
+func (p *Policy) retry(address string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	t := p.target(address)
+
+	if p.config.RetryBudget > 0 {
+		if t.tokens < 1 {
+			t.stats.RetriesDenied++
+			return false
+		}
+
+		t.tokens--
+	}
+
+	t.stats.Retries++
+
+	return true
+}
+
+func (p *Policy) backoff(attempt int) time.Duration {
+	delay := p.config.BaseBackoff << attempt
+	if delay > p.config.MaxBackoff && p.config.MaxBackoff > 0 || delay < 0 {
+		delay = p.config.MaxBackoff
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return delay/2 + time.Duration(p.rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,157 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+func TestPolicy_retry(t *testing.T) {
+	ctx := context.Background()
+
+	p := New(slog.New(slog.NewTextHandler(io.Discard, nil)), Config{MaxAttempts: 3})
+
+	calls := 0
+	err := p.Do(ctx, "ss1", true, func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errUnavailable
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	// Calls which are not idempotent are tried once.
+	calls = 0
+	err = p.Do(ctx, "ss1", false, func(context.Context) error {
+		calls++
+		return errUnavailable
+	})
+	require.ErrorIs(t, err, errUnavailable)
+	require.Equal(t, 1, calls)
+
+	// Rejections are not retried.
+	calls = 0
+	err = p.Do(ctx, "ss1", true, func(context.Context) error {
+		calls++
+		return Permanent(errUnavailable)
+	})
+	require.ErrorIs(t, err, errUnavailable)
+	require.Equal(t, 1, calls)
+
+	stats := p.Stats()["ss1"]
+	require.Equal(t, int64(3), stats.Calls)
+	require.Equal(t, int64(3), stats.Failures)
+	require.Equal(t, int64(2), stats.Retries)
+	require.Equal(t, StateClosed, stats.State)
+}
+
+func TestPolicy_retryBudget(t *testing.T) {
+	ctx := context.Background()
+
+	p := New(slog.New(slog.NewTextHandler(io.Discard, nil)), Config{MaxAttempts: 100, RetryBudget: 0.1})
+
+	calls := 0
+	err := p.Do(ctx, "ss1", true, func(context.Context) error {
+		calls++
+		return errUnavailable
+	})
+	require.ErrorIs(t, err, errUnavailable)
+
+	// The budget starts full and the call earns a fraction of a token.
+	require.Equal(t, 1+maxRetryTokens, calls)
+
+	stats := p.Stats()["ss1"]
+	require.Equal(t, int64(maxRetryTokens), stats.Retries)
+	require.Equal(t, int64(1), stats.RetriesDenied)
+	require.InDelta(t, 0.0, *stats.RetryTokens, 1e-9)
+}
+
+func TestPolicy_timeout(t *testing.T) {
+	p := New(slog.New(slog.NewTextHandler(io.Discard, nil)), Config{MaxAttempts: 2, Timeout: 10 * time.Millisecond})
+
+	calls := 0
+	err := p.Do(context.Background(), "ss1", true, func(ctx context.Context) error {
+		calls++
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 2, calls)
+
+	// A call canceled by the caller is neither retried nor a failure.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls = 0
+	err = p.Do(ctx, "ss2", true, func(ctx context.Context) error {
+		calls++
+		return ctx.Err()
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 1, calls)
+	require.Equal(t, int64(0), p.Stats()["ss2"].Failures)
+}
+
+func TestPolicy_breaker(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	p := New(slog.New(slog.NewTextHandler(io.Discard, nil)), Config{
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Minute,
+	})
+	p.now = func() time.Time { return now }
+
+	fail := func(context.Context) error { return errUnavailable }
+	succeed := func(context.Context) error { return nil }
+
+	require.ErrorIs(t, p.Do(ctx, "ss1", true, fail), errUnavailable)
+	require.True(t, p.Available("ss1"))
+	require.ErrorIs(t, p.Do(ctx, "ss1", true, fail), errUnavailable)
+
+	// The breaker is open, calls fail fast.
+	require.False(t, p.Available("ss1"))
+	require.ErrorIs(t, p.Do(ctx, "ss1", true, succeed), ErrCircuitOpen)
+	require.True(t, p.Available("ss2"))
+
+	stats := p.Stats()["ss1"]
+	require.Equal(t, StateOpen, stats.State)
+	require.Equal(t, int64(1), stats.Rejected)
+	require.NotNil(t, stats.OpenedAt)
+
+	// A failed probe opens the breaker again.
+	now = now.Add(time.Minute)
+	require.True(t, p.Available("ss1"))
+	require.ErrorIs(t, p.Do(ctx, "ss1", true, fail), errUnavailable)
+	require.False(t, p.Available("ss1"))
+
+	// A successful probe closes it.
+	now = now.Add(time.Minute)
+	require.NoError(t, p.Do(ctx, "ss1", true, succeed))
+	require.True(t, p.Available("ss1"))
+	require.Equal(t, StateClosed, p.Stats()["ss1"].State)
+}
+
+func TestPolicy_nil(t *testing.T) {
+	var p *Policy
+
+	calls := 0
+	err := p.Do(context.Background(), "ss1", true, func(context.Context) error {
+		calls++
+		return errUnavailable
+	})
+	require.ErrorIs(t, err, errUnavailable)
+	require.Equal(t, 1, calls)
+	require.True(t, p.Available("ss1"))
+	require.Empty(t, p.Stats())
+}
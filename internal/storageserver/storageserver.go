@@ -1,43 +1,106 @@
 package storageserver
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"simple-storage/internal/logging"
 	"simple-storage/internal/utils"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ErrChecksumMismatch = errors.New("chunk checksum mismatch")
+	ErrNotRegistered    = errors.New("storage server is not registered")
+	ErrInvalidChunkID   = errors.New("invalid chunk id")
 )
 
+// maxChunkIDLength bounds chunk ids, which are UUIDs.
+const maxChunkIDLength = 64
+
+// checkChunkID rejects ids which are not plain names of the data directory,
+// so chunks are never read or written outside of it.
+func checkChunkID(chunkID string) error {
+	if chunkID == "" || len(chunkID) > maxChunkIDLength {
+		return fmt.Errorf("%w: %q", ErrInvalidChunkID, chunkID)
+	}
+
+	for _, c := range chunkID {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return fmt.Errorf("%w: %q", ErrInvalidChunkID, chunkID)
+		}
+	}
+
+	return nil
+}
+
+// tmpSuffix marks chunks that are being written.
+const tmpSuffix = ".tmp"
+
 type ChunkManager interface {
-	RegisterStorageServer(address string) error
+	RegisterStorageServer(ctx context.Context, address string) error
 }
 
 type StorageServer struct {
-	log    *log.Logger
+	log    *slog.Logger
 	config Config
 	sync.Mutex
+	// usage describes saved chunks, it is guarded by the mutex.
+	usage Usage
+	// registered is set once the chunk manager knows the storage server.
+	registered atomic.Bool
 }
 
 type Config struct {
 	Address                            string
 	DataDirectory                      string
 	TimeBetweetRegistrationRetrySecond int
+	// Registerer receives metrics of disk usage, they are not exported if
+	// it is nil.
+	Registerer prometheus.Registerer
+}
+
+// Usage describes chunks kept in the data directory.
+type Usage struct {
+	Chunks int64 `json:"chunks"`
+	Bytes  int64 `json:"bytes"`
 }
 
 func New(
-	log *log.Logger, config Config, cm ChunkManager,
+	log *slog.Logger, config Config, cm ChunkManager,
 ) *StorageServer {
-	log = utils.LoggerExtendWithPrefix(log, "storage-server ->")
+	log = logging.Component(log, "storage-server")
 
 	ss := &StorageServer{
 		log:    log,
 		config: config,
 	}
 
+	if err := ss.scanUsage(); err != nil {
+		ss.log.Error("failure to scan data directory", logging.Err(err))
+	}
+
+	if config.Registerer != nil {
+		config.Registerer.MustRegister(
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "simple_storage_disk_chunks",
+				Help: "Chunks kept in the data directory.",
+			}, func() float64 { return float64(ss.Usage().Chunks) }),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "simple_storage_disk_used_bytes",
+				Help: "Bytes of chunks kept in the data directory.",
+			}, func() float64 { return float64(ss.Usage().Bytes) }),
+		)
+	}
+
 	go ss.Register(cm)
 
 	return ss
@@ -45,8 +108,8 @@ func New(
 
 func (ss *StorageServer) Register(cm ChunkManager) {
 	for {
-		if err := cm.RegisterStorageServer(ss.config.Address); err != nil {
-			ss.log.Printf("ERROR: failure to register itself: %s", err)
+		if err := cm.RegisterStorageServer(context.Background(), ss.config.Address); err != nil {
+			ss.log.Error("failure to register itself", logging.Err(err))
 
 			time.Sleep(time.Duration(
 				ss.config.TimeBetweetRegistrationRetrySecond) * time.Second)
@@ -54,24 +117,200 @@ func (ss *StorageServer) Register(cm ChunkManager) {
 			continue
 		}
 
+		ss.registered.Store(true)
+
 		return
 	}
 }
 
-func (ss *StorageServer) UploadChunk(chunkID string, in io.Reader) error {
-	file, err := os.Create(filepath.Join(ss.config.DataDirectory, chunkID))
+// Ready returns an error unless the storage server is registered and chunks
+// can be written to the data directory.
+func (ss *StorageServer) Ready() error {
+	if !ss.registered.Load() {
+		return ErrNotRegistered
+	}
+
+	file, err := os.CreateTemp(ss.config.DataDirectory, "ready-*"+tmpSuffix)
+	if err != nil {
+		return fmt.Errorf("data directory is not writable: %w", err)
+	}
+
+	file.Close()
+
+	if err := os.Remove(file.Name()); err != nil {
+		return fmt.Errorf("data directory is not writable: %w", err)
+	}
+
+	return nil
+}
+
+// UploadChunk saves a chunk read from in. The chunk is kept only when its
+// content matches checksum. Nothing is kept if ctx is done before the chunk
+// is read.
+func (ss *StorageServer) UploadChunk(
+	ctx context.Context, chunkID string, in io.Reader, checksum uint32,
+) error {
+	if err := checkChunkID(chunkID); err != nil {
+		return err
+	}
+
+	path := filepath.Join(ss.config.DataDirectory, chunkID)
+
+	file, err := os.Create(path + tmpSuffix)
+	if err != nil {
+		return fmt.Errorf("failure to save chunk: %w", err)
+	}
+
+	hash := utils.NewChecksum()
+
+	_, err = io.Copy(io.MultiWriter(file, hash), utils.NewContextReader(ctx, in))
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+
+	if err == nil && checksum != hash.Sum32() {
+		err = ErrChecksumMismatch
+	}
+
 	if err != nil {
+		os.Remove(path + tmpSuffix)
+
 		return fmt.Errorf("failure to save chunk: %w", err)
 	}
 
-	_, err = io.Copy(file, in)
+	ss.Lock()
+	defer ss.Unlock()
+
+	// A chunk saved again replaces the previous copy.
+	if info, err := os.Stat(path); err == nil {
+		ss.usage.Chunks--
+		ss.usage.Bytes -= info.Size()
+	}
+
+	info, err := os.Stat(path + tmpSuffix)
 	if err != nil {
 		return fmt.Errorf("failure to save chunk: %w", err)
 	}
 
+	if err := os.Rename(path+tmpSuffix, path); err != nil {
+		return fmt.Errorf("failure to save chunk: %w", err)
+	}
+
+	ss.usage.Chunks++
+	ss.usage.Bytes += info.Size()
+
 	return nil
 }
 
-func (ss *StorageServer) DownloadChunk(chunkID string) ([]byte, error) {
-	return  ioutil.ReadFile(filepath.Join(ss.config.DataDirectory, chunkID))
+// DownloadChunk opens a chunk and returns its size. Reads of the chunk fail
+// once ctx is done, the caller closes it.
+func (ss *StorageServer) DownloadChunk(
+	ctx context.Context, chunkID string,
+) (io.ReadCloser, int64, error) {
+	if err := checkChunkID(chunkID); err != nil {
+		return nil, 0, err
+	}
+
+	file, err := os.Open(filepath.Join(ss.config.DataDirectory, chunkID))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failure to read chunk: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+
+		return nil, 0, fmt.Errorf("failure to read chunk: %w", err)
+	}
+
+	return &chunkReader{Reader: utils.NewContextReader(ctx, file), Closer: file},
+		info.Size(), nil
+}
+
+type chunkReader struct {
+	io.Reader
+	io.Closer
+}
+
+func (ss *StorageServer) DeleteChunk(_ context.Context, chunkID string) error {
+	if err := checkChunkID(chunkID); err != nil {
+		return err
+	}
+
+	path := filepath.Join(ss.config.DataDirectory, chunkID)
+
+	ss.Lock()
+	defer ss.Unlock()
+
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err == nil {
+		err = os.Remove(path)
+	}
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failure to delete chunk: %w", err)
+	}
+
+	if err == nil {
+		ss.usage.Chunks--
+		ss.usage.Bytes -= info.Size()
+	}
+
+	return nil
+}
+
+// Usage returns the number and the size of saved chunks.
+func (ss *StorageServer) Usage() Usage {
+	ss.Lock()
+	defer ss.Unlock()
+
+	return ss.usage
+}
+
+// scanUsage counts chunks already kept in the data directory.
+func (ss *StorageServer) scanUsage() error {
+	entries, err := os.ReadDir(ss.config.DataDirectory)
+	if err != nil {
+		return err
+	}
+
+	var usage Usage
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || filepath.Ext(entry.Name()) == tmpSuffix {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		usage.Chunks++
+		usage.Bytes += info.Size()
+	}
+
+	ss.Lock()
+	ss.usage = usage
+	ss.Unlock()
+
+	return nil
+}
+
+// StatChunk returns the size of a chunk.
+func (ss *StorageServer) StatChunk(_ context.Context, chunkID string) (int64, error) {
+	if err := checkChunkID(chunkID); err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(filepath.Join(ss.config.DataDirectory, chunkID))
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
 }
@@ -0,0 +1,283 @@
+// Package tlsconfig builds TLS configurations of servers and clients of the
+// cluster from certificate files, which are reloaded when they change.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"simple-storage/internal/logging"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid tls config")
+	ErrNoCertificate = errors.New("no peer certificate")
+)
+
+// Config declares files of a TLS identity.
+type Config struct {
+	// CertFile and KeyFile are the PEM encoded certificate chain and private
+	// key presented to peers. A client without them has no certificate.
+	CertFile string
+	KeyFile  string
+	// CAFile is a PEM bundle of authorities peer certificates are verified
+	// by, the system roots are used if it is not set.
+	CAFile string
+	// ClientAuth is the policy of servers for client certificates.
+	ClientAuth tls.ClientAuthType
+	// ReloadInterval is how often files are checked for changes, they are
+	// checked on every handshake if it is zero.
+	ReloadInterval time.Duration
+}
+
+// Source keeps the certificate and the authorities loaded from files.
+type Source struct {
+	log    *slog.Logger
+	config Config
+
+	mu       sync.Mutex
+	checked  time.Time
+	modTimes map[string]time.Time
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+}
+
+// New loads files of the config.
+func New(log *slog.Logger, config Config) (*Source, error) {
+	log = logging.Component(log, "tls")
+
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, fmt.Errorf("%w: cert and key files should be set together",
+			ErrInvalidConfig)
+	}
+
+	if config.ClientAuth >= tls.VerifyClientCertIfGiven && config.CAFile == "" {
+		return nil, fmt.Errorf("%w: ca file is required to verify clients",
+			ErrInvalidConfig)
+	}
+
+	s := &Source{
+		log:    log,
+		config: config,
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	s.checked = time.Now()
+
+	return s, nil
+}
+
+// ServerConfig returns the configuration of a TLS server. The server
+// presents the certificate and verifies clients by the authorities.
+func (s *Source) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, _ := s.current()
+			if cert == nil {
+				return nil, fmt.Errorf("%w: server has no certificate", ErrInvalidConfig)
+			}
+
+			return cert, nil
+		},
+		// Client authorities are not a callback, so the configuration is
+		// built for every handshake to pick up reloaded files.
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := s.current()
+			if cert == nil {
+				return nil, fmt.Errorf("%w: server has no certificate", ErrInvalidConfig)
+			}
+
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    pool,
+				ClientAuth:   s.config.ClientAuth,
+				// HTTP/2 is required by gRPC.
+				NextProtos: []string{"h2", "http/1.1"},
+			}, nil
+		},
+	}
+}
+
+// ClientConfig returns the configuration of a TLS client. The client
+// presents the certificate if there is one and verifies servers by the
+// authorities.
+func (s *Source) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// Server certificates are verified by VerifyConnection against the
+		// current authorities instead.
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := s.current()
+			if cert == nil {
+				return &tls.Certificate{}, nil
+			}
+
+			return cert, nil
+		},
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return ErrNoCertificate
+			}
+
+			_, pool := s.current()
+
+			opts := x509.VerifyOptions{
+				Roots:         pool,
+				DNSName:       cs.ServerName,
+				Intermediates: x509.NewCertPool(),
+			}
+
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+
+			_, err := cs.PeerCertificates[0].Verify(opts)
+
+			return err
+		},
+	}
+}
+
+// current returns the certificate and the authorities, reloading them first
+// if their files have changed.
+func (s *Source) current() (*tls.Certificate, *x509.CertPool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.checked) >= s.config.ReloadInterval {
+		s.checked = time.Now()
+
+		if s.changed() {
+			// The last good files stay in use until the new ones are valid.
+			if err := s.load(); err != nil {
+				s.log.Error("failure to reload certificates", logging.Err(err))
+			} else {
+				s.log.Info("certificates are reloaded")
+			}
+		}
+	}
+
+	return s.cert, s.pool
+}
+
+// changed reports whether modification times of files differ from the
+// loaded ones.
+func (s *Source) changed() bool {
+	for _, filename := range s.files() {
+		info, err := os.Stat(filename)
+		if err != nil {
+			continue
+		}
+
+		if !info.ModTime().Equal(s.modTimes[filename]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// load reads all files, it keeps the loaded ones if any of them is invalid.
+func (s *Source) load() error {
+	modTimes := map[string]time.Time{}
+
+	for _, filename := range s.files() {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return fmt.Errorf("failure to read tls file: %w", err)
+		}
+
+		modTimes[filename] = info.ModTime()
+	}
+
+	var (
+		cert *tls.Certificate
+		pool *x509.CertPool
+	)
+
+	if s.config.CertFile != "" {
+		pair, err := tls.LoadX509KeyPair(s.config.CertFile, s.config.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failure to load certificate: %w", err)
+		}
+
+		cert = &pair
+	}
+
+	if s.config.CAFile != "" {
+		buf, err := os.ReadFile(s.config.CAFile)
+		if err != nil {
+			return fmt.Errorf("failure to read ca file: %w", err)
+		}
+
+		pool = x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(buf) {
+			return fmt.Errorf("%w: no certificates in ca file: %s",
+				ErrInvalidConfig, s.config.CAFile)
+		}
+	}
+
+	s.cert, s.pool, s.modTimes = cert, pool, modTimes
+
+	return nil
+}
+
+func (s *Source) files() []string {
+	var files []string
+
+	for _, filename := range []string{s.config.CertFile, s.config.KeyFile, s.config.CAFile} {
+		if filename != "" {
+			files = append(files, filename)
+		}
+	}
+
+	return files
+}
+
+// Identities returns names a certificate identifies its holder by: the
+// common name, DNS names and URIs, such as SPIFFE IDs.
+func Identities(cert *x509.Certificate) []string {
+	var identities []string
+
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+
+	identities = append(identities, cert.DNSNames...)
+
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+
+	return identities
+}
+
+// PeerAllowed reports whether the verified peer certificate of a connection
+// has one of the allowed identities.
+func PeerAllowed(state *tls.ConnectionState, allowed []string) bool {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return false
+	}
+
+	for _, identity := range Identities(state.VerifiedChains[0][0]) {
+		for _, a := range allowed {
+			if identity == a {
+				return true
+			}
+		}
+	}
+
+	return false
+}
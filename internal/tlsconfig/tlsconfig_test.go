@@ -0,0 +1,276 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newCert issues a certificate for localhost, signed by parent or self signed
+// as an authority if parent is nil.
+func newCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	spiffe, err := url.Parse("spiffe://cluster/" + name)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		URIs:         []*url.URL{spiffe},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth,
+		},
+	}
+
+	signer := &testCert{cert: template, key: key}
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer = parent
+	}
+
+	der, err := x509.CreateCertificate(
+		rand.Reader, template, signer.cert, &key.PublicKey, signer.key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCert{cert: cert, key: key}
+}
+
+// write stores the certificate and its key as PEM files, it returns their
+// paths.
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+
+	writePEM(t, certFile, "CERTIFICATE", c.cert.Raw)
+
+	der, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+
+	writePEM(t, keyFile, "EC PRIVATE KEY", der)
+
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, filename, blockType string, der []byte) {
+	buf := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(filename, buf, 0o600))
+
+	touch(t, filename)
+}
+
+var touched int
+
+// touch gives the file a new modification time, times of quickly rewritten
+// files may be equal otherwise.
+func touch(t *testing.T, filename string) {
+	touched++
+
+	modTime := time.Now().Add(time.Duration(touched) * time.Second)
+	require.NoError(t, os.Chtimes(filename, modTime, modTime))
+}
+
+// identityHandler responds with the identities of the client certificate.
+func identityHandler(w http.ResponseWriter, r *http.Request) {
+	if len(r.TLS.PeerCertificates) == 0 {
+		io.WriteString(w, "anonymous")
+		return
+	}
+
+	io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+}
+
+func TestSource_mutualTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := newCert(t, "ca", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+
+	serverCertFile, serverKeyFile := newCert(t, "api-server", ca).write(t, dir, "server")
+	clientCertFile, clientKeyFile := newCert(t, "storage-server", ca).write(t, dir, "client")
+
+	otherCA := newCert(t, "other-ca", nil)
+	otherCertFile, otherKeyFile := newCert(t, "intruder", otherCA).write(t, dir, "other")
+
+	server, err := New(slog.Default(), Config{
+		CertFile:   serverCertFile,
+		KeyFile:    serverKeyFile,
+		CAFile:     caFile,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	})
+	require.NoError(t, err)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(identityHandler))
+	ts.TLS = server.ServerConfig()
+	ts.StartTLS()
+	defer ts.Close()
+
+	tt := []struct {
+		name     string
+		config   Config
+		identity string
+		err      bool
+	}{
+		{
+			name:     "trusted client",
+			config:   Config{CertFile: clientCertFile, KeyFile: clientKeyFile, CAFile: caFile},
+			identity: "storage-server",
+		},
+		{
+			name:   "client without certificate",
+			config: Config{CAFile: caFile},
+			err:    true,
+		},
+		{
+			name:   "client of other authority",
+			config: Config{CertFile: otherCertFile, KeyFile: otherKeyFile, CAFile: caFile},
+			err:    true,
+		},
+		{
+			name: "client not trusting the server",
+			config: Config{
+				CertFile: clientCertFile, KeyFile: clientKeyFile, CAFile: otherCertFile,
+			},
+			err: true,
+		},
+	}
+
+	for _, tc := range tt {
+		client, err := New(slog.Default(), tc.config)
+		require.NoError(t, err, tc.name)
+
+		identity, err := get(client, ts.URL)
+		if tc.err {
+			require.Error(t, err, tc.name)
+			continue
+		}
+
+		require.NoError(t, err, tc.name)
+		require.Equal(t, tc.identity, identity, tc.name)
+	}
+}
+
+func TestSource_reload(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := newCert(t, "ca", nil)
+	otherCA := newCert(t, "other-ca", nil)
+
+	serverCertFile, serverKeyFile := newCert(t, "api-server", otherCA).write(t, dir, "server")
+	caFile, _ := ca.write(t, dir, "ca")
+
+	server, err := New(slog.Default(), Config{CertFile: serverCertFile, KeyFile: serverKeyFile})
+	require.NoError(t, err)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(identityHandler))
+	ts.TLS = server.ServerConfig()
+	ts.StartTLS()
+	defer ts.Close()
+
+	client, err := New(slog.Default(), Config{CAFile: caFile})
+	require.NoError(t, err)
+
+	_, err = get(client, ts.URL)
+	require.Error(t, err)
+
+	// The client trusts the new bundle without a restart.
+	writePEM(t, caFile, "CERTIFICATE", otherCA.cert.Raw)
+
+	identity, err := get(client, ts.URL)
+	require.NoError(t, err)
+	require.Equal(t, "anonymous", identity)
+
+	// An invalid file keeps the last good one in use.
+	require.NoError(t, os.WriteFile(caFile, []byte("garbage"), 0o600))
+	touch(t, caFile)
+
+	_, err = get(client, ts.URL)
+	require.NoError(t, err)
+}
+
+func TestNew_invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	certFile, _ := newCert(t, "ca", nil).write(t, dir, "ca")
+
+	tt := []Config{
+		{CertFile: certFile},
+		{ClientAuth: tls.RequireAndVerifyClientCert},
+		{CAFile: filepath.Join(dir, "missing.crt")},
+		{CertFile: certFile, KeyFile: certFile},
+	}
+
+	for _, config := range tt {
+		_, err := New(slog.Default(), config)
+		require.Error(t, err, "%+v", config)
+	}
+}
+
+func TestPeerAllowed(t *testing.T) {
+	ca := newCert(t, "ca", nil)
+	cert := newCert(t, "storage-server", ca)
+
+	state := &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{cert.cert, ca.cert}},
+	}
+
+	require.True(t, PeerAllowed(state, []string{"storage-server"}))
+	require.True(t, PeerAllowed(state, []string{"spiffe://cluster/storage-server"}))
+	require.True(t, PeerAllowed(state, []string{"api-server", "localhost"}))
+	require.False(t, PeerAllowed(state, []string{"api-server"}))
+	require.False(t, PeerAllowed(&tls.ConnectionState{}, []string{"storage-server"}))
+	require.False(t, PeerAllowed(nil, []string{"storage-server"}))
+}
+
+// get requests the url with a new connection.
+func get(source *Source, url string) (string, error) {
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: source.ClientConfig(),
+	}}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	buf, err := io.ReadAll(resp.Body)
+
+	return string(buf), err
+}
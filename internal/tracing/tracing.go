@@ -0,0 +1,251 @@
+// Package tracing propagates request ids and W3C trace context between
+// components and exports OpenTelemetry spans of their work.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDHeader carries the request id in HTTP requests and responses, and
+// in gRPC and chunk protocol metadata.
+const RequestIDHeader = "X-Request-Id"
+
+// MaxRequestIDLength bounds request ids taken from callers, so that they fit
+// the metadata of every transport.
+const MaxRequestIDLength = 128
+
+const instrumentationName = "simple-storage"
+
+// Exporters of spans.
+const (
+	// ExporterNone keeps trace ids for propagation and logs only.
+	ExporterNone = "none"
+	// ExporterFile writes spans as JSON lines to a file.
+	ExporterFile = "file"
+	// ExporterOTLP sends spans to an OpenTelemetry collector over gRPC.
+	ExporterOTLP = "otlp"
+)
+
+// Config declares how spans are exported.
+type Config struct {
+	// Exporter is none, file or otlp, none if it is empty.
+	Exporter string
+	// File spans are appended to by the file exporter.
+	File string
+	// OTLPEndpoint is the host:port of the collector.
+	OTLPEndpoint string
+	// OTLPInsecure disables TLS to the collector.
+	OTLPInsecure bool
+	ServiceName  string
+	// SampleRatio is the part of traces started by this service which are
+	// exported, traces started by callers follow their decision.
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider and the propagator of trace
+// context. Baggage of callers is not propagated, since it is unbounded. The
+// returned function flushes spans and stops the exporter.
+func Setup(ctx context.Context, config Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(semconv.ServiceName(config.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(
+			sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	}
+
+	closeFile := func() error { return nil }
+
+	switch config.Exporter {
+	case "", ExporterNone:
+	case ExporterFile:
+		file, err := os.OpenFile(config.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		closeFile = file.Close
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	case ExporterOTLP:
+		clientOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(config.OTLPEndpoint)}
+		if config.OTLPInsecure {
+			clientOpts = append(clientOpts, otlptracegrpc.WithInsecure())
+		}
+
+		exporter, err := otlptracegrpc.New(ctx, clientOpts...)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter: %s", config.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if errClose := closeFile(); err == nil {
+			err = errClose
+		}
+
+		return err
+	}, nil
+}
+
+// Start starts a span of ctx.
+func Start(
+	ctx context.Context, name string, opts ...trace.SpanStartOption,
+) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End records err on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the request id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request id of ctx, it is empty if ctx has none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+
+	return id
+}
+
+// NewRequestID returns a random request id.
+func NewRequestID() string {
+	return uuid.New().String()
+}
+
+// Inject writes the trace context and the request id of ctx to carrier.
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	if id := RequestID(ctx); id != "" {
+		carrier.Set(RequestIDHeader, id)
+	}
+}
+
+// Extract returns ctx with the trace context and the request id read from
+// carrier. A request id which is too long or not printable is ignored.
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
+
+	if id := carrier.Get(RequestIDHeader); validRequestID(id) {
+		ctx = WithRequestID(ctx, id)
+	}
+
+	return ctx
+}
+
+// validRequestID reports whether id is a non-empty string of at most
+// MaxRequestIDLength printable ASCII characters without spaces.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MetadataCarrier adapts gRPC metadata to propagation, keys are lower case.
+type MetadataCarrier metadata.MD
+
+func (c MetadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+func (c MetadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c MetadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// UnaryClientInterceptor sends the trace context and the request id of calls
+// in their metadata.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption,
+	) error {
+		return invoker(outgoingContext(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor sends the trace context and the request id of
+// streams in their metadata.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+		method string, streamer grpc.Streamer, opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		return streamer(outgoingContext(ctx), desc, cc, method, opts...)
+	}
+}
+
+func outgoingContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+
+	Inject(ctx, MetadataCarrier(md))
+
+	return metadata.NewOutgoingContext(ctx, md)
+}
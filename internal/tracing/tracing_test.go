@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestInjectExtract(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Config{ServiceName: "test", SampleRatio: 1})
+	require.NoError(t, err)
+
+	defer shutdown(context.Background())
+
+	ctx, span := Start(WithRequestID(context.Background(), "req-1"), "test")
+	defer span.End()
+
+	carriers := []propagation.TextMapCarrier{
+		propagation.MapCarrier{},
+		MetadataCarrier(metadata.MD{}),
+	}
+
+	for _, carrier := range carriers {
+		Inject(ctx, carrier)
+
+		extracted := Extract(context.Background(), carrier)
+
+		require.Equal(t, "req-1", RequestID(extracted))
+		require.Equal(t, span.SpanContext().TraceID(),
+			trace.SpanContextFromContext(extracted).TraceID())
+		require.True(t, trace.SpanContextFromContext(extracted).IsRemote())
+	}
+}
+
+func TestExtract_invalidRequestID(t *testing.T) {
+	for _, id := range []string{
+		strings.Repeat("a", MaxRequestIDLength+1),
+		"req 1",
+		"req\x001",
+		"req-\u00e9",
+	} {
+		ctx := Extract(context.Background(), propagation.MapCarrier{RequestIDHeader: id})
+		require.Empty(t, RequestID(ctx), id)
+	}
+
+	id := strings.Repeat("a", MaxRequestIDLength)
+	ctx := Extract(context.Background(), propagation.MapCarrier{RequestIDHeader: id})
+	require.Equal(t, id, RequestID(ctx))
+}
+
+func TestSetup_unknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), Config{Exporter: "jaeger"})
+	require.Error(t, err)
+}
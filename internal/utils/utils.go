@@ -1,8 +1,48 @@
 package utils
 
-import "math"
+import (
+	"context"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+)
 
 func ChunkSize(filesize int64, cChunk int) int {
+	if cChunk == 0 {
+		return 0
+	}
+
 	return int(math.Ceil(float64(filesize) / float64(cChunk)))
 }
 
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Checksum returns CRC32C of a chunk.
+func Checksum(buf []byte) uint32 {
+	return crc32.Checksum(buf, castagnoli)
+}
+
+// NewChecksum returns a hash computing the same checksum as Checksum.
+func NewChecksum() hash.Hash32 {
+	return crc32.New(castagnoli)
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// NewContextReader returns a reader failing with the error of ctx once ctx
+// is done.
+func NewContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.r.Read(p)
+}
@@ -5,6 +5,8 @@
 package mock
 
 import (
+	context "context"
+	io "io"
 	reflect "reflect"
 	chunkmanager "simple-storage/internal/chunkmanager"
 
@@ -34,35 +36,208 @@ func (m *MockChunkManager) EXPECT() *MockChunkManagerMockRecorder {
 	return m.recorder
 }
 
-// ChunksInfo mocks base method.
-func (m *MockChunkManager) ChunksInfo(filename string) ([]chunkmanager.Chunk, int64, error) {
+// CommitFile mocks base method.
+func (m *MockChunkManager) CommitFile(filename string, file chunkmanager.File, cond chunkmanager.Conditions) (chunkmanager.File, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ChunksInfo", filename)
-	ret0, _ := ret[0].([]chunkmanager.Chunk)
-	ret1, _ := ret[1].(int64)
+	ret := m.ctrl.Call(m, "CommitFile", filename, file, cond)
+	ret0, _ := ret[0].(chunkmanager.File)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CommitFile indicates an expected call of CommitFile.
+func (mr *MockChunkManagerMockRecorder) CommitFile(filename, file, cond interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CommitFile", reflect.TypeOf((*MockChunkManager)(nil).CommitFile), filename, file, cond)
+}
+
+// DeleteFile mocks base method.
+func (m *MockChunkManager) DeleteFile(filename string, cond chunkmanager.Conditions) (chunkmanager.File, []chunkmanager.File, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteFile", filename, cond)
+	ret0, _ := ret[0].(chunkmanager.File)
+	ret1, _ := ret[1].([]chunkmanager.File)
 	ret2, _ := ret[2].(error)
 	return ret0, ret1, ret2
 }
 
-// ChunksInfo indicates an expected call of ChunksInfo.
-func (mr *MockChunkManagerMockRecorder) ChunksInfo(filename interface{}) *gomock.Call {
+// DeleteFile indicates an expected call of DeleteFile.
+func (mr *MockChunkManagerMockRecorder) DeleteFile(filename, cond interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFile", reflect.TypeOf((*MockChunkManager)(nil).DeleteFile), filename, cond)
+}
+
+// DestroyFile mocks base method.
+func (m *MockChunkManager) DestroyFile(filename string) ([]chunkmanager.File, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DestroyFile", filename)
+	ret0, _ := ret[0].([]chunkmanager.File)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DestroyFile indicates an expected call of DestroyFile.
+func (mr *MockChunkManagerMockRecorder) DestroyFile(filename interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DestroyFile", reflect.TypeOf((*MockChunkManager)(nil).DestroyFile), filename)
+}
+
+// FileInfo mocks base method.
+func (m *MockChunkManager) FileInfo(filename string) (chunkmanager.File, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FileInfo", filename)
+	ret0, _ := ret[0].(chunkmanager.File)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FileInfo indicates an expected call of FileInfo.
+func (mr *MockChunkManagerMockRecorder) FileInfo(filename interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FileInfo", reflect.TypeOf((*MockChunkManager)(nil).FileInfo), filename)
+}
+
+// Filenames mocks base method.
+func (m *MockChunkManager) Filenames() []string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Filenames")
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// Filenames indicates an expected call of Filenames.
+func (mr *MockChunkManagerMockRecorder) Filenames() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Filenames", reflect.TypeOf((*MockChunkManager)(nil).Filenames))
+}
+
+// NumberOfChunks mocks base method.
+func (m *MockChunkManager) NumberOfChunks(filesize int64) int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NumberOfChunks", filesize)
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// NumberOfChunks indicates an expected call of NumberOfChunks.
+func (mr *MockChunkManagerMockRecorder) NumberOfChunks(filesize interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NumberOfChunks", reflect.TypeOf((*MockChunkManager)(nil).NumberOfChunks), filesize)
+}
+
+// PlaceChunk mocks base method.
+func (m *MockChunkManager) PlaceChunk() (chunkmanager.Chunk, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PlaceChunk")
+	ret0, _ := ret[0].(chunkmanager.Chunk)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PlaceChunk indicates an expected call of PlaceChunk.
+func (mr *MockChunkManagerMockRecorder) PlaceChunk() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PlaceChunk", reflect.TypeOf((*MockChunkManager)(nil).PlaceChunk))
+}
+
+// ReleaseChunks mocks base method.
+func (m *MockChunkManager) ReleaseChunks(chunks []chunkmanager.Chunk) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ReleaseChunks", chunks)
+}
+
+// ReleaseChunks indicates an expected call of ReleaseChunks.
+func (mr *MockChunkManagerMockRecorder) ReleaseChunks(chunks interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChunksInfo", reflect.TypeOf((*MockChunkManager)(nil).ChunksInfo), filename)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseChunks", reflect.TypeOf((*MockChunkManager)(nil).ReleaseChunks), chunks)
+}
+
+// RestoreVersion mocks base method.
+func (m *MockChunkManager) RestoreVersion(filename, versionID string) (chunkmanager.File, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreVersion", filename, versionID)
+	ret0, _ := ret[0].(chunkmanager.File)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreVersion indicates an expected call of RestoreVersion.
+func (mr *MockChunkManagerMockRecorder) RestoreVersion(filename, versionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreVersion", reflect.TypeOf((*MockChunkManager)(nil).RestoreVersion), filename, versionID)
 }
 
 // SplitIntoChunks mocks base method.
-func (m *MockChunkManager) SplitIntoChunks(filename string, size int64) ([]chunkmanager.Chunk, error) {
+func (m *MockChunkManager) SplitIntoChunks(filename string, size int64, cond chunkmanager.Conditions) ([]chunkmanager.Chunk, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SplitIntoChunks", filename, size)
+	ret := m.ctrl.Call(m, "SplitIntoChunks", filename, size, cond)
 	ret0, _ := ret[0].([]chunkmanager.Chunk)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SplitIntoChunks indicates an expected call of SplitIntoChunks.
-func (mr *MockChunkManagerMockRecorder) SplitIntoChunks(filename, size interface{}) *gomock.Call {
+func (mr *MockChunkManagerMockRecorder) SplitIntoChunks(filename, size, cond interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SplitIntoChunks", reflect.TypeOf((*MockChunkManager)(nil).SplitIntoChunks), filename, size, cond)
+}
+
+// StatFile mocks base method.
+func (m *MockChunkManager) StatFile(filename, versionID string, cond chunkmanager.Conditions) (chunkmanager.File, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StatFile", filename, versionID, cond)
+	ret0, _ := ret[0].(chunkmanager.File)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StatFile indicates an expected call of StatFile.
+func (mr *MockChunkManagerMockRecorder) StatFile(filename, versionID, cond interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StatFile", reflect.TypeOf((*MockChunkManager)(nil).StatFile), filename, versionID, cond)
+}
+
+// UpdateFile mocks base method.
+func (m *MockChunkManager) UpdateFile(filename string, update func(*chunkmanager.File) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateFile", filename, update)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateFile indicates an expected call of UpdateFile.
+func (mr *MockChunkManagerMockRecorder) UpdateFile(filename, update interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SplitIntoChunks", reflect.TypeOf((*MockChunkManager)(nil).SplitIntoChunks), filename, size)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateFile", reflect.TypeOf((*MockChunkManager)(nil).UpdateFile), filename, update)
+}
+
+// Versioning mocks base method.
+func (m *MockChunkManager) Versioning(bucket string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Versioning", bucket)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Versioning indicates an expected call of Versioning.
+func (mr *MockChunkManagerMockRecorder) Versioning(bucket interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Versioning", reflect.TypeOf((*MockChunkManager)(nil).Versioning), bucket)
+}
+
+// Versions mocks base method.
+func (m *MockChunkManager) Versions(filename string) ([]chunkmanager.File, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Versions", filename)
+	ret0, _ := ret[0].([]chunkmanager.File)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Versions indicates an expected call of Versions.
+func (mr *MockChunkManagerMockRecorder) Versions(filename interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Versions", reflect.TypeOf((*MockChunkManager)(nil).Versions), filename)
 }
 
 // MockStorageServer is a mock of StorageServer interface.
@@ -88,30 +263,44 @@ func (m *MockStorageServer) EXPECT() *MockStorageServerMockRecorder {
 	return m.recorder
 }
 
+// DeleteChunk mocks base method.
+func (m *MockStorageServer) DeleteChunk(ctx context.Context, chunkID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteChunk", ctx, chunkID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteChunk indicates an expected call of DeleteChunk.
+func (mr *MockStorageServerMockRecorder) DeleteChunk(ctx, chunkID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteChunk", reflect.TypeOf((*MockStorageServer)(nil).DeleteChunk), ctx, chunkID)
+}
+
 // DownloadChunk mocks base method.
-func (m *MockStorageServer) DownloadChunk(chunkID string, buf []byte) error {
+func (m *MockStorageServer) DownloadChunk(ctx context.Context, chunkID string, w io.Writer) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DownloadChunk", chunkID, buf)
+	ret := m.ctrl.Call(m, "DownloadChunk", ctx, chunkID, w)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DownloadChunk indicates an expected call of DownloadChunk.
-func (mr *MockStorageServerMockRecorder) DownloadChunk(chunkID, buf interface{}) *gomock.Call {
+func (mr *MockStorageServerMockRecorder) DownloadChunk(ctx, chunkID, w interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadChunk", reflect.TypeOf((*MockStorageServer)(nil).DownloadChunk), chunkID, buf)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadChunk", reflect.TypeOf((*MockStorageServer)(nil).DownloadChunk), ctx, chunkID, w)
 }
 
 // UploadChunk mocks base method.
-func (m *MockStorageServer) UploadChunk(chunkID string, buf []byte) error {
+func (m *MockStorageServer) UploadChunk(ctx context.Context, chunkID string, checksum uint32, size int64, r io.Reader) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UploadChunk", chunkID, buf)
+	ret := m.ctrl.Call(m, "UploadChunk", ctx, chunkID, checksum, size, r)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UploadChunk indicates an expected call of UploadChunk.
-func (mr *MockStorageServerMockRecorder) UploadChunk(chunkID, buf interface{}) *gomock.Call {
+func (mr *MockStorageServerMockRecorder) UploadChunk(ctx, chunkID, checksum, size, r interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadChunk", reflect.TypeOf((*MockStorageServer)(nil).UploadChunk), chunkID, buf)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadChunk", reflect.TypeOf((*MockStorageServer)(nil).UploadChunk), ctx, chunkID, checksum, size, r)
 }